@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/kubernetes"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// CloneCmd holds the cmd flags
+type CloneCmd struct {
+	kubernetes.CloneOptions
+}
+
+// NewCloneCmd defines a command
+func NewCloneCmd() *cobra.Command {
+	cmd := &CloneCmd{}
+	cloneCmd := &cobra.Command{
+		Use:     "clone SOURCE TARGET",
+		Aliases: []string{"fork"},
+		Short:   "Clone the volume of a workspace into a new workspace",
+		Long: `Creates the persistent volume claim of the workspace TARGET as a copy of the
+volume of the workspace SOURCE, or of one of its volume snapshots. Run
+'devpod up' for TARGET with this provider afterwards to start the clone.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), options.ProviderFromEnv(), args[0], args[1], log.Default.ErrorStreamOnly())
+		},
+	}
+	cloneCmd.Flags().StringVar(&cmd.Snapshot, "snapshot", "", "The volume snapshot to clone instead of the volume of the source workspace")
+	cloneCmd.Flags().StringVar(&cmd.UID, "uid", "", "The devpod UID of the new workspace, generated if empty")
+
+	return cloneCmd
+}
+
+// Run runs the command logic
+func (cmd *CloneCmd) Run(ctx context.Context, options *options.Options, source, target string, log log.Logger) error {
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
+
+	return kubernetesDriver.CloneWorkspace(ctx, source, target, &cmd.CloneOptions)
+}
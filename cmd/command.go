@@ -19,13 +19,13 @@ func NewCommandCmd() *cobra.Command {
 	commandCmd := &cobra.Command{
 		Use:   "command",
 		Short: "Command a container",
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
 			options, err := options.FromEnv()
 			if err != nil {
 				return err
 			}
 
-			return cmd.Run(context.Background(), options, log.Default.ErrorStreamOnly())
+			return cmd.Run(cobraCmd.Context(), options, log.Default.ErrorStreamOnly())
 		},
 	}
 
@@ -34,7 +34,12 @@ func NewCommandCmd() *cobra.Command {
 
 // Run runs the command logic
 func (cmd *CommandCmd) Run(ctx context.Context, options *options.Options, log log.Logger) error {
-	return kubernetes.NewKubernetesDriver(options, log).CommandDevContainer(
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
+
+	return kubernetesDriver.CommandDevContainer(
 		ctx,
 		options.DevContainerID,
 		os.Getenv("DEVCONTAINER_USER"),
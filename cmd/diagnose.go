@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/kubernetes"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// DiagnoseCmd holds the cmd flags
+type DiagnoseCmd struct {
+	Output string
+}
+
+// NewDiagnoseCmd defines a command
+func NewDiagnoseCmd() *cobra.Command {
+	cmd := &DiagnoseCmd{}
+	diagnoseCmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "Collect everything needed to debug a workspace into a support bundle",
+		Long: `Writes a gzipped tarball with the workspace pod and persistent volume claim,
+its status, events, container logs including previous restarts, node conditions,
+the effective provider options and the manifests start would create. Environment
+variables of the workspace are redacted.`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			options, err := options.FromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(cobraCmd.Context(), options, os.Stdout, log.Default.ErrorStreamOnly())
+		},
+	}
+	diagnoseCmd.Flags().StringVarP(&cmd.Output, "output", "o", "", "The file to write the support bundle to, - for stdout. Defaults to devpod-<workspace>-diagnose-<time>.tar.gz")
+
+	return diagnoseCmd
+}
+
+// Run runs the command logic
+func (cmd *DiagnoseCmd) Run(ctx context.Context, options *options.Options, stdout io.Writer, log log.Logger) error {
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Output == "-" {
+		return kubernetesDriver.Diagnose(ctx, options.DevContainerID, stdout)
+	}
+
+	output := cmd.Output
+	if output == "" {
+		output = fmt.Sprintf("devpod-%s-diagnose-%s.tar.gz", options.DevContainerID, time.Now().Format("20060102-150405"))
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("create support bundle: %w", err)
+	}
+	defer file.Close()
+
+	err = kubernetesDriver.Diagnose(ctx, options.DevContainerID, file)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Wrote support bundle to %s", output)
+	return file.Close()
+}
@@ -20,13 +20,13 @@ func NewFindCmd() *cobra.Command {
 	findCmd := &cobra.Command{
 		Use:   "find",
 		Short: "Find a container",
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
 			options, err := options.FromEnv()
 			if err != nil {
 				return err
 			}
 
-			return cmd.Run(context.Background(), options, log.Default.ErrorStreamOnly())
+			return cmd.Run(cobraCmd.Context(), options, log.Default.ErrorStreamOnly())
 		},
 	}
 
@@ -35,14 +35,20 @@ func NewFindCmd() *cobra.Command {
 
 // Run runs the command logic
 func (cmd *FindCmd) Run(ctx context.Context, options *options.Options, log log.Logger) error {
-	containerDetails, err := kubernetes.NewKubernetesDriver(options, log).FindDevContainer(ctx, options.DevContainerID)
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
 	if err != nil {
 		return err
-	} else if containerDetails == nil {
+	}
+
+	// the container details devpod expects, extended by the detailed workspace status
+	workspaceDetails, err := kubernetesDriver.FindWorkspace(ctx, options.DevContainerID)
+	if err != nil {
+		return err
+	} else if workspaceDetails == nil {
 		return nil
 	}
 
-	out, err := json.Marshal(containerDetails)
+	out, err := json.Marshal(workspaceDetails)
 	if err != nil {
 		return fmt.Errorf("error marshalling container details: %w", err)
 	}
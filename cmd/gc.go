@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/kubernetes"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// GcCmd holds the cmd flags
+type GcCmd struct {
+	DryRun bool
+	MinAge time.Duration
+}
+
+// NewGcCmd defines a command
+func NewGcCmd() *cobra.Command {
+	cmd := &GcCmd{}
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Delete leaked workspace resources",
+		Long: `Deletes the objects the provider created that outlived their workspace:
+architecture detection pods, pods, role bindings and pull secrets without a
+workspace persistent volume claim or hibernation placeholder, and service accounts
+once no workspace is left.`,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), options.ProviderFromEnv(), os.Stdout, log.Default.ErrorStreamOnly())
+		},
+	}
+	gcCmd.Flags().BoolVar(&cmd.DryRun, "dry-run", false, "If true, only prints the objects that would be deleted")
+	gcCmd.Flags().DurationVar(&cmd.MinAge, "min-age", time.Hour, "Only objects older than this are deleted. Architecture detection pods older than this are always deleted")
+
+	return gcCmd
+}
+
+// Run runs the command logic
+func (cmd *GcCmd) Run(ctx context.Context, options *options.Options, out io.Writer, log log.Logger) error {
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
+
+	garbage, err := kubernetesDriver.FindGarbage(ctx, cmd.MinAge)
+	if err != nil {
+		return err
+	} else if len(garbage) == 0 {
+		log.Info("No leaked resources found")
+		return nil
+	}
+
+	if cmd.DryRun {
+		for _, obj := range garbage {
+			fmt.Fprintf(out, "Would delete %s\n", obj.String())
+		}
+
+		return nil
+	}
+
+	return kubernetesDriver.DeleteGarbage(ctx, garbage)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/kubernetes"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// GoldenCmd holds the cmd flags
+type GoldenCmd struct {
+	kubernetes.GoldenOptions
+}
+
+// NewGoldenCmd defines a command
+func NewGoldenCmd() *cobra.Command {
+	cmd := &GoldenCmd{}
+	goldenCmd := &cobra.Command{
+		Use:   "golden WORKSPACE NAME",
+		Short: "Snapshot the volume of a workspace as golden source for new workspaces",
+		Long: `Takes a volume snapshot named NAME of the volume of WORKSPACE and prints the
+PVC_DATA_SOURCE value that populates new workspaces from it, e.g.:
+
+  devpod provider set-options kubernetes -o PVC_DATA_SOURCE=$(devpod-provider-kubernetes golden my-workspace monorepo-golden)
+
+The snapshot isn't deleted with the workspace.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), options.ProviderFromEnv(), args[0], args[1], os.Stdout, log.Default.ErrorStreamOnly())
+		},
+	}
+	goldenCmd.Flags().StringVar(&cmd.SnapshotClass, "snapshot-class", "", "The volume snapshot class of the snapshot, the default class of the cluster is used if empty")
+
+	return goldenCmd
+}
+
+// Run runs the command logic
+func (cmd *GoldenCmd) Run(ctx context.Context, options *options.Options, workspace, name string, out io.Writer, log log.Logger) error {
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
+
+	dataSource, err := kubernetesDriver.CreateGoldenSource(ctx, workspace, name, &cmd.GoldenOptions)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, dataSource)
+	return nil
+}
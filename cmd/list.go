@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/kubernetes"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// ListCmd holds the cmd flags
+type ListCmd struct {
+	AllNamespaces bool
+	Output        string
+}
+
+// NewListCmd defines a command
+func NewListCmd() *cobra.Command {
+	cmd := &ListCmd{}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the workspaces in the cluster",
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return cmd.Run(cobraCmd.Context(), options.ProviderFromEnv(), os.Stdout, log.Default.ErrorStreamOnly())
+		},
+	}
+	listCmd.Flags().BoolVarP(&cmd.AllNamespaces, "all-namespaces", "A", false, "If true, lists the workspaces across all namespaces")
+	listCmd.Flags().StringVarP(&cmd.Output, "output", "o", "table", "The output format, one of table or json")
+
+	return listCmd
+}
+
+// Run runs the command logic
+func (cmd *ListCmd) Run(ctx context.Context, options *options.Options, out io.Writer, log log.Logger) error {
+	if cmd.Output != "table" && cmd.Output != "json" {
+		return fmt.Errorf("unsupported output format '%s', use table or json", cmd.Output)
+	}
+
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
+
+	workspaces, err := kubernetesDriver.ListWorkspaces(ctx, cmd.AllNamespaces)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Output == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(workspaces)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	if cmd.AllNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "ID\tIMAGE\tPHASE\tNODE\tDISK SIZE\tDISK USED\tSTORAGE CLASS\tAGE\tLAST START")
+	for _, workspace := range workspaces {
+		if cmd.AllNamespaces {
+			fmt.Fprintf(w, "%s\t", workspace.Namespace)
+		}
+
+		lastStart := "<unknown>"
+		if workspace.LastStart != nil {
+			lastStart = humanDuration(*workspace.LastStart) + " ago"
+		}
+		diskUsed := ""
+		if workspace.DiskUsage != nil {
+			diskUsed = fmt.Sprintf("%d%%", workspace.DiskUsage.UsedPercent)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			workspace.ID,
+			valueOrNone(workspace.Image),
+			workspace.Phase,
+			valueOrNone(workspace.Node),
+			valueOrNone(workspace.DiskSize),
+			valueOrNone(diskUsed),
+			valueOrNone(workspace.StorageClass),
+			humanDuration(workspace.Created),
+			lastStart,
+		)
+	}
+
+	return w.Flush()
+}
+
+func humanDuration(t time.Time) string {
+	return duration.HumanDuration(time.Since(t))
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+
+	return value
+}
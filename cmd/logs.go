@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/kubernetes"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// LogsCmd holds the cmd flags
+type LogsCmd struct {
+	kubernetes.LogOptions
+}
+
+// NewLogsCmd defines a command
+func NewLogsCmd() *cobra.Command {
+	cmd := &LogsCmd{}
+	logsCmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Print the logs of a workspace",
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			options, err := options.FromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(cobraCmd.Context(), options, os.Stdout, os.Stderr, log.Default.ErrorStreamOnly())
+		},
+	}
+	logsCmd.Flags().StringVarP(&cmd.Container, "container", "c", kubernetes.DevContainerName, "The container to print the logs of, e.g. "+kubernetes.InitContainerName+" or a sidecar of the pod template")
+	logsCmd.Flags().BoolVar(&cmd.AllContainers, "all-containers", false, "If true, prints the logs of all containers of the pod prefixed by the container name")
+	logsCmd.Flags().BoolVarP(&cmd.Follow, "follow", "f", false, "If true, streams new logs until interrupted")
+	logsCmd.Flags().BoolVarP(&cmd.Previous, "previous", "p", false, "If true, prints the logs of the previous container instance, e.g. after a crash")
+	logsCmd.Flags().BoolVar(&cmd.Timestamps, "timestamps", false, "If true, prefixes each line with its timestamp")
+	logsCmd.Flags().DurationVar(&cmd.Since, "since", 0, "Only prints logs newer than this duration, e.g. 5s, 2m or 3h")
+	logsCmd.Flags().Int64Var(&cmd.Tail, "tail", -1, "Only prints this number of the most recent lines, -1 prints all lines")
+
+	return logsCmd
+}
+
+// Run runs the command logic
+func (cmd *LogsCmd) Run(ctx context.Context, options *options.Options, stdout io.Writer, stderr io.Writer, log log.Logger) error {
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
+
+	return kubernetesDriver.GetWorkspaceLogs(ctx, options.DevContainerID, &cmd.LogOptions, stdout, stderr)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/kubernetes"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/spf13/cobra"
+)
+
+// RenderCmd holds the cmd flags
+type RenderCmd struct {
+	ShowSecrets bool
+}
+
+// NewRenderCmd defines a command
+func NewRenderCmd() *cobra.Command {
+	cmd := &RenderCmd{}
+	renderCmd := &cobra.Command{
+		Use:   "render",
+		Short: "Print the manifests run would create without touching the cluster",
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			options, err := options.FromEnv()
+			if err != nil {
+				return err
+			}
+
+			return cmd.Run(cobraCmd.Context(), options, os.Stdout, log.Default.ErrorStreamOnly())
+		},
+	}
+	renderCmd.Flags().BoolVar(&cmd.ShowSecrets, "show-secrets", false, "If true, prints the contents of the pull secret instead of redacting them")
+
+	return renderCmd
+}
+
+// Run runs the command logic
+func (cmd *RenderCmd) Run(ctx context.Context, options *options.Options, out io.Writer, log log.Logger) error {
+	runOptions, err := runOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	manifests, err := kubernetes.RenderDevContainer(options, options.DevContainerID, runOptions, log)
+	if err != nil {
+		return err
+	}
+
+	if !cmd.ShowSecrets {
+		manifests.PullSecret = kubernetes.RedactPullSecret(manifests.PullSecret)
+	}
+
+	return kubernetes.WriteManifests(out, manifests.Objects()...)
+}
@@ -1,13 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
 
 	log2 "github.com/loft-sh/log"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 // NewRootCmd returns a new root command
@@ -37,12 +41,24 @@ func Execute() {
 	// build the root command
 	rootCmd := BuildRoot()
 
+	// cancel the command on the first interrupt so it can clean up, a second
+	// interrupt terminates the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// execute command
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		if exitErr, ok := err.(*ssh.ExitError); ok {
 			os.Exit(exitErr.ExitStatus())
 		}
+		if exitErr, ok := err.(utilexec.ExitError); ok {
+			os.Exit(exitErr.ExitStatus())
+		}
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			if len(exitErr.Stderr) > 0 {
 				log2.Default.ErrorStreamOnly().Error(string(exitErr.Stderr))
@@ -64,5 +80,12 @@ func BuildRoot() *cobra.Command {
 	rootCmd.AddCommand(NewFindCmd())
 	rootCmd.AddCommand(NewCommandCmd())
 	rootCmd.AddCommand(NewTargetArchitectureCmd())
+	rootCmd.AddCommand(NewRenderCmd())
+	rootCmd.AddCommand(NewListCmd())
+	rootCmd.AddCommand(NewGcCmd())
+	rootCmd.AddCommand(NewLogsCmd())
+	rootCmd.AddCommand(NewDiagnoseCmd())
+	rootCmd.AddCommand(NewCloneCmd())
+	rootCmd.AddCommand(NewGoldenCmd())
 	return rootCmd
 }
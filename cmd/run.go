@@ -22,13 +22,13 @@ func NewRunCmd() *cobra.Command {
 	runCmd := &cobra.Command{
 		Use:   "run",
 		Short: "Run a container",
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
 			options, err := options.FromEnv()
 			if err != nil {
 				return err
 			}
 
-			return cmd.Run(context.Background(), options, log.Default)
+			return cmd.Run(cobraCmd.Context(), options, log.Default)
 		},
 	}
 
@@ -37,16 +37,31 @@ func NewRunCmd() *cobra.Command {
 
 // Run runs the command logic
 func (cmd *RunCmd) Run(ctx context.Context, options *options.Options, log log.Logger) error {
-	var runOptions *driver.RunOptions
+	runOptions, err := runOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
 
+	return kubernetesDriver.RunDevContainer(ctx, options.DevContainerID, runOptions)
+}
+
+// runOptionsFromEnv reads the run options devpod passes in DEVCONTAINER_RUN_OPTIONS
+func runOptionsFromEnv() (*driver.RunOptions, error) {
 	runOptsEnv := os.Getenv("DEVCONTAINER_RUN_OPTIONS")
-	if runOptsEnv != "" && runOptsEnv != "null" {
-		runOptions = &driver.RunOptions{}
-		err := json.Unmarshal([]byte(runOptsEnv), runOptions)
-		if err != nil {
-			return fmt.Errorf("unmarshal run options: %w", err)
-		}
+	if runOptsEnv == "" || runOptsEnv == "null" {
+		return nil, nil
+	}
+
+	runOptions := &driver.RunOptions{}
+	err := json.Unmarshal([]byte(runOptsEnv), runOptions)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal run options: %w", err)
 	}
 
-	return kubernetes.NewKubernetesDriver(options, log).RunDevContainer(ctx, options.DevContainerID, runOptions)
+	return runOptions, nil
 }
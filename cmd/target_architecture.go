@@ -19,13 +19,13 @@ func NewTargetArchitectureCmd() *cobra.Command {
 	targetArchitectureCmd := &cobra.Command{
 		Use:   "target-architecture",
 		Short: "TargetArchitecture a container",
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
 			options, err := options.FromEnv()
 			if err != nil {
 				return err
 			}
 
-			return cmd.Run(context.Background(), options, log.Default.ErrorStreamOnly())
+			return cmd.Run(cobraCmd.Context(), options, log.Default.ErrorStreamOnly())
 		},
 	}
 
@@ -34,7 +34,12 @@ func NewTargetArchitectureCmd() *cobra.Command {
 
 // Run runs the command logic
 func (cmd *TargetArchitectureCmd) Run(ctx context.Context, options *options.Options, log log.Logger) error {
-	arch, err := kubernetes.NewKubernetesDriver(options, log).TargetArchitecture(ctx, options.DevContainerID)
+	kubernetesDriver, err := kubernetes.NewKubernetesDriver(options, log)
+	if err != nil {
+		return err
+	}
+
+	arch, err := kubernetesDriver.TargetArchitecture(ctx, options.DevContainerID)
 	if err != nil {
 		return fmt.Errorf("get target architecture: %w", err)
 	}
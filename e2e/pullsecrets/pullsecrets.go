@@ -51,7 +51,7 @@ var _ = Describe("Pull secrets", func() {
 
 		By("Create pull secret")
 
-		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName)
+		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName, nil)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(created).To(BeTrue())
 
@@ -65,7 +65,7 @@ var _ = Describe("Pull secrets", func() {
 		registry.Login()
 		defer registry.Logout()
 
-		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName)
+		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName, nil)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(created).To(BeTrue())
 
@@ -85,14 +85,14 @@ var _ = Describe("Pull secrets", func() {
 		registry.Login()
 		defer registry.Logout()
 
-		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName)
+		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName, nil)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(created).To(BeTrue())
 
 		_, err = client.CoreV1().Secrets(namespace).Get(context.TODO(), pullSecretName, metav1.GetOptions{})
 		Expect(err).NotTo(HaveOccurred())
 
-		created, err = driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName)
+		created, err = driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName, nil)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(created).To(BeTrue())
 	})
@@ -101,7 +101,7 @@ var _ = Describe("Pull secrets", func() {
 		imageName := registry.PublicImageName()
 
 		// there shouldn't be any error, but the pull secret shouldn't be created
-		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName)
+		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName, nil)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(created).To(BeFalse())
 
@@ -121,7 +121,7 @@ var _ = Describe("Pull secrets", func() {
 
 		registry.Login()
 		defer registry.Logout()
-		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName)
+		created, err := driver.EnsurePullSecret(context.TODO(), pullSecretName, imageName, nil)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(created).To(BeTrue())
 
@@ -162,8 +162,8 @@ func prepareK8sDriver(namespace string) *kubernetes.KubernetesDriver {
 	options := options2.Options{
 		KubernetesNamespace: namespace,
 	}
-	driver := kubernetes.NewKubernetesDriver(
-		&options, log.Default.ErrorStreamOnly()).(*kubernetes.KubernetesDriver)
+	driver, err := kubernetes.NewKubernetesDriver(&options, log.Default.ErrorStreamOnly())
+	Expect(err).NotTo(HaveOccurred())
 	return driver
 }
 
@@ -0,0 +1,67 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cleanupTimeout bounds the best-effort cleanup after an operation failed or was interrupted
+const cleanupTimeout = 30 * time.Second
+
+// commandGracePeriod is how long the processes of an interrupted command get to exit
+// before they are killed
+const commandGracePeriod = 5
+
+// commandIDEnv marks the processes started by CommandDevContainer
+const commandIDEnv = "DEVPOD_COMMAND_ID"
+
+// terminateCommandScript sends SIGTERM to all processes that have the marker passed as
+// $0 in their environment and SIGKILL to the ones still running after the grace period
+const terminateCommandScript = `
+pids() {
+  for p in /proc/[0-9]*; do
+    if tr '\0' '\n' 2>/dev/null < "$p/environ" | grep -qx "$1"; then echo "${p#/proc/}"; fi
+  done
+}
+kill -TERM $(pids "$0") 2>/dev/null
+i=0
+while [ -n "$(pids "$0")" ] && [ "$i" -lt %d ]; do sleep 1; i=$((i+1)); done
+kill -KILL $(pids "$0") 2>/dev/null
+true
+`
+
+// cleanupContext returns a context to clean up after an operation with. It keeps the
+// values of ctx but isn't cancelled with it, since ctx might be cancelled already.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// cleanupPod deletes a pod that was created by a failed or interrupted operation
+func (k *KubernetesDriver) cleanupPod(ctx context.Context, name string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	k.Log.Infof("Delete pod '%s'...", name)
+	err := k.client.DeletePod(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: &[]int64{0}[0]})
+	if err != nil && !kerrors.IsNotFound(err) {
+		k.Log.Warnf("Error deleting pod '%s', please delete it manually: %v", name, err)
+	}
+}
+
+// terminateCommand stops the processes of an interrupted command. Closing the exec
+// stream doesn't stop them, so they are found by the marker in their environment.
+func (k *KubernetesDriver) terminateCommand(ctx context.Context, podName, commandID string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	k.Log.Debugf("Terminating command '%s' in pod '%s'", commandID, podName)
+	script := fmt.Sprintf(terminateCommandScript, commandGracePeriod)
+	err := k.client.Exec(ctx, podName, DevContainerName, []string{"sh", "-c", script, commandIDEnv + "=" + commandID}, nil, nil, nil)
+	if err != nil {
+		k.Log.Debugf("Error terminating command in pod '%s': %v", podName, err)
+	}
+}
@@ -0,0 +1,92 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// cancelAfter returns a context that is cancelled after the given duration, like a
+// command interrupted by the user
+func cancelAfter(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(d, cancel)
+	t.Cleanup(func() {
+		timer.Stop()
+		cancel()
+	})
+
+	return ctx
+}
+
+func TestCommandDevContainer(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.CommandDevContainer(context.Background(), testWorkspaceID, "vscode", "echo hello", nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, cluster.execs, 1)
+
+	command := cluster.execs[0]
+	assert.Equal(t, "env", command[0])
+	assert.True(t, strings.HasPrefix(command[1], commandIDEnv+"="))
+	assert.Equal(t, []string{"su", "vscode", "-c", "echo hello"}, command[2:])
+}
+
+func TestCommandDevContainerCancelled(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	cluster.exec = func(ctx context.Context, command []string, stdout io.Writer) error {
+		if command[0] != "env" {
+			return nil
+		}
+
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.CommandDevContainer(cancelAfter(t, 50*time.Millisecond), testWorkspaceID, "", "sleep infinity", nil, nil, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, cluster.execs, 2)
+
+	// the processes marked with the id of the command are terminated
+	marker := cluster.execs[0][1]
+	terminate := cluster.execs[1]
+	assert.Equal(t, []string{"sh", "-c"}, terminate[:2])
+	assert.Contains(t, terminate[2], "kill -TERM")
+	assert.Equal(t, marker, terminate[3])
+}
+
+func TestStartDevContainerCancelled(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	cluster := newFakeCluster(objects[0])
+	cluster.scriptPod("devpod-test", podPending)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(cancelAfter(t, 50*time.Millisecond), testWorkspaceID)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.deleted())
+}
+
+func TestTargetArchitectureCancelled(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	// the architecture detection pod is never scheduled
+	cluster.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		return true, watch.NewRaceFreeFake(), nil
+	})
+
+	_, err := d.TargetArchitecture(cancelAfter(t, 50*time.Millisecond), testWorkspaceID)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, cluster.created(), 1)
+	assert.Equal(t, cluster.created(), cluster.deleted())
+}
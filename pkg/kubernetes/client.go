@@ -0,0 +1,117 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// client is the interface the driver uses to talk to the cluster. All methods
+// operate on the namespace the client was created for, unless allNamespaces is set,
+// and return typed API errors, so callers can use k8s.io/apimachinery/pkg/api/errors
+// to check for e.g. NotFound.
+type client interface {
+	// Namespace returns the namespace the client works in, which is resolved from the
+	// kube config if KUBERNETES_NAMESPACE is empty
+	Namespace() string
+	CreateNamespace(ctx context.Context, name string) error
+
+	GetPod(ctx context.Context, name string) (*corev1.Pod, error)
+	// WatchPod watches the pod with the given name for changes after resourceVersion
+	WatchPod(ctx context.Context, name, resourceVersion string) (watch.Interface, error)
+	ListPods(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.Pod, error)
+	CreatePod(ctx context.Context, pod *corev1.Pod, opts metav1.CreateOptions) (*corev1.Pod, error)
+	PatchPod(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.Pod, error)
+	DeletePod(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	DeletePods(ctx context.Context, labelSelector string, opts metav1.DeleteOptions) error
+
+	GetPersistentVolumeClaim(ctx context.Context, name string) (*corev1.PersistentVolumeClaim, error)
+	ListPersistentVolumeClaims(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.PersistentVolumeClaim, error)
+	CreatePersistentVolumeClaim(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error)
+	PatchPersistentVolumeClaim(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.PersistentVolumeClaim, error)
+	DeletePersistentVolumeClaim(ctx context.Context, name string, opts metav1.DeleteOptions) error
+
+	GetServiceAccount(ctx context.Context, name string) (*corev1.ServiceAccount, error)
+	ListServiceAccounts(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.ServiceAccount, error)
+	CreateServiceAccount(ctx context.Context, serviceAccount *corev1.ServiceAccount) (*corev1.ServiceAccount, error)
+	DeleteServiceAccount(ctx context.Context, name string, opts metav1.DeleteOptions) error
+
+	GetRoleBinding(ctx context.Context, name string) (*rbacv1.RoleBinding, error)
+	ListRoleBindings(ctx context.Context, labelSelector string, allNamespaces bool) ([]rbacv1.RoleBinding, error)
+	CreateRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding) (*rbacv1.RoleBinding, error)
+	PatchRoleBinding(ctx context.Context, name string, patchType types.PatchType, data []byte) (*rbacv1.RoleBinding, error)
+	DeleteRoleBinding(ctx context.Context, name string, opts metav1.DeleteOptions) error
+
+	GetSecret(ctx context.Context, name string) (*corev1.Secret, error)
+	ListSecrets(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.Secret, error)
+	CreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error)
+	PatchSecret(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.Secret, error)
+	DeleteSecret(ctx context.Context, name string, opts metav1.DeleteOptions) error
+
+	GetConfigMap(ctx context.Context, name string) (*corev1.ConfigMap, error)
+	ListConfigMaps(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.ConfigMap, error)
+	CreateConfigMap(ctx context.Context, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
+	DeleteConfigMap(ctx context.Context, name string, opts metav1.DeleteOptions) error
+
+	// The volume snapshot methods return NotFound errors if the CSI snapshot CRDs aren't installed
+	GetVolumeSnapshot(ctx context.Context, name string) (*volumeSnapshot, error)
+	ListVolumeSnapshots(ctx context.Context, labelSelector string, allNamespaces bool) ([]volumeSnapshot, error)
+	CreateVolumeSnapshot(ctx context.Context, snapshot *volumeSnapshot) (*volumeSnapshot, error)
+	DeleteVolumeSnapshot(ctx context.Context, name string, opts metav1.DeleteOptions) error
+
+	// ListNodes returns all nodes of the cluster
+	ListNodes(ctx context.Context) ([]corev1.Node, error)
+	// GetStorageClass returns the cluster scoped storage class with the given name
+	GetStorageClass(ctx context.Context, name string) (*storagev1.StorageClass, error)
+	// ListNodePods returns the pods of all namespaces that are scheduled to a node and
+	// not terminated yet
+	ListNodePods(ctx context.Context) ([]corev1.Pod, error)
+
+	// ListEvents returns the events of the object with the given name
+	ListEvents(ctx context.Context, involvedObjectName string) ([]corev1.Event, error)
+
+	GetLease(ctx context.Context, name string) (*coordinationv1.Lease, error)
+	CreateLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error)
+	// UpdateLease replaces the lease and fails with a conflict if it changed since it was read
+	UpdateLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error)
+	DeleteLease(ctx context.Context, name string, opts metav1.DeleteOptions) error
+
+	// Exec runs the command in the given container and streams stdin, stdout and stderr
+	Exec(ctx context.Context, podName, container string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+	// Logs streams the logs of the given pod to stdout
+	Logs(ctx context.Context, podName string, opts *corev1.PodLogOptions, stdout io.Writer) error
+}
+
+// DefaultNamespace is used if neither KUBERNETES_NAMESPACE nor the kube config context
+// set a namespace
+const DefaultNamespace = "devpod"
+
+// legacyKubectlPath is the former default of KUBECTL_PATH. DevPod stores the resolved
+// option values, so existing installations still have it set.
+const legacyKubectlPath = "kubectl"
+
+// newClient creates the native client-go client, or the kubectl client if
+// KUBECTL_PATH is set to anything but its former default
+func newClient(options *options.Options, log log.Logger) (client, error) {
+	if options.KubectlPath == legacyKubectlPath {
+		log.Debugf("Ignore KUBECTL_PATH '%s', set it to the full path of the kubectl binary to use it", options.KubectlPath)
+	} else if options.KubectlPath != "" {
+		log.Debugf("Use kubectl binary '%s'", options.KubectlPath)
+		c := newKubectlClient(options.KubectlPath, options.KubernetesConfig, options.KubernetesContext, options.KubernetesNamespace, log)
+		if c.namespace == "" {
+			c.namespace = c.kubeConfigNamespace()
+		}
+		return c, nil
+	}
+
+	return newNativeClient(options.KubernetesConfig, options.KubernetesContext, options.KubernetesNamespace)
+}
@@ -0,0 +1,105 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    namespace: from-kubeconfig
+- name: without-namespace
+  context:
+    cluster: test
+current-context: test
+`
+
+// writeKubeConfig writes a kube config with a single context to a temporary file
+func writeKubeConfig(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(path, []byte(testKubeConfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestNewClient(t *testing.T) {
+	kubeConfig := writeKubeConfig(t)
+
+	c, err := newClient(&options.Options{KubernetesConfig: kubeConfig}, log.Discard)
+	assert.NoError(t, err)
+	assert.IsType(t, &nativeClient{}, c)
+
+	// the former default of KUBECTL_PATH is still set in existing installations
+	c, err = newClient(&options.Options{KubernetesConfig: kubeConfig, KubectlPath: "kubectl"}, log.Discard)
+	assert.NoError(t, err)
+	assert.IsType(t, &nativeClient{}, c)
+
+	c, err = newClient(&options.Options{KubernetesConfig: kubeConfig, KubectlPath: "/usr/local/bin/kubectl"}, log.Discard)
+	assert.NoError(t, err)
+	assert.IsType(t, &kubectlClient{}, c)
+}
+
+func TestNewKubernetesDriverNamespace(t *testing.T) {
+	kubeConfig := writeKubeConfig(t)
+
+	// the namespace of the current context is used like kubectl does
+	d, err := NewKubernetesDriver(&options.Options{KubernetesConfig: kubeConfig}, log.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, "from-kubeconfig", d.namespace)
+
+	d, err = NewKubernetesDriver(&options.Options{KubernetesConfig: kubeConfig, KubernetesContext: "without-namespace"}, log.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultNamespace, d.namespace)
+
+	d, err = NewKubernetesDriver(&options.Options{KubernetesConfig: kubeConfig, KubernetesNamespace: "workspaces"}, log.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, "workspaces", d.namespace)
+}
+
+func TestNativeClientDeletePods(t *testing.T) {
+	cluster := newFakeCluster(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "devpod-test-a", Namespace: testNamespace, Labels: map[string]string{DevPodWorkspaceLabel: "devpod-test"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "devpod-test-b", Namespace: testNamespace, Labels: map[string]string{DevPodWorkspaceLabel: "devpod-test"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "devpod-other", Namespace: testNamespace, Labels: map[string]string{DevPodWorkspaceLabel: "devpod-other"}}},
+	)
+	// the provider role only allows deleting single pods, like kubectl needed
+	cluster.PrependReactor("delete-collection", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, kerrors.NewForbidden(corev1.Resource("pods"), "", errors.New("cannot deletecollection resource \"pods\""))
+	})
+	c := &nativeClient{clientset: cluster.Clientset, namespace: testNamespace}
+
+	err := c.DeletePods(context.Background(), DevPodWorkspaceLabel+"=devpod-test", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test-a", "pods/devpod-test-b"}, cluster.deleted())
+
+	pods, err := c.ListPods(context.Background(), "", false)
+	assert.NoError(t, err)
+	if assert.Len(t, pods, 1) {
+		assert.Equal(t, "devpod-other", pods[0].Name)
+	}
+}
@@ -0,0 +1,182 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/loft-sh/devpod/pkg/encoding"
+	perrors "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CloneOptions select what a workspace is cloned from
+type CloneOptions struct {
+	// Snapshot clones the volume snapshot with this name instead of the pvc of the workspace
+	Snapshot string
+	// UID is the devpod UID of the new workspace, one is generated if it's empty
+	UID string
+}
+
+// CloneWorkspace creates the pvc of a new workspace with the contents of the volume of
+// an existing workspace. The volume is copied by the CSI driver from the pvc of the
+// source workspace or from one of its volume snapshots, the next run of the new
+// workspace starts from the copy.
+func (k *KubernetesDriver) CloneWorkspace(ctx context.Context, sourceWorkspaceID, targetWorkspaceID string, opts *CloneOptions) error {
+	sourceID := getID(sourceWorkspaceID)
+	targetID := getID(targetWorkspaceID)
+	if sourceID == targetID {
+		return fmt.Errorf("can't clone workspace '%s' into itself", sourceWorkspaceID)
+	}
+
+	uid := opts.UID
+	if uid == "" {
+		uid = encoding.CreateNewUID("", targetWorkspaceID)
+	}
+
+	return k.withLock(ctx, targetID, "clone", func(ctx context.Context) error {
+		return k.cloneWorkspace(ctx, sourceID, targetID, opts.Snapshot, uid)
+	})
+}
+
+func (k *KubernetesDriver) cloneWorkspace(ctx context.Context, sourceID, targetID, snapshotName, uid string) error {
+	// never overwrite an existing workspace
+	existing, _, err := k.getDevContainerPvc(ctx, targetID)
+	if err != nil {
+		return err
+	} else if existing != nil {
+		return fmt.Errorf("workspace '%s' already exists", targetID)
+	}
+	placeholder, err := k.getHibernationPlaceholder(ctx, targetID)
+	if err != nil {
+		return err
+	} else if placeholder != nil {
+		return fmt.Errorf("workspace '%s' already exists and is hibernated", targetID)
+	}
+
+	source, err := k.cloneSource(ctx, sourceID, snapshotName)
+	if err != nil {
+		return err
+	}
+
+	pvc, err := clonedPersistentVolumeClaim(source, targetID, uid)
+	if err != nil {
+		return err
+	}
+
+	k.Log.Infof("Clone %s '%s' into persistent volume claim '%s'...", pvc.Spec.DataSource.Kind, pvc.Spec.DataSource.Name, targetID)
+	_, err = k.client.CreatePersistentVolumeClaim(ctx, pvc)
+	if err != nil {
+		return withHint(perrors.Wrap(err, "create pvc"))
+	}
+
+	k.Log.Infof("Workspace '%s' cloned into '%s'", sourceID, targetID)
+	return nil
+}
+
+// cloneSource returns the pvc of the source workspace with the data source the clone is
+// populated from. Hibernated workspaces are cloned from their latest volume snapshot.
+func (k *KubernetesDriver) cloneSource(ctx context.Context, sourceID, snapshotName string) (*corev1.PersistentVolumeClaim, error) {
+	pvc, _, err := k.getDevContainerPvc(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	} else if pvc == nil {
+		placeholder, err := k.getHibernationPlaceholder(ctx, sourceID)
+		if err != nil {
+			return nil, err
+		} else if placeholder == nil {
+			return nil, fmt.Errorf("workspace '%s' not found", sourceID)
+		}
+
+		if snapshotName == "" {
+			snapshotName = placeholder.Annotations[DevPodSnapshotAnnotation]
+		}
+		snapshot, err := k.getReadyVolumeSnapshot(ctx, snapshotName)
+		if err != nil {
+			return nil, err
+		}
+
+		return restoredPersistentVolumeClaim(placeholder, snapshot)
+	}
+
+	source := pvc.DeepCopy()
+	if snapshotName != "" {
+		snapshot, err := k.getReadyVolumeSnapshot(ctx, snapshotName)
+		if err != nil {
+			return nil, err
+		}
+
+		setSnapshotDataSource(source, snapshot)
+		return source, nil
+	}
+
+	pod, err := k.getPod(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	} else if pod != nil {
+		k.Log.Warnf("Workspace '%s' is running, files that are written while the volume is copied may be inconsistent in the clone. Stop the workspace or clone a volume snapshot for a consistent copy", sourceID)
+	}
+
+	source.Spec.DataSource = &corev1.TypedLocalObjectReference{
+		Kind: "PersistentVolumeClaim",
+		Name: sourceID,
+	}
+
+	// the clone can't be smaller than its source
+	if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+		requestAtLeast(source, capacity)
+	}
+
+	return source, nil
+}
+
+// clonedPersistentVolumeClaim builds the pvc of the new workspace from the source pvc.
+// The dev container info and the workspace uid label are rewritten for the new
+// workspace, annotations that belong to the source volume are dropped.
+func clonedPersistentVolumeClaim(source *corev1.PersistentVolumeClaim, targetID, uid string) (*corev1.PersistentVolumeClaim, error) {
+	containerInfo, err := devContainerInfo(source)
+	if err != nil {
+		return nil, err
+	}
+
+	containerInfo.WorkspaceID = targetID
+	if containerInfo.Options != nil {
+		runOptions := *containerInfo.Options
+		runOptions.UID = uid
+		containerInfo.Options = &runOptions
+	}
+	rawInfo, err := json.Marshal(containerInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{}
+	for key, value := range source.Labels {
+		labels[key] = value
+	}
+	labels[DevPodWorkspaceUIDLabel] = uid
+
+	annotations := map[string]string{}
+	for key, value := range source.Annotations {
+		if !controllerAnnotation(key) && key != DevPodLastStartAnnotation {
+			annotations[key] = value
+		}
+	}
+	annotations[DevPodInfoAnnotation] = string(rawInfo)
+
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        targetID,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      source.Spec.AccessModes,
+			Resources:        source.Spec.Resources,
+			StorageClassName: source.Spec.StorageClassName,
+			VolumeMode:       source.Spec.VolumeMode,
+			DataSource:       source.Spec.DataSource,
+		},
+	}, nil
+}
@@ -0,0 +1,109 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCloneWorkspace(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	source := objects[0].(*corev1.PersistentVolumeClaim)
+	source.Annotations[DevPodLastStartAnnotation] = "2024-03-01T12:00:00Z"
+	source.Annotations["pv.kubernetes.io/bind-completed"] = "yes"
+	source.Spec.VolumeName = "pvc-1234"
+	source.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("12Gi")}
+	cluster := newFakeCluster(objects...)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.CloneWorkspace(context.Background(), testWorkspaceID, "experiment", &CloneOptions{UID: "new-uid"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"persistentvolumeclaims/devpod-experiment"}, cluster.created())
+
+	clone := cluster.persistentVolumeClaim(t, "devpod-experiment")
+	assert.Equal(t, &corev1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "devpod-test"}, clone.Spec.DataSource)
+	assert.Empty(t, clone.Spec.VolumeName)
+	// the clone can't be smaller than its source
+	assert.Equal(t, "12Gi", clone.Spec.Resources.Requests.Storage().String())
+	assert.Equal(t, "new-uid", clone.Labels[DevPodWorkspaceUIDLabel])
+	assert.Equal(t, "true", clone.Labels[DevPodCreatedLabel])
+	assert.NotContains(t, clone.Annotations, DevPodLastStartAnnotation)
+	assert.NotContains(t, clone.Annotations, "pv.kubernetes.io/bind-completed")
+
+	containerInfo, err := devContainerInfo(clone)
+	assert.NoError(t, err)
+	assert.Equal(t, "devpod-experiment", containerInfo.WorkspaceID)
+	assert.Equal(t, "new-uid", containerInfo.Options.UID)
+	assert.Equal(t, testRunOptions().Image, containerInfo.Options.Image)
+
+	// the source is left as it is
+	source = cluster.persistentVolumeClaim(t, "devpod-test")
+	assert.Equal(t, testRunOptions().UID, source.Labels[DevPodWorkspaceUIDLabel])
+
+	err = d.CloneWorkspace(context.Background(), testWorkspaceID, "experiment", &CloneOptions{})
+	assert.EqualError(t, err, "workspace 'devpod-experiment' already exists")
+}
+
+func TestCloneWorkspaceFromSnapshot(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	d := cluster.driver(t, &options.Options{})
+
+	pvcName := "devpod-test"
+	_, err := d.client.CreateVolumeSnapshot(context.Background(), &volumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "devpod-test-abcdef"},
+		Spec:       volumeSnapshotSpec{Source: volumeSnapshotSource{PersistentVolumeClaimName: &pvcName}},
+	})
+	assert.NoError(t, err)
+
+	err = d.CloneWorkspace(context.Background(), testWorkspaceID, "experiment", &CloneOptions{Snapshot: "devpod-test-abcdef"})
+	assert.NoError(t, err)
+
+	clone := cluster.persistentVolumeClaim(t, "devpod-experiment")
+	assert.Equal(t, &corev1.TypedLocalObjectReference{
+		APIGroup: &volumeSnapshotResource.Group,
+		Kind:     "VolumeSnapshot",
+		Name:     "devpod-test-abcdef",
+	}, clone.Spec.DataSource)
+	assert.NotEqual(t, testRunOptions().UID, clone.Labels[DevPodWorkspaceUIDLabel])
+
+	err = d.CloneWorkspace(context.Background(), testWorkspaceID, "other", &CloneOptions{Snapshot: "missing"})
+	assert.EqualError(t, err, "volume snapshot 'missing' not found")
+}
+
+func TestCloneHibernatedWorkspace(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, hibernateOptions())...)
+	d := cluster.driver(t, hibernateOptions())
+
+	err := d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	placeholder, err := d.client.GetConfigMap(context.Background(), "devpod-test")
+	assert.NoError(t, err)
+
+	err = d.CloneWorkspace(context.Background(), testWorkspaceID, "experiment", &CloneOptions{UID: "new-uid"})
+	assert.NoError(t, err)
+
+	clone := cluster.persistentVolumeClaim(t, "devpod-experiment")
+	assert.Equal(t, placeholder.Annotations[DevPodSnapshotAnnotation], clone.Spec.DataSource.Name)
+	assert.NotContains(t, clone.Labels, DevPodHibernationLabel)
+	assert.NotContains(t, clone.Annotations, DevPodSnapshotAnnotation)
+	assert.Equal(t, "new-uid", clone.Labels[DevPodWorkspaceUIDLabel])
+
+	// the source stays hibernated
+	_, err = d.client.GetConfigMap(context.Background(), "devpod-test")
+	assert.NoError(t, err)
+}
+
+func TestCloneWorkspaceNotFound(t *testing.T) {
+	d := newFakeCluster().driver(t, &options.Options{})
+
+	err := d.CloneWorkspace(context.Background(), testWorkspaceID, "experiment", &CloneOptions{})
+	assert.EqualError(t, err, "workspace 'devpod-test' not found")
+
+	err = d.CloneWorkspace(context.Background(), testWorkspaceID, testWorkspaceID, &CloneOptions{})
+	assert.EqualError(t, err, "can't clone workspace 'test' into itself")
+}
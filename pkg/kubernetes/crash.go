@@ -0,0 +1,132 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// crashLogLines is the number of log lines of a crashed container added to the error
+const crashLogLines = 20
+
+// exitCodes explain the exit codes containers commonly crash with
+var exitCodes = map[int32]string{
+	1:   "general error",
+	2:   "misuse of a shell builtin",
+	126: "command not executable",
+	127: "command not found",
+	134: "aborted, SIGABRT",
+	137: "killed, SIGKILL",
+	139: "segmentation fault, SIGSEGV",
+	143: "terminated, SIGTERM",
+}
+
+// crashDetails describes why the container terminated: its exit code, termination
+// message, the last lines of its logs and how to fix it. Containers that are waiting to
+// restart are described by their last termination. It returns an empty string if the
+// container didn't terminate.
+func (k *KubernetesDriver) crashDetails(ctx context.Context, pod *corev1.Pod, containerStatus *corev1.ContainerStatus) string {
+	terminated, previous := containerStatus.State.Terminated, false
+	if terminated == nil {
+		terminated, previous = containerStatus.LastTerminationState.Terminated, true
+	}
+	if terminated == nil {
+		return ""
+	}
+
+	exitCode := fmt.Sprintf("Exit code: %d", terminated.ExitCode)
+	if explanation, ok := exitCodes[terminated.ExitCode]; ok {
+		exitCode += " (" + explanation + ")"
+	}
+	lines := []string{exitCode}
+	if terminated.Reason != "" {
+		lines = append(lines, "Reason: "+terminated.Reason)
+	}
+	if message := strings.TrimSpace(terminated.Message); message != "" {
+		lines = append(lines, "Termination message: "+message)
+	}
+	if containerStatus.RestartCount > 0 {
+		lines = append(lines, fmt.Sprintf("Restarts: %d", containerStatus.RestartCount))
+	}
+
+	logs := &bytes.Buffer{}
+	tailLines := int64(crashLogLines)
+	err := k.client.Logs(ctx, pod.Name, &corev1.PodLogOptions{
+		Container: containerStatus.Name,
+		Previous:  previous,
+		TailLines: &tailLines,
+	}, logs)
+	if err != nil {
+		k.Log.Debugf("Error getting logs of container '%s': %v", containerStatus.Name, err)
+	} else if trimmed := strings.TrimRight(logs.String(), "\n"); trimmed != "" {
+		lines = append(lines, fmt.Sprintf("Last %d lines of logs:", crashLogLines))
+		for _, line := range strings.Split(trimmed, "\n") {
+			lines = append(lines, "  "+line)
+		}
+	}
+
+	if remedy := crashRemedy(pod, containerStatus.Name, terminated, previous); remedy != "" {
+		lines = append(lines, "Hint: "+remedy)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// crashRemedy suggests how to fix the crash of the container
+func crashRemedy(pod *corev1.Pod, name string, terminated *corev1.ContainerStateTerminated, previous bool) string {
+	logsFlags := "-c " + name
+	if previous {
+		logsFlags += " --previous"
+	}
+
+	switch {
+	case terminated.Reason == "OOMKilled":
+		remedy := "The container ran out of memory."
+		if limit := containerMemoryLimit(pod, name); limit != "" {
+			remedy += " Its limit is " + limit + "."
+		}
+		return remedy + " Raise limits.memory in RESOURCES, e.g. RESOURCES=requests.memory=2Gi,limits.memory=8Gi."
+	case terminated.Reason == "ContainerCannotRun" || terminated.Reason == "StartError":
+		return "The container runtime couldn't start the container. Check the entrypoint of the image and the termination message."
+	case terminated.ExitCode == 126 || terminated.ExitCode == 127:
+		return "The entrypoint or command of the container doesn't exist in the image or isn't executable. Check the image and the entrypoint in devcontainer.json."
+	case terminated.ExitCode == 137:
+		return "The container was killed, e.g. by the kubelet after a failed liveness probe or because the node ran out of memory. Check the events of the pod."
+	case name == InitContainerName:
+		return "The init container couldn't copy the workspace files into the volume. Check that DISK_SIZE is large enough and run 'devpod-provider-kubernetes logs " + logsFlags + "' for the full logs."
+	case name == DevContainerName:
+		return "Run 'devpod-provider-kubernetes logs " + logsFlags + "' for the full logs of the crashed container."
+	}
+
+	return ""
+}
+
+func containerMemoryLimit(pod *corev1.Pod, name string) string {
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if container.Name != name {
+				continue
+			}
+
+			if limit, ok := container.Resources.Limits[corev1.ResourceMemory]; ok {
+				return limit.String()
+			}
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// crashError appends the crash details of the container to the error, if it crashed
+func (k *KubernetesDriver) crashError(ctx context.Context, pod *corev1.Pod, containerStatus *corev1.ContainerStatus, err error) error {
+	details := k.crashDetails(ctx, pod, containerStatus)
+	if details == "" {
+		return err
+	}
+
+	return fmt.Errorf("%w\n%s", err, details)
+}
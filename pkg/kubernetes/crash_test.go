@@ -0,0 +1,124 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func podTerminated(reason string, exitCode int32) podTransition {
+	return func(pod *corev1.Pod) {
+		podRunning(pod)
+		pod.Status.ContainerStatuses[0].Ready = false
+		pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{
+				Reason:   reason,
+				ExitCode: exitCode,
+				Message:  "out of memory",
+			},
+		}
+	}
+}
+
+func TestRunDevContainerOOMKilled(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.scriptPod("devpod-test", podTerminated("OOMKilled", 137))
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			Resources: "limits.memory=512Mi",
+		},
+	})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.ErrorContains(t, err, "pod 'devpod-test' container 'devpod' is terminated: out of memory (OOMKilled)\n"+
+		"Exit code: 137 (killed, SIGKILL)\n"+
+		"Reason: OOMKilled\n"+
+		"Termination message: out of memory\n"+
+		"Last 20 lines of logs:\n"+
+		"  logs of devpod\n"+
+		"Hint: The container ran out of memory. Its limit is 512Mi. Raise limits.memory in RESOURCES")
+
+	// the logs of the terminated container itself
+	tailLines := int64(crashLogLines)
+	assert.Equal(t, []*corev1.PodLogOptions{{Container: DevContainerName, TailLines: &tailLines}}, cluster.logs)
+}
+
+func TestRunDevContainerCrashLoopDetails(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.scriptPod("devpod-test", func(pod *corev1.Pod) {
+		podWaiting("CrashLoopBackOff")(pod)
+		pod.Status.ContainerStatuses[0].RestartCount = 3
+		pod.Status.ContainerStatuses[0].LastTerminationState = corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 127},
+		}
+	})
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.ErrorContains(t, err, "Exit code: 127 (command not found)\nReason: Error\nRestarts: 3\n")
+	assert.ErrorContains(t, err, "Hint: The entrypoint or command of the container doesn't exist in the image")
+
+	// the logs of the instance that crashed
+	assert.Len(t, cluster.logs, 1)
+	assert.True(t, cluster.logs[0].Previous)
+}
+
+func TestCrashRemedy(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{
+			Name: DevContainerName,
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+			},
+		}},
+	}}
+
+	testCases := []struct {
+		name       string
+		container  string
+		terminated corev1.ContainerStateTerminated
+		previous   bool
+		expected   string
+	}{
+		{
+			name:       "oom",
+			container:  DevContainerName,
+			terminated: corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137},
+			expected:   "The container ran out of memory. Its limit is 2Gi. Raise limits.memory in RESOURCES, e.g. RESOURCES=requests.memory=2Gi,limits.memory=8Gi.",
+		},
+		{
+			name:       "killed",
+			container:  DevContainerName,
+			terminated: corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 137},
+			expected:   "The container was killed, e.g. by the kubelet after a failed liveness probe or because the node ran out of memory. Check the events of the pod.",
+		},
+		{
+			name:       "init",
+			container:  InitContainerName,
+			terminated: corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1},
+			expected:   "The init container couldn't copy the workspace files into the volume. Check that DISK_SIZE is large enough and run 'devpod-provider-kubernetes logs -c devpod-init' for the full logs.",
+		},
+		{
+			name:       "error",
+			container:  DevContainerName,
+			terminated: corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1},
+			previous:   true,
+			expected:   "Run 'devpod-provider-kubernetes logs -c devpod --previous' for the full logs of the crashed container.",
+		},
+		{
+			name:       "sidecar",
+			container:  "proxy",
+			terminated: corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, crashRemedy(pod, testCase.container, &testCase.terminated, testCase.previous))
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package kubernetes
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// redacted replaces secrets in the support bundle and rendered manifests
+	redacted = "<redacted>"
+
+	// diagnoseLogLines is the number of log lines collected per container
+	diagnoseLogLines = 10000
+)
+
+// effectiveOptions are the provider options including the ones that aren't compared
+// to detect pod changes
+type effectiveOptions struct {
+	options.ComparableOptions
+
+	KubernetesContext   string `json:"kubernetesContext,omitempty"`
+	KubernetesConfig    string `json:"kubernetesConfig,omitempty"`
+	KubernetesNamespace string `json:"kubernetesNamespace,omitempty"`
+	KubectlPath         string `json:"kubectlPath,omitempty"`
+	PodTimeout          string `json:"podTimeout,omitempty"`
+	StartupTimingFormat string `json:"startupTimingFormat,omitempty"`
+
+	DiskUsageWarningThreshold string `json:"diskUsageWarningThreshold,omitempty"`
+
+	Hibernate                  bool   `json:"hibernateOnStop,omitempty"`
+	HibernateSnapshotClass     string `json:"hibernateSnapshotClass,omitempty"`
+	HibernateSnapshotRetention string `json:"hibernateSnapshotRetention,omitempty"`
+}
+
+// nodeConditions are the parts of a node that matter for running the workspace
+type nodeConditions struct {
+	Name          string                 `json:"name"`
+	Unschedulable bool                   `json:"unschedulable,omitempty"`
+	Taints        []corev1.Taint         `json:"taints,omitempty"`
+	Allocatable   corev1.ResourceList    `json:"allocatable,omitempty"`
+	Conditions    []corev1.NodeCondition `json:"conditions"`
+}
+
+// supportBundle writes the files of a gzipped tarball. Steps that fail are recorded
+// in errors.txt instead of aborting, so the bundle contains as much as possible.
+type supportBundle struct {
+	gzipWriter *gzip.Writer
+	tarWriter  *tar.Writer
+	created    time.Time
+	errors     []string
+}
+
+// Diagnose writes a support bundle with everything needed to debug the workspace as a
+// gzipped tarball to out: the pod and pvc with secrets redacted, the workspace status,
+// events, logs of the current and previous containers, node conditions, the effective
+// options and the manifests start would create.
+func (k *KubernetesDriver) Diagnose(ctx context.Context, workspaceId string, out io.Writer) error {
+	id := getID(workspaceId)
+	bundle := newSupportBundle(out)
+
+	bundle.addJSON("options.json", &effectiveOptions{
+		ComparableOptions:   k.options.ComparableOptions,
+		KubernetesContext:   k.options.KubernetesContext,
+		KubernetesConfig:    k.options.KubernetesConfig,
+		KubernetesNamespace: k.namespace,
+		KubectlPath:         k.options.KubectlPath,
+		PodTimeout:          k.options.PodTimeout,
+		StartupTimingFormat: k.options.StartupTimingFormat,
+
+		DiskUsageWarningThreshold: k.options.DiskUsageWarningThreshold,
+
+		Hibernate:                  k.options.Hibernate,
+		HibernateSnapshotClass:     k.options.HibernateSnapshotClass,
+		HibernateSnapshotRetention: k.options.HibernateSnapshotRetention,
+	})
+
+	status, err := k.FindWorkspace(ctx, workspaceId)
+	if err != nil {
+		bundle.fail("find workspace", err)
+	} else if status == nil {
+		bundle.fail("find workspace", fmt.Errorf("workspace '%s' not found", id))
+	} else {
+		bundle.addJSON("status.json", status)
+	}
+
+	pvc, containerInfo, err := k.getDevContainerPvc(ctx, id)
+	if err != nil {
+		bundle.fail("get pvc", err)
+	} else if pvc != nil {
+		bundle.addYAML("pvc.yaml", redactPersistentVolumeClaim(pvc))
+	}
+
+	pod, err := k.getPod(ctx, id)
+	if err != nil {
+		bundle.fail("get pod", err)
+	} else if pod != nil {
+		bundle.addYAML("pod.yaml", redactPod(pod))
+	}
+
+	events, err := k.client.ListEvents(ctx, id)
+	if err != nil {
+		bundle.fail("list events", err)
+	} else {
+		bundle.addYAML("events.yaml", &corev1.EventList{Items: events})
+	}
+
+	if pod != nil {
+		k.diagnoseLogs(ctx, bundle, pod)
+		k.diagnoseNodes(ctx, bundle, pod)
+	}
+
+	if containerInfo != nil && containerInfo.Options != nil {
+		k.diagnoseManifests(bundle, id, pvc, containerInfo)
+	}
+
+	return bundle.close()
+}
+
+// diagnoseLogs collects the logs of the current and previous containers of the pod
+func (k *KubernetesDriver) diagnoseLogs(ctx context.Context, bundle *supportBundle, pod *corev1.Pod) {
+	containerStatuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	containerStatuses = append(containerStatuses, pod.Status.ContainerStatuses...)
+	for _, containerStatus := range containerStatuses {
+		if containerStatus.Name != DevContainerName && containerStatus.Name != InitContainerName {
+			continue
+		}
+
+		previous := []bool{false}
+		if containerStatus.RestartCount > 0 {
+			previous = append(previous, true)
+		}
+		for _, p := range previous {
+			name := "logs/" + containerStatus.Name + ".log"
+			if p {
+				name = "logs/" + containerStatus.Name + ".previous.log"
+			}
+
+			buf := &bytes.Buffer{}
+			err := k.client.Logs(ctx, pod.Name, &corev1.PodLogOptions{
+				Container: containerStatus.Name,
+				Previous:  p,
+				TailLines: &[]int64{diagnoseLogLines}[0],
+			}, buf)
+			if err != nil {
+				bundle.fail("get "+name, err)
+				continue
+			}
+
+			bundle.add(name, buf.Bytes())
+		}
+	}
+}
+
+// diagnoseNodes collects the conditions of the node the pod runs on or of all nodes and
+// why the pod doesn't fit on them if it isn't scheduled
+func (k *KubernetesDriver) diagnoseNodes(ctx context.Context, bundle *supportBundle, pod *corev1.Pod) {
+	nodes, err := k.client.ListNodes(ctx)
+	if err != nil {
+		bundle.fail("list nodes", err)
+		return
+	}
+
+	conditions := []nodeConditions{}
+	for _, node := range nodes {
+		if pod.Spec.NodeName != "" && node.Name != pod.Spec.NodeName {
+			continue
+		}
+
+		conditions = append(conditions, nodeConditions{
+			Name:          node.Name,
+			Unschedulable: node.Spec.Unschedulable,
+			Taints:        node.Spec.Taints,
+			Allocatable:   node.Status.Allocatable,
+			Conditions:    node.Status.Conditions,
+		})
+	}
+	bundle.addYAML("nodes.yaml", conditions)
+
+	if podUnschedulable(pod) {
+		if explanation := k.explainScheduling(ctx, pod); explanation != "" {
+			bundle.add("scheduling.txt", []byte(explanation+"\n"))
+		}
+	}
+}
+
+// diagnoseManifests renders the manifests start would create with the current options
+func (k *KubernetesDriver) diagnoseManifests(bundle *supportBundle, id string, pvc *corev1.PersistentVolumeClaim, containerInfo *DevContainerInfo) {
+	template, err := podTemplate(k.options)
+	if err != nil {
+		bundle.fail("read pod template", err)
+		return
+	}
+
+	pullSecret, err := renderPullSecret(k.options, id, containerInfo.Options.Image, k.Log)
+	if err != nil {
+		bundle.fail("render pull secret", err)
+		return
+	}
+
+	renderOptions := RenderOptions{
+		Namespace:  k.namespace,
+		Initialize: !pvcInitialized(pvc),
+		Owner:      pvcOwnerReference(pvc),
+	}
+	if pullSecret != nil {
+		renderOptions.PullSecret = pullSecret.Name
+	}
+	manifests, err := RenderWorkspace(k.options, id, containerInfo.Options, template, renderOptions, k.Log)
+	if err != nil {
+		bundle.fail("render workspace", err)
+		return
+	}
+
+	manifests.PullSecret = RedactPullSecret(pullSecret)
+	manifests.Pod = redactPod(manifests.Pod)
+	manifests.PersistentVolumeClaim = redactPersistentVolumeClaim(manifests.PersistentVolumeClaim)
+	buf := &bytes.Buffer{}
+	err = WriteManifests(buf, manifests.Objects()...)
+	if err != nil {
+		bundle.fail("write manifests", err)
+		return
+	}
+
+	bundle.add("rendered.yaml", buf.Bytes())
+}
+
+// redactPersistentVolumeClaim returns a copy of the pvc without the environment
+// variables of the workspace in the info annotation
+func redactPersistentVolumeClaim(pvc *corev1.PersistentVolumeClaim) *corev1.PersistentVolumeClaim {
+	pvc = pvc.DeepCopy()
+	raw, ok := pvc.Annotations[DevPodInfoAnnotation]
+	if !ok {
+		return pvc
+	}
+
+	containerInfo := &DevContainerInfo{}
+	err := json.Unmarshal([]byte(raw), containerInfo)
+	if err != nil {
+		pvc.Annotations[DevPodInfoAnnotation] = redacted
+		return pvc
+	}
+
+	if containerInfo.Options != nil {
+		for name := range containerInfo.Options.Env {
+			containerInfo.Options.Env[name] = redacted
+		}
+	}
+	out := &bytes.Buffer{}
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(containerInfo)
+	if err != nil {
+		pvc.Annotations[DevPodInfoAnnotation] = redacted
+		return pvc
+	}
+
+	pvc.Annotations[DevPodInfoAnnotation] = strings.TrimSpace(out.String())
+	return pvc
+}
+
+// redactPod returns a copy of the pod without the values of environment variables,
+// which contain the same secrets as the info annotation of the pvc
+func redactPod(pod *corev1.Pod) *corev1.Pod {
+	pod = pod.DeepCopy()
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			for j := range containers[i].Env {
+				if containers[i].Env[j].Value != "" {
+					containers[i].Env[j].Value = redacted
+				}
+			}
+		}
+	}
+
+	return pod
+}
+
+func newSupportBundle(out io.Writer) *supportBundle {
+	gzipWriter := gzip.NewWriter(out)
+	return &supportBundle{
+		gzipWriter: gzipWriter,
+		tarWriter:  tar.NewWriter(gzipWriter),
+		created:    time.Now(),
+	}
+}
+
+func (b *supportBundle) add(name string, data []byte) {
+	err := b.tarWriter.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: b.created,
+	})
+	if err == nil {
+		_, err = b.tarWriter.Write(data)
+	}
+	if err != nil {
+		b.fail("write "+name, err)
+	}
+}
+
+func (b *supportBundle) addJSON(name string, obj interface{}) {
+	out, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		b.fail("marshal "+name, err)
+		return
+	}
+
+	b.add(name, append(out, '\n'))
+}
+
+func (b *supportBundle) addYAML(name string, obj interface{}) {
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		b.fail("marshal "+name, err)
+		return
+	}
+
+	b.add(name, out)
+}
+
+// fail records that a step couldn't be collected
+func (b *supportBundle) fail(step string, err error) {
+	b.errors = append(b.errors, fmt.Sprintf("%s: %v", step, err))
+}
+
+// close writes errors.txt and flushes the tarball
+func (b *supportBundle) close() error {
+	if len(b.errors) > 0 {
+		b.add("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n"))
+	}
+
+	err := b.tarWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	return b.gzipWriter.Close()
+}
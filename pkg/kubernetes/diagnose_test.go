@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// readSupportBundle returns the files of the gzipped tarball by name
+func readSupportBundle(t *testing.T, raw []byte) map[string]string {
+	t.Helper()
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+	}
+
+	return files
+}
+
+func TestDiagnose(t *testing.T) {
+	cluster := newFakeCluster(testNode("node-a", "4", "16Gi", nil))
+	d := cluster.driver(t, &options.Options{
+		PodTimeout: "2m",
+		ComparableOptions: options.ComparableOptions{
+			Resources: "requests.cpu=1",
+		},
+	})
+
+	runOptions := testRunOptions()
+	runOptions.Env = map[string]string{"GIT_TOKEN": "super-secret"}
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, runOptions)
+	assert.NoError(t, err)
+
+	// the dev container restarted once
+	pod := cluster.pod(t, "devpod-test")
+	pod.Spec.NodeName = "node-a"
+	pod.Status.ContainerStatuses[0].RestartCount = 1
+	assert.NoError(t, cluster.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, testNamespace))
+
+	out := &bytes.Buffer{}
+	err = d.Diagnose(context.Background(), testWorkspaceID, out)
+	assert.NoError(t, err)
+
+	files := readSupportBundle(t, out.Bytes())
+	for _, name := range []string{
+		"options.json",
+		"status.json",
+		"pvc.yaml",
+		"pod.yaml",
+		"events.yaml",
+		"logs/devpod.log",
+		"logs/devpod.previous.log",
+		"logs/devpod-init.log",
+		"nodes.yaml",
+		"rendered.yaml",
+	} {
+		assert.Contains(t, files, name)
+	}
+	assert.NotContains(t, files, "errors.txt")
+
+	for name, content := range files {
+		assert.NotContains(t, content, "super-secret", name)
+	}
+	assert.Contains(t, files["pvc.yaml"], `"GIT_TOKEN":"<redacted>"`)
+	assert.Contains(t, files["pod.yaml"], "value: <redacted>")
+	assert.Contains(t, files["options.json"], `"podTimeout": "2m"`)
+	assert.Contains(t, files["options.json"], `"resources": "requests.cpu=1"`)
+	assert.Contains(t, files["status.json"], `"status": "running"`)
+	assert.Contains(t, files["nodes.yaml"], "name: node-a")
+}
+
+func TestDiagnoseMissingWorkspace(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	out := &bytes.Buffer{}
+	err := d.Diagnose(context.Background(), testWorkspaceID, out)
+	assert.NoError(t, err)
+
+	files := readSupportBundle(t, out.Bytes())
+	assert.Contains(t, files, "options.json")
+	assert.Contains(t, files["errors.txt"], "find workspace: workspace 'devpod-test' not found")
+}
+
+func TestDiagnosePullSecret(t *testing.T) {
+	dockerConfig := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("user:password"))
+	err := os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte(`{"auths":{"https://index.docker.io/v1/":{"auth":"`+auth+`"}}}`), 0600)
+	assert.NoError(t, err)
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			KubernetesPullSecretsEnabled: "true",
+		},
+	})
+
+	runOptions := testRunOptions()
+	runOptions.Image = "loftsh/private:latest"
+	err = d.RunDevContainer(context.Background(), testWorkspaceID, runOptions)
+	assert.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	err = d.Diagnose(context.Background(), testWorkspaceID, out)
+	assert.NoError(t, err)
+
+	files := readSupportBundle(t, out.Bytes())
+	assert.NotContains(t, files, "errors.txt")
+	// the secret data is the base64 encoded docker config
+	encodedConfig := base64.StdEncoding.EncodeToString([]byte(`{"auths":`))
+	for name, content := range files {
+		assert.NotContains(t, content, auth, name)
+		assert.NotContains(t, content, encodedConfig, name)
+	}
+	assert.Contains(t, files["rendered.yaml"], "name: devpod-pull-secret-devpod-test")
+	assert.Contains(t, files["rendered.yaml"], ".dockerconfigjson: <redacted>")
+}
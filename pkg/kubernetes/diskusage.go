@@ -0,0 +1,195 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	perrors "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultDiskUsageWarningThreshold is the used percentage of the workspace volume above
+// which the provider warns
+const defaultDiskUsageWarningThreshold = 90
+
+// diskUsageTimeout limits how long measuring the disk usage may take, so a slow exec
+// doesn't hold up start, find or list
+const diskUsageTimeout = 5 * time.Second
+
+// DiskUsage is the used and free space of the workspace volume as reported by df in
+// the dev container
+type DiskUsage struct {
+	Path           string `json:"path"`
+	SizeBytes      int64  `json:"sizeBytes"`
+	UsedBytes      int64  `json:"usedBytes"`
+	AvailableBytes int64  `json:"availableBytes"`
+	UsedPercent    int    `json:"usedPercent"`
+}
+
+// String formats the usage, e.g. 3.2Gi of 9.8Gi used (33%), 6.6Gi free
+func (u *DiskUsage) String() string {
+	return fmt.Sprintf("%s of %s used (%d%%), %s free", formatBytes(u.UsedBytes), formatBytes(u.SizeBytes), u.UsedPercent, formatBytes(u.AvailableBytes))
+}
+
+// diskUsage measures the disk usage of the workspace volume in the dev container of the
+// running pod. The pod must be in the namespace of the driver.
+func (k *KubernetesDriver) diskUsage(ctx context.Context, pod *corev1.Pod) (*DiskUsage, error) {
+	path := workspaceVolumePath(pod)
+	if path == "" {
+		return nil, fmt.Errorf("container '%s' doesn't mount the workspace volume", DevContainerName)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, diskUsageTimeout)
+	defer cancel()
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := k.client.Exec(ctx, pod.Name, DevContainerName, []string{"df", "-Pk", path}, nil, stdout, stderr)
+	if err != nil {
+		return nil, perrors.Wrapf(err, "run df: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return parseDiskUsage(path, stdout.String())
+}
+
+// workspaceVolumePath returns the first path the dev container mounts the workspace
+// volume at. All mounts are sub paths of the same volume, so they report the same usage.
+func workspaceVolumePath(pod *corev1.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		if container.Name != DevContainerName {
+			continue
+		}
+
+		for _, volumeMount := range container.VolumeMounts {
+			if volumeMount.Name == "devpod" {
+				return volumeMount.MountPath
+			}
+		}
+	}
+
+	return ""
+}
+
+// parseDiskUsage parses the POSIX output of df -Pk:
+//
+//	Filesystem     1024-blocks    Used Available Capacity Mounted on
+//	/dev/sdb          10255636 3355443   6900193      33% /workspaces
+func parseDiskUsage(path, out string) (*DiskUsage, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 6 {
+		return nil, fmt.Errorf("unexpected df output: %q", out)
+	}
+
+	values := []int64{}
+	for _, field := range fields[1:4] {
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected df output: %q", out)
+		}
+		values = append(values, value*1024)
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(fields[4], "%"))
+	if err != nil {
+		return nil, fmt.Errorf("unexpected df output: %q", out)
+	}
+
+	return &DiskUsage{
+		Path:           path,
+		SizeBytes:      values[0],
+		UsedBytes:      values[1],
+		AvailableBytes: values[2],
+		UsedPercent:    percent,
+	}, nil
+}
+
+// formatBytes formats the number of bytes with binary units, e.g. 3.2Gi
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ci", float64(bytes)/float64(div), "KMGTP"[exp])
+}
+
+// diskUsageWarningThreshold returns the used percentage above which the provider warns
+// about the workspace volume, 0 disables the warning
+func (k *KubernetesDriver) diskUsageWarningThreshold() int {
+	if k.options.DiskUsageWarningThreshold == "" {
+		return defaultDiskUsageWarningThreshold
+	}
+
+	threshold, err := strconv.Atoi(strings.TrimSuffix(k.options.DiskUsageWarningThreshold, "%"))
+	if err != nil || threshold < 0 || threshold > 100 {
+		k.Log.Warnf("DISK_USAGE_WARNING_THRESHOLD must be a percentage between 0 and 100, using %d%%", defaultDiskUsageWarningThreshold)
+		return defaultDiskUsageWarningThreshold
+	}
+
+	return threshold
+}
+
+// warnDiskUsage warns if the workspace volume is fuller than DISK_USAGE_WARNING_THRESHOLD
+func (k *KubernetesDriver) warnDiskUsage(id string, usage *DiskUsage) {
+	threshold := k.diskUsageWarningThreshold()
+	if threshold == 0 || usage.UsedPercent < threshold {
+		return
+	}
+
+	k.Log.Warnf("The volume of workspace '%s' is %d%% full, only %s free. Delete files in the workspace or raise DISK_SIZE", id, usage.UsedPercent, formatBytes(usage.AvailableBytes))
+}
+
+// reportDiskUsage logs the disk usage of the workspace volume after the workspace
+// started. Errors are only logged, the workspace is usable without the numbers.
+func (k *KubernetesDriver) reportDiskUsage(ctx context.Context, id string) {
+	pod, err := k.getPod(ctx, id)
+	if err != nil || pod == nil {
+		return
+	}
+
+	usage, err := k.diskUsage(ctx, pod)
+	if err != nil {
+		k.Log.Debugf("Error measuring the disk usage of workspace '%s': %v", id, err)
+		return
+	}
+
+	k.Log.Infof("Volume of workspace '%s': %s", id, usage.String())
+	k.warnDiskUsage(id, usage)
+}
+
+// findDiskUsage returns the disk usage of the running workspace or nil if it can't be
+// measured
+func (k *KubernetesDriver) findDiskUsage(ctx context.Context, id string, pod *corev1.Pod) *DiskUsage {
+	usage, err := k.diskUsage(ctx, pod)
+	if err != nil {
+		k.Log.Debugf("Error measuring the disk usage of workspace '%s': %v", id, err)
+		return nil
+	}
+
+	k.warnDiskUsage(id, usage)
+	return usage
+}
+
+// listDiskUsage measures the disk usage of the given running workspaces in parallel
+func (k *KubernetesDriver) listDiskUsage(ctx context.Context, workspaces []WorkspaceSummary, pods map[int]*corev1.Pod) {
+	wg := sync.WaitGroup{}
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(i int, pod *corev1.Pod) {
+			defer wg.Done()
+			workspaces[i].DiskUsage = k.findDiskUsage(ctx, pod.Name, pod)
+		}(i, pod)
+	}
+	wg.Wait()
+}
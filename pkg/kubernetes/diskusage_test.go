@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const dfOutput = `Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/sdb          10255636 3355443   6900193      33% /workspaces
+`
+
+// mountedWorkspace returns the objects of an existing workspace whose dev container
+// mounts the workspace volume
+func mountedWorkspace(t *testing.T) []runtime.Object {
+	objects := existingWorkspace(t, &options.Options{})
+	pod := objects[1].(*corev1.Pod)
+	pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "devpod", MountPath: "/workspaces", SubPath: "devpod/0"}}
+
+	return objects
+}
+
+// df makes the fake print the given df output
+func df(cluster *fakeCluster, out string) {
+	cluster.exec = func(ctx context.Context, command []string, stdout io.Writer) error {
+		if command[0] == "df" {
+			_, err := io.WriteString(stdout, out)
+			return err
+		}
+
+		return nil
+	}
+}
+
+func TestParseDiskUsage(t *testing.T) {
+	usage, err := parseDiskUsage("/workspaces", dfOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, &DiskUsage{
+		Path:           "/workspaces",
+		SizeBytes:      10255636 * 1024,
+		UsedBytes:      3355443 * 1024,
+		AvailableBytes: 6900193 * 1024,
+		UsedPercent:    33,
+	}, usage)
+	assert.Equal(t, "3.2Gi of 9.8Gi used (33%), 6.6Gi free", usage.String())
+
+	_, err = parseDiskUsage("/workspaces", "df: /workspaces: No such file or directory\n")
+	assert.ErrorContains(t, err, "unexpected df output")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512B", formatBytes(512))
+	assert.Equal(t, "1.5Ki", formatBytes(1536))
+	assert.Equal(t, "10.0Gi", formatBytes(10*1024*1024*1024))
+}
+
+func TestDiskUsageWarningThreshold(t *testing.T) {
+	d := newFakeCluster().driver(t, &options.Options{})
+	assert.Equal(t, 90, d.diskUsageWarningThreshold())
+
+	for value, expected := range map[string]int{"80": 80, "75%": 75, "0": 0, "full": 90, "120": 90} {
+		d.options.DiskUsageWarningThreshold = value
+		assert.Equal(t, expected, d.diskUsageWarningThreshold(), value)
+	}
+}
+
+func TestFindWorkspaceDiskUsage(t *testing.T) {
+	cluster := newFakeCluster(mountedWorkspace(t)...)
+	df(cluster, dfOutput)
+	d := cluster.driver(t, &options.Options{})
+
+	details, err := d.FindWorkspace(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"df", "-Pk", "/workspaces"}}, cluster.execs)
+	if assert.NotNil(t, details.WorkspaceStatus.DiskUsage) {
+		assert.Equal(t, 33, details.WorkspaceStatus.DiskUsage.UsedPercent)
+	}
+
+	// the workspace is found even if df isn't available
+	cluster.execs = nil
+	df(cluster, "sh: df: not found\n")
+	details, err = d.FindWorkspace(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRunning, details.WorkspaceStatus.Status)
+	assert.Nil(t, details.WorkspaceStatus.DiskUsage)
+}
+
+func TestListWorkspacesDiskUsage(t *testing.T) {
+	cluster := newFakeCluster(mountedWorkspace(t)...)
+	df(cluster, dfOutput)
+	d := cluster.driver(t, &options.Options{})
+
+	workspaces, err := d.ListWorkspaces(context.Background(), false)
+	assert.NoError(t, err)
+	if assert.Len(t, workspaces, 1) && assert.NotNil(t, workspaces[0].DiskUsage) {
+		assert.Equal(t, int64(6900193*1024), workspaces[0].DiskUsage.AvailableBytes)
+	}
+}
+
+func TestStartDevContainerReportsDiskUsage(t *testing.T) {
+	cluster := newFakeCluster(mountedWorkspace(t)...)
+	df(cluster, dfOutput)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Contains(t, cluster.execs, []string{"df", "-Pk", "/workspaces"})
+}
@@ -26,7 +26,7 @@ type DockerConfigEntry struct {
 	Email string `json:"email"`
 }
 
-func PreparePullSecretData(registryURL, authToken, email string) (string, error) {
+func PreparePullSecretData(registryURL, authToken, email string) ([]byte, error) {
 	dockerConfig := &DockerConfigJSON{
 		Auths: DockerConfig{
 			registryURL: newDockerConfigEntry(authToken, email),
@@ -35,7 +35,7 @@ func PreparePullSecretData(registryURL, authToken, email string) (string, error)
 
 	pullSecretData, err := toPullSecretData(dockerConfig)
 	if err != nil {
-		return "", perrors.Wrap(err, "new pull secret")
+		return nil, perrors.Wrap(err, "new pull secret")
 	}
 
 	return pullSecretData, nil
@@ -48,13 +48,13 @@ func newDockerConfigEntry(authToken, email string) DockerConfigEntry {
 	}
 }
 
-func toPullSecretData(dockerConfig *DockerConfigJSON) (string, error) {
+func toPullSecretData(dockerConfig *DockerConfigJSON) ([]byte, error) {
 	data, err := json.Marshal(dockerConfig)
 	if err != nil {
-		return "", perrors.Wrap(err, "marshal docker config")
+		return nil, perrors.Wrap(err, "marshal docker config")
 	}
 
-	return k8sv1.DockerConfigJsonKey + "=" + string(data), nil
+	return data, nil
 }
 
 func DecodeAuthTokenFromPullSecret(secret k8sv1.Secret, host string) (string, error) {
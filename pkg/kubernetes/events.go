@@ -0,0 +1,271 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/throttledlogger"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// maxReportedEvents is the number of events added to startup errors
+const maxReportedEvents = 5
+
+// eventHint is a human-friendly explanation for events and errors that contain one of
+// the substrings
+type eventHint struct {
+	substrings []string
+	hint       string
+}
+
+// eventHints are checked in order, the first match wins
+var eventHints = []eventHint{
+	{
+		substrings: []string{"exceeded quota"},
+		hint:       "A ResourceQuota in the namespace is exhausted. Delete unused workspaces, lower RESOURCES or ask your cluster admin to raise the quota.",
+	},
+	{
+		substrings: []string{"admission webhook", "denied the request"},
+		hint:       "An admission webhook rejected the pod. Check the policies of your cluster (e.g. Kyverno or Gatekeeper) and adjust POD_MANIFEST_TEMPLATE accordingly.",
+	},
+	{
+		substrings: []string{"unbound immediate PersistentVolumeClaims", "persistentvolumeclaim \""},
+		hint:       "The workspace volume isn't bound. Check that STORAGE_CLASS exists and has a working provisioner.",
+	},
+	{
+		substrings: []string{"Insufficient cpu", "Insufficient memory", "Insufficient ephemeral-storage"},
+		hint:       "No node has enough free resources for the workspace. Lower RESOURCES or add nodes to the cluster.",
+	},
+	{
+		substrings: []string{"didn't match Pod's node affinity/selector", "node(s) didn't match node selector"},
+		hint:       "No node matches the node selector or affinity. Check NODE_SELECTOR and the affinity in POD_MANIFEST_TEMPLATE.",
+	},
+	{
+		substrings: []string{"untolerated taint", "had taint"},
+		hint:       "The nodes are tainted. Add matching tolerations to POD_MANIFEST_TEMPLATE.",
+	},
+	{
+		substrings: []string{"volume node affinity conflict"},
+		hint:       "The workspace volume is bound to a zone without a schedulable node. Add nodes in that zone or recreate the workspace.",
+	},
+	{
+		substrings: []string{"Multi-Attach error"},
+		hint:       "The workspace volume is still attached to another node. Wait for the previous pod to terminate or use PVC_ACCESS_MODE=RWX.",
+	},
+	{
+		substrings: []string{"ProvisioningFailed", "failed to provision volume"},
+		hint:       "The storage class couldn't provision the workspace volume. Check STORAGE_CLASS and DISK_SIZE.",
+	},
+	{
+		substrings: []string{"VolumeResizeFailed", "FileSystemResizeFailed"},
+		hint:       "The workspace volume couldn't be expanded. Check that the CSI driver of the storage class supports volume expansion.",
+	},
+	{
+		substrings: []string{"FailedAttachVolume", "FailedMount", "MountVolume", "AttachVolume"},
+		hint:       "The workspace volume couldn't be attached or mounted. Check the CSI driver of the storage class on the node.",
+	},
+	{
+		substrings: []string{"pull access denied", "401 Unauthorized", "authentication required", "403 Forbidden"},
+		hint:       "The registry rejected the image pull. Check the image name and your registry credentials, or set KUBERNETES_PULL_SECRETS_ENABLED=true.",
+	},
+	{
+		substrings: []string{"manifest unknown", "failed to resolve reference"},
+		hint:       "The image doesn't exist. Check the image name and tag.",
+	},
+}
+
+// hint returns the hint for the given event reason and message or an empty string
+func hint(texts ...string) string {
+	for _, eventHint := range eventHints {
+		for _, substring := range eventHint.substrings {
+			for _, text := range texts {
+				if strings.Contains(text, substring) {
+					return eventHint.hint
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// withHint appends the hint matching the error to it, unless it has a hint already
+func withHint(err error) error {
+	if err == nil || strings.Contains(err.Error(), "\nHint: ") {
+		return err
+	}
+
+	if h := hint(err.Error()); h != "" {
+		return fmt.Errorf("%w\nHint: %s", err, h)
+	}
+
+	return err
+}
+
+// explainPodError adds the warning events of the pod and its pvc to the error of a pod
+// that didn't come up and, if it couldn't be scheduled, why it doesn't fit on any node
+func (k *KubernetesDriver) explainPodError(ctx context.Context, id string, err error) error {
+	// the wait might have timed out, but the caller is still interested in the reason
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	pod, getErr := k.getPod(ctx, id)
+	if getErr != nil {
+		k.Log.Debugf("Error getting pod '%s': %v", id, getErr)
+	}
+	events, listErr := k.client.ListEvents(ctx, id)
+	if listErr != nil {
+		k.Log.Debugf("Error listing events of pod '%s': %v", id, listErr)
+	}
+
+	lines := []string{}
+	warnings := warningEvents(events, pod)
+	if len(warnings) > maxReportedEvents {
+		warnings = warnings[len(warnings)-maxReportedEvents:]
+	}
+	if len(warnings) > 0 {
+		lines = append(lines, "Events:")
+		for i := range warnings {
+			lines = append(lines, formatEvent(&warnings[i], time.Now()))
+		}
+	}
+	if podUnschedulable(pod) {
+		if explanation := k.explainScheduling(ctx, pod); explanation != "" {
+			lines = append(lines, explanation)
+		}
+	}
+	if len(lines) == 0 {
+		return withHint(err)
+	}
+
+	return fmt.Errorf("%w\n%s", err, strings.Join(lines, "\n"))
+}
+
+// warningEvents returns the warning events of the pod and its pvc that happened since
+// the pod was created, oldest first. Repeated events are only returned once.
+func warningEvents(events []corev1.Event, pod *corev1.Pod) []corev1.Event {
+	var since time.Time
+	if pod != nil {
+		// the pvc is created right before the pod
+		since = pod.CreationTimestamp.Add(-time.Minute)
+	}
+
+	latest := map[string]corev1.Event{}
+	for _, event := range events {
+		if event.Type != corev1.EventTypeWarning {
+			continue
+		}
+
+		switch event.InvolvedObject.Kind {
+		case "Pod":
+			if pod != nil && event.InvolvedObject.UID != "" && pod.UID != "" && event.InvolvedObject.UID != pod.UID {
+				continue
+			}
+		case "PersistentVolumeClaim":
+		default:
+			continue
+		}
+		if eventTime(&event).Before(since) {
+			continue
+		}
+
+		key := eventKey(&event)
+		if existing, ok := latest[key]; !ok || eventTime(&existing).Before(*eventTime(&event)) {
+			latest[key] = event
+		}
+	}
+
+	warnings := []corev1.Event{}
+	for _, event := range latest {
+		warnings = append(warnings, event)
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		return eventTime(&warnings[i]).Before(*eventTime(&warnings[j]))
+	})
+
+	return warnings
+}
+
+// eventKey identifies repetitions of the same event
+func eventKey(event *corev1.Event) string {
+	return event.InvolvedObject.Kind + "/" + event.Reason + "/" + event.Message
+}
+
+// formatEvent prints the event with its hint
+func formatEvent(event *corev1.Event, now time.Time) string {
+	count := ""
+	if event.Count > 1 {
+		count = fmt.Sprintf(", %dx", event.Count)
+	}
+
+	line := fmt.Sprintf(
+		"  %s %s (%s%s, %s ago): %s",
+		event.Type,
+		event.Reason,
+		strings.ToLower(event.InvolvedObject.Kind),
+		count,
+		duration.HumanDuration(now.Sub(*eventTime(event))),
+		strings.TrimSpace(event.Message),
+	)
+	if h := hint(event.Reason, event.Message); h != "" {
+		line += "\n    Hint: " + h
+	}
+
+	return line
+}
+
+// eventReporter logs new warning events of a starting pod while the driver waits for it.
+// If the pod can't be scheduled, it also logs why once.
+type eventReporter struct {
+	driver *KubernetesDriver
+	id     string
+
+	timer     *throttledlogger.Timer
+	reported  map[string]bool
+	explained bool
+}
+
+func newEventReporter(driver *KubernetesDriver, id string) *eventReporter {
+	return &eventReporter{
+		driver:   driver,
+		id:       id,
+		timer:    throttledlogger.NewTimer(time.Second * 5),
+		reported: map[string]bool{},
+	}
+}
+
+// report logs the warning events that weren't reported yet, at most every few seconds
+func (r *eventReporter) report(ctx context.Context, pod *corev1.Pod) {
+	now := time.Now()
+	if !r.timer.IntervalPassed(now) {
+		return
+	}
+	r.timer.Tick(now)
+
+	events, err := r.driver.client.ListEvents(ctx, r.id)
+	if err != nil {
+		r.driver.Log.Debugf("Error listing events of pod '%s': %v", r.id, err)
+	}
+
+	warnings := warningEvents(events, pod)
+	for i := range warnings {
+		key := eventKey(&warnings[i])
+		if r.reported[key] {
+			continue
+		}
+
+		r.reported[key] = true
+		r.driver.Log.Warnf("Pod '%s' is not up yet:\n%s", r.id, formatEvent(&warnings[i], now))
+	}
+
+	if !r.explained && podUnschedulable(pod) {
+		r.explained = true
+		if explanation := r.driver.explainScheduling(ctx, pod); explanation != "" {
+			r.driver.Log.Warnf("Pod '%s' can't be scheduled. %s", r.id, explanation)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func warningEvent(kind, uid, reason, message string, lastSeen time.Time) corev1.Event {
+	return corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devpod-test." + reason + "." + uid,
+			Namespace: testNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      kind,
+			Name:      "devpod-test",
+			Namespace: testNamespace,
+			UID:       types.UID(uid),
+		},
+		Type:          corev1.EventTypeWarning,
+		Reason:        reason,
+		Message:       message,
+		Count:         1,
+		LastTimestamp: metav1.NewTime(lastSeen),
+	}
+}
+
+func TestWarningEvents(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		UID:               "uid-devpod-test",
+		CreationTimestamp: metav1.NewTime(now.Add(-5 * time.Minute)),
+	}}
+
+	normal := warningEvent("Pod", "uid-devpod-test", "Scheduled", "assigned", now)
+	normal.Type = corev1.EventTypeNormal
+	events := []corev1.Event{
+		normal,
+		warningEvent("Pod", "uid-devpod-test", "FailedScheduling", "0/3 nodes are available", now.Add(-2*time.Minute)),
+		warningEvent("Pod", "uid-devpod-test", "FailedScheduling", "0/3 nodes are available", now.Add(-time.Minute)),
+		warningEvent("PersistentVolumeClaim", "uid-pvc", "ProvisioningFailed", "storageclass not found", now.Add(-3*time.Minute)),
+		// previous pod of the workspace
+		warningEvent("Pod", "uid-old", "FailedMount", "timed out", now.Add(-time.Minute)),
+		// before the pod was created
+		warningEvent("PersistentVolumeClaim", "uid-pvc", "VolumeResizeFailed", "resize", now.Add(-time.Hour)),
+		warningEvent("Node", "uid-node", "NodeNotReady", "node is not ready", now),
+	}
+
+	warnings := warningEvents(events, pod)
+	assert.Len(t, warnings, 2)
+	assert.Equal(t, "ProvisioningFailed", warnings[0].Reason)
+	assert.Equal(t, "FailedScheduling", warnings[1].Reason)
+	assert.Equal(t, now.Add(-time.Minute), warnings[1].LastTimestamp.Time)
+}
+
+func TestFormatEvent(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	event := warningEvent("Pod", "uid-devpod-test", "FailedScheduling", "0/3 nodes are available: 3 Insufficient memory.", now.Add(-20*time.Second))
+	event.Count = 3
+
+	assert.Equal(t,
+		"  Warning FailedScheduling (pod, 3x, 20s ago): 0/3 nodes are available: 3 Insufficient memory.\n"+
+			"    Hint: No node has enough free resources for the workspace. Lower RESOURCES or add nodes to the cluster.",
+		formatEvent(&event, now),
+	)
+
+	event = warningEvent("Pod", "uid-devpod-test", "Failed", "container failed", now.Add(-time.Minute))
+	assert.Equal(t, "  Warning Failed (pod, 60s ago): container failed", formatEvent(&event, now))
+}
+
+func TestHint(t *testing.T) {
+	testCases := []struct {
+		message  string
+		expected string
+	}{
+		{
+			message:  "0/3 nodes are available: 3 node(s) had untolerated taint {gpu: true}.",
+			expected: "The nodes are tainted",
+		},
+		{
+			message:  "0/3 nodes are available: pod has unbound immediate PersistentVolumeClaims.",
+			expected: "The workspace volume isn't bound",
+		},
+		{
+			message:  "Multi-Attach error for volume \"pvc-123\" Volume is already exclusively attached to one node",
+			expected: "still attached to another node",
+		},
+		{
+			message:  "MountVolume.SetUp failed for volume \"pvc-123\" : rpc error",
+			expected: "couldn't be attached or mounted",
+		},
+		{
+			message:  "admission webhook \"validate.kyverno.svc\" denied the request: privileged containers are not allowed",
+			expected: "An admission webhook rejected the pod",
+		},
+		{
+			message:  "pods \"devpod-test\" is forbidden: exceeded quota: compute, requested: memory=4Gi",
+			expected: "A ResourceQuota in the namespace is exhausted",
+		},
+		{
+			message: "Back-off pulling image \"ubuntu\"",
+		},
+	}
+
+	for _, testCase := range testCases {
+		h := hint(testCase.message)
+		if testCase.expected == "" {
+			assert.Empty(t, h, testCase.message)
+		} else {
+			assert.Contains(t, h, testCase.expected, testCase.message)
+		}
+	}
+}
+
+func TestRunDevContainerTimeoutIncludesEvents(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.scriptPod("devpod-test", podPending)
+	event := warningEvent("Pod", "uid-devpod-test", "FailedScheduling", "0/3 nodes are available: 3 Insufficient cpu.", time.Now())
+	_, err := cluster.CoreV1().Events(testNamespace).Create(context.Background(), &event, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	d := cluster.driver(t, &options.Options{PodTimeout: "1s"})
+
+	err = d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.ErrorContains(t, err, "timed out waiting for pod 'devpod-test' to come up")
+	assert.ErrorContains(t, err, "Warning FailedScheduling (pod, ")
+	assert.ErrorContains(t, err, "Hint: No node has enough free resources")
+}
+
+func TestRunDevContainerCreatePodErrorHint(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, kerrors.NewForbidden(corev1.Resource("pods"), "devpod-test", errors.New("exceeded quota: compute, requested: requests.cpu=1"))
+	})
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.True(t, kerrors.IsForbidden(err))
+	assert.ErrorContains(t, err, "Hint: A ResourceQuota in the namespace is exhausted")
+}
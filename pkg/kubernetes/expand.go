@@ -0,0 +1,233 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/throttledlogger"
+	perrors "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// resizePollInterval is how often the driver checks whether a volume was resized
+const resizePollInterval = time.Second
+
+// expandPersistentVolumeClaim raises the storage request of the existing pvc to
+// DISK_SIZE if it was increased since the pvc was created, and waits until the volume
+// was resized. The kubelet can only resize the file system once a pod mounts the volume,
+// which waitFileSystemResized waits for. Volumes are never shrunk.
+func (k *KubernetesDriver) expandPersistentVolumeClaim(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error) {
+	if k.options.DiskSize == "" {
+		return pvc, nil
+	}
+
+	size, err := resource.ParseQuantity(k.options.DiskSize)
+	if err != nil {
+		return nil, perrors.Wrapf(err, "parse persistent volume size '%s'", k.options.DiskSize)
+	}
+
+	current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if size.Cmp(current) < 0 {
+		k.Log.Debugf("DISK_SIZE %s is smaller than the volume of workspace '%s' (%s), volumes can't be shrunk", size.String(), pvc.Name, current.String())
+		return pvc, nil
+	} else if size.Cmp(current) == 0 {
+		return pvc, nil
+	} else if pvc.Status.Phase != corev1.ClaimBound {
+		k.Log.Infof("Persistent volume claim '%s' isn't bound yet, it's expanded to %s on the next start", pvc.Name, size.String())
+		return pvc, nil
+	}
+
+	err = k.checkVolumeExpansion(ctx, pvc, current, size)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := k.timing.track(phaseVolume)
+	defer stop()
+
+	k.Log.Infof("Expand persistent volume claim '%s' from %s to %s...", pvc.Name, current.String(), size.String())
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{
+					string(corev1.ResourceStorage): size.String(),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = k.client.PatchPersistentVolumeClaim(ctx, pvc.Name, types.MergePatchType, patch)
+	if kerrors.IsForbidden(err) || kerrors.IsInvalid(err) {
+		// e.g. the admission plugin rejects pvcs of storage classes without expansion
+		return nil, expansionNotSupported(pvc.Name, current, size, err.Error())
+	} else if err != nil {
+		return nil, perrors.Wrap(err, "expand pvc")
+	}
+
+	return k.waitVolumeResized(ctx, pvc.Name, size, false)
+}
+
+// checkVolumeExpansion returns an error if the storage class of the pvc doesn't allow
+// volume expansion. If the storage class can't be read, the api server decides.
+func (k *KubernetesDriver) checkVolumeExpansion(ctx context.Context, pvc *corev1.PersistentVolumeClaim, current, size resource.Quantity) error {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return expansionNotSupported(pvc.Name, current, size, "the persistent volume claim has no storage class")
+	}
+
+	storageClassName := *pvc.Spec.StorageClassName
+	storageClass, err := k.client.GetStorageClass(ctx, storageClassName)
+	if kerrors.IsForbidden(err) {
+		k.Log.Debugf("Error getting storage class '%s': %v", storageClassName, err)
+		return nil
+	} else if kerrors.IsNotFound(err) {
+		return expansionNotSupported(pvc.Name, current, size, fmt.Sprintf("storage class '%s' not found", storageClassName))
+	} else if err != nil {
+		return perrors.Wrap(err, "get storage class")
+	}
+
+	if storageClass.AllowVolumeExpansion == nil || !*storageClass.AllowVolumeExpansion {
+		return expansionNotSupported(pvc.Name, current, size, fmt.Sprintf("storage class '%s' doesn't allow volume expansion", storageClassName))
+	}
+
+	return nil
+}
+
+func expansionNotSupported(id string, current, size resource.Quantity, reason string) error {
+	return fmt.Errorf("can't expand the volume of workspace '%s' from %s to DISK_SIZE %s: %s\nHint: Set allowVolumeExpansion: true on the storage class if its CSI driver supports expansion, or set DISK_SIZE back to %s.", id, current.String(), size.String(), reason, current.String())
+}
+
+// waitFileSystemResized waits until the kubelet resized the file system of the volume
+// after the pod mounted it, if a resize is pending
+func (k *KubernetesDriver) waitFileSystemResized(ctx context.Context, pvc *corev1.PersistentVolumeClaim) error {
+	if pvcCondition(pvc, corev1.PersistentVolumeClaimFileSystemResizePending) == nil {
+		return nil
+	}
+
+	stop := k.timing.track(phaseVolume)
+	defer stop()
+
+	_, err := k.waitVolumeResized(ctx, pvc.Name, pvc.Spec.Resources.Requests[corev1.ResourceStorage], true)
+	return err
+}
+
+// waitVolumeResized waits until the volume has the given capacity, at most POD_TIMEOUT,
+// and reports the progress. Unless mounted is set, it returns as soon as only the
+// resize of the file system is pending, which the kubelet can't do before the volume
+// is mounted.
+func (k *KubernetesDriver) waitVolumeResized(ctx context.Context, name string, size resource.Quantity, mounted bool) (*corev1.PersistentVolumeClaim, error) {
+	timeoutDuration, err := time.ParseDuration(k.options.PodTimeout)
+	if err != nil {
+		return nil, perrors.Wrap(err, "parse pod timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeoutDuration)
+	defer cancel()
+
+	throttledLogger := throttledlogger.NewThrottledLogger(k.Log, time.Second*5)
+	var pvc *corev1.PersistentVolumeClaim
+	err = wait.PollUntilContextCancel(ctx, resizePollInterval, true, func(ctx context.Context) (bool, error) {
+		pvc, err = k.client.GetPersistentVolumeClaim(ctx, name)
+		if err != nil {
+			return false, perrors.Wrap(err, "get pvc")
+		}
+
+		capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+		pending := pvcCondition(pvc, corev1.PersistentVolumeClaimFileSystemResizePending)
+		if capacity.Cmp(size) >= 0 && pending == nil {
+			k.Log.Infof("Volume of workspace '%s' resized to %s", name, capacity.String())
+			return true, nil
+		} else if pending != nil && !mounted {
+			k.Log.Infof("Volume of workspace '%s' resized, its file system is resized once the pod mounts it", name)
+			return true, nil
+		}
+
+		switch pvc.Status.AllocatedResourceStatuses[corev1.ResourceStorage] {
+		case corev1.PersistentVolumeClaimControllerResizeFailed, corev1.PersistentVolumeClaimNodeResizeFailed:
+			return false, fmt.Errorf("resizing the volume of workspace '%s' failed", name)
+		}
+
+		throttledLogger.Infof("Waiting for the volume of workspace '%s' to be resized to %s: %s", name, size.String(), resizeProgress(pvc))
+		return false, nil
+	})
+	if err != nil {
+		if perrors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out waiting for the volume of workspace '%s' to be resized to %s (%s)", name, size.String(), resizeProgress(pvc))
+		}
+		return nil, k.explainResizeError(ctx, name, err)
+	}
+
+	return pvc, nil
+}
+
+// resizeProgress describes which step of the resize the pvc is in
+func resizeProgress(pvc *corev1.PersistentVolumeClaim) string {
+	if pvc == nil {
+		return "unknown"
+	}
+
+	steps := []string{}
+	for _, conditionType := range []corev1.PersistentVolumeClaimConditionType{corev1.PersistentVolumeClaimResizing, corev1.PersistentVolumeClaimFileSystemResizePending} {
+		condition := pvcCondition(pvc, conditionType)
+		if condition == nil {
+			continue
+		}
+
+		step := string(condition.Type)
+		if condition.Message != "" {
+			step += ": " + condition.Message
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return "waiting for the resizer to pick up the request"
+	}
+
+	return strings.Join(steps, ", ")
+}
+
+// explainResizeError adds the warning events of the pvc to the error
+func (k *KubernetesDriver) explainResizeError(ctx context.Context, name string, err error) error {
+	// the wait might have timed out, but the caller is still interested in the reason
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	events, listErr := k.client.ListEvents(ctx, name)
+	if listErr != nil {
+		k.Log.Debugf("Error listing events of pvc '%s': %v", name, listErr)
+	}
+
+	lines := []string{}
+	for _, event := range warningEvents(events, nil) {
+		if event.InvolvedObject.Kind == "PersistentVolumeClaim" {
+			lines = append(lines, formatEvent(&event, time.Now()))
+		}
+	}
+	if len(lines) > maxReportedEvents {
+		lines = lines[len(lines)-maxReportedEvents:]
+	}
+	if len(lines) == 0 {
+		return withHint(err)
+	}
+
+	return fmt.Errorf("%w\nEvents:\n%s", err, strings.Join(lines, "\n"))
+}
+
+func pvcCondition(pvc *corev1.PersistentVolumeClaim, conditionType corev1.PersistentVolumeClaimConditionType) *corev1.PersistentVolumeClaimCondition {
+	for i := range pvc.Status.Conditions {
+		if pvc.Status.Conditions[i].Type == conditionType {
+			return &pvc.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
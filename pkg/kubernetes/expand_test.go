@@ -0,0 +1,144 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func diskSizeOptions(size string) *options.Options {
+	return &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			StorageClass: "standard",
+			DiskSize:     size,
+		},
+	}
+}
+
+// boundWorkspace returns the objects of an existing workspace with a bound pvc of the
+// given storage class
+func boundWorkspace(t *testing.T, allowVolumeExpansion bool) []runtime.Object {
+	objects := existingWorkspace(t, diskSizeOptions("10Gi"))
+	pvc := objects[0].(*corev1.PersistentVolumeClaim)
+	pvc.Status.Phase = corev1.ClaimBound
+	pvc.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+
+	storageClass := &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: "standard"},
+		AllowVolumeExpansion: &allowVolumeExpansion,
+	}
+
+	return append(objects, storageClass)
+}
+
+// resizeVolumes makes the fake resize pvcs whose request is larger than their capacity
+// when they are read. With fileSystemResize the file system resize stays pending until
+// the pod of the pvc is running, like the kubelet only resizes mounted volumes.
+func resizeVolumes(cluster *fakeCluster, fileSystemResize bool) {
+	pvcResource := corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims")
+	cluster.PrependReactor("get", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		name := action.(k8stesting.GetAction).GetName()
+		obj, err := cluster.Tracker().Get(pvcResource, testNamespace, name)
+		if err != nil {
+			return false, nil, nil
+		}
+
+		pvc := obj.(*corev1.PersistentVolumeClaim)
+		request := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+		if request.Cmp(capacity) > 0 {
+			pvc.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: request}
+			if fileSystemResize {
+				pvc.Status.Conditions = []corev1.PersistentVolumeClaimCondition{
+					{Type: corev1.PersistentVolumeClaimFileSystemResizePending, Status: corev1.ConditionTrue},
+				}
+			}
+		} else if pvcCondition(pvc, corev1.PersistentVolumeClaimFileSystemResizePending) != nil {
+			pod, err := cluster.Tracker().Get(corev1.SchemeGroupVersion.WithResource("pods"), testNamespace, name)
+			if err != nil || pod.(*corev1.Pod).Status.Phase != corev1.PodRunning {
+				return false, nil, nil
+			}
+			pvc.Status.Conditions = nil
+		} else {
+			return false, nil, nil
+		}
+
+		_ = cluster.Tracker().Update(pvcResource, pvc, testNamespace)
+		return false, nil, nil
+	})
+}
+
+func pvcPatched(cluster *fakeCluster) bool {
+	for _, action := range cluster.Actions() {
+		if action.GetVerb() == "patch" && action.GetResource().Resource == "persistentvolumeclaims" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestStartDevContainerExpandsVolume(t *testing.T) {
+	cluster := newFakeCluster(boundWorkspace(t, true)...)
+	resizeVolumes(cluster, false)
+	d := cluster.driver(t, diskSizeOptions("20Gi"))
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+
+	pvc := cluster.persistentVolumeClaim(t, "devpod-test")
+	assert.Equal(t, "20Gi", pvc.Spec.Resources.Requests.Storage().String())
+	assert.Equal(t, "20Gi", pvc.Status.Capacity.Storage().String())
+}
+
+func TestStartDevContainerWaitsForFileSystemResize(t *testing.T) {
+	cluster := newFakeCluster(boundWorkspace(t, true)...)
+	resizeVolumes(cluster, true)
+	d := cluster.driver(t, diskSizeOptions("20Gi"))
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+
+	// the file system was resized once the new pod was running
+	pvc := cluster.persistentVolumeClaim(t, "devpod-test")
+	assert.Nil(t, pvcCondition(pvc, corev1.PersistentVolumeClaimFileSystemResizePending))
+	assert.Equal(t, corev1.PodRunning, cluster.pod(t, "devpod-test").Status.Phase)
+}
+
+func TestStartDevContainerExpansionNotAllowed(t *testing.T) {
+	cluster := newFakeCluster(boundWorkspace(t, false)...)
+	d := cluster.driver(t, diskSizeOptions("20Gi"))
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.EqualError(t, err, "can't expand the volume of workspace 'devpod-test' from 10Gi to DISK_SIZE 20Gi: storage class 'standard' doesn't allow volume expansion\n"+
+		"Hint: Set allowVolumeExpansion: true on the storage class if its CSI driver supports expansion, or set DISK_SIZE back to 10Gi.")
+	assert.False(t, pvcPatched(cluster))
+	assert.Empty(t, cluster.deleted())
+}
+
+func TestStartDevContainerDoesntShrinkVolume(t *testing.T) {
+	cluster := newFakeCluster(boundWorkspace(t, true)...)
+	d := cluster.driver(t, diskSizeOptions("5Gi"))
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, "10Gi", cluster.persistentVolumeClaim(t, "devpod-test").Spec.Resources.Requests.Storage().String())
+}
+
+func TestWaitVolumeResizedTimeout(t *testing.T) {
+	cluster := newFakeCluster(boundWorkspace(t, true)...)
+	opts := diskSizeOptions("20Gi")
+	opts.PodTimeout = "2s"
+	d := cluster.driver(t, opts)
+
+	_, err := d.waitVolumeResized(context.Background(), "devpod-test", resource.MustParse("20Gi"), false)
+	assert.EqualError(t, err, "timed out waiting for the volume of workspace 'devpod-test' to be resized to 20Gi (waiting for the resizer to pick up the request)")
+}
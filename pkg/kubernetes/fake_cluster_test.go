@@ -0,0 +1,307 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/log"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "devpod-test"
+
+// podTransition changes the status of a pod, e.g. to simulate the kubelet starting it
+type podTransition func(pod *corev1.Pod)
+
+// fakeCluster is an in-memory Kubernetes API for driver tests. Pods are moved through
+// their scripted status transitions as soon as the driver starts watching them.
+type fakeCluster struct {
+	*fake.Clientset
+
+	transitions map[string][]podTransition
+
+	// dryRuns are the names of all pods created with server-side dry-run
+	dryRuns []string
+	// dryRunError is returned for server-side dry-run requests if set
+	dryRunError error
+
+	// execs are the commands run in pods in order
+	execs [][]string
+	// exec handles the commands run in pods if set
+	exec func(ctx context.Context, command []string, stdout io.Writer) error
+
+	// logs are the log requests in order, every container logs a line with its name
+	logs []*corev1.PodLogOptions
+
+	// dynamic serves the volume snapshots, which become ready right away unless
+	// snapshotError is set
+	dynamic       *dynamicfake.FakeDynamicClient
+	snapshotError string
+}
+
+// fakeClient handles the server-side dry-run requests the fake clientset doesn't
+// know about and passes everything else to the fake clientset
+type fakeClient struct {
+	*nativeClient
+
+	cluster *fakeCluster
+}
+
+func (c *fakeClient) CreatePod(ctx context.Context, pod *corev1.Pod, opts metav1.CreateOptions) (*corev1.Pod, error) {
+	if len(opts.DryRun) == 0 {
+		return c.nativeClient.CreatePod(ctx, pod, opts)
+	}
+
+	c.cluster.dryRuns = append(c.cluster.dryRuns, pod.Name)
+	if c.cluster.dryRunError != nil {
+		return nil, c.cluster.dryRunError
+	}
+
+	_, err := c.cluster.Tracker().Get(corev1.SchemeGroupVersion.WithResource("pods"), testNamespace, pod.Name)
+	if err == nil {
+		return nil, kerrors.NewAlreadyExists(corev1.Resource("pods"), pod.Name)
+	}
+
+	return pod, nil
+}
+
+func (c *fakeClient) Exec(ctx context.Context, podName, container string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	c.cluster.execs = append(c.cluster.execs, command)
+	if c.cluster.exec == nil {
+		return nil
+	}
+
+	return c.cluster.exec(ctx, command, stdout)
+}
+
+func (c *fakeClient) Logs(ctx context.Context, podName string, opts *corev1.PodLogOptions, stdout io.Writer) error {
+	c.cluster.logs = append(c.cluster.logs, opts)
+	_, err := io.WriteString(stdout, "logs of "+opts.Container+"\n")
+	return err
+}
+
+func newFakeCluster(objects ...runtime.Object) *fakeCluster {
+	c := &fakeCluster{
+		Clientset:   fake.NewSimpleClientset(objects...),
+		transitions: map[string][]podTransition{},
+	}
+	c.PrependWatchReactor("pods", c.watchPod)
+	c.PrependReactor("create", "*", setUID)
+
+	c.dynamic = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		volumeSnapshotResource: "VolumeSnapshotList",
+	})
+	c.dynamic.PrependReactor("create", "volumesnapshots", c.snapshotCreated)
+
+	return c
+}
+
+// snapshotCreated sets the status the snapshot controller would set on new snapshots
+func (c *fakeCluster) snapshotCreated(action k8stesting.Action) (bool, runtime.Object, error) {
+	obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+	obj.SetCreationTimestamp(metav1.Now())
+	if c.snapshotError != "" {
+		_ = unstructured.SetNestedField(obj.Object, c.snapshotError, "status", "error", "message")
+		return false, nil, nil
+	}
+
+	_ = unstructured.SetNestedField(obj.Object, true, "status", "readyToUse")
+	_ = unstructured.SetNestedField(obj.Object, "10Gi", "status", "restoreSize")
+	return false, nil, nil
+}
+
+// scriptPod sets the status transitions of the given pod. Pods without a script
+// become running and ready.
+func (c *fakeCluster) scriptPod(name string, transitions ...podTransition) {
+	c.transitions[name] = transitions
+}
+
+func (c *fakeCluster) driver(t *testing.T, opts *options.Options) *KubernetesDriver {
+	t.Helper()
+
+	if opts.PodTimeout == "" {
+		opts.PodTimeout = "10s"
+	}
+	opts.KubernetesNamespace = testNamespace
+
+	return &KubernetesDriver{
+		client: &fakeClient{
+			nativeClient: &nativeClient{
+				clientset:     c.Clientset,
+				namespace:     testNamespace,
+				dynamicClient: c.dynamic,
+			},
+			cluster: c,
+		},
+		namespace: testNamespace,
+		options:   opts,
+		Log:       log.Discard,
+	}
+}
+
+func (c *fakeCluster) watchPod(action k8stesting.Action) (bool, watch.Interface, error) {
+	name, _ := action.(k8stesting.WatchAction).GetWatchRestrictions().Fields.RequiresExactMatch("metadata.name")
+	watcher := watch.NewRaceFreeFake()
+
+	obj, err := c.Tracker().Get(corev1.SchemeGroupVersion.WithResource("pods"), testNamespace, name)
+	if err != nil {
+		return true, watcher, nil
+	}
+
+	transitions, ok := c.transitions[name]
+	if !ok {
+		transitions = []podTransition{podRunning}
+	}
+	delete(c.transitions, name)
+
+	pod := obj.(*corev1.Pod)
+	for _, transition := range transitions {
+		pod = pod.DeepCopy()
+		transition(pod)
+		err = c.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, testNamespace)
+		if err != nil {
+			return true, nil, err
+		}
+
+		watcher.Modify(pod)
+	}
+
+	return true, watcher, nil
+}
+
+// setUID sets the uid of created objects like the api server does
+func setUID(action k8stesting.Action) (bool, runtime.Object, error) {
+	obj, ok := action.(k8stesting.CreateAction).GetObject().(metav1.Object)
+	if ok && obj.GetUID() == "" {
+		obj.SetUID(types.UID("uid-" + obj.GetName()))
+	}
+
+	return false, nil, nil
+}
+
+// created returns resource/name of all objects created through the API in order,
+// leases used to lock the workspace are left out
+func (c *fakeCluster) created() []string {
+	created := []string{}
+	for _, action := range c.Actions() {
+		createAction, ok := action.(k8stesting.CreateAction)
+		if !ok || action.GetResource().Resource == "leases" {
+			continue
+		}
+
+		obj := createAction.GetObject().(metav1.Object)
+		created = append(created, action.GetResource().Resource+"/"+obj.GetName())
+	}
+
+	return created
+}
+
+// deleted returns resource/name of all objects deleted through the API in order,
+// leases used to lock the workspace are left out
+func (c *fakeCluster) deleted() []string {
+	deleted := []string{}
+	for _, action := range c.Actions() {
+		deleteAction, ok := action.(k8stesting.DeleteAction)
+		if !ok || action.GetResource().Resource == "leases" {
+			continue
+		}
+
+		deleted = append(deleted, action.GetResource().Resource+"/"+deleteAction.GetName())
+	}
+
+	return deleted
+}
+
+// watches returns how often the driver started watching pods
+func (c *fakeCluster) watches() int {
+	watches := 0
+	for _, action := range c.Actions() {
+		if action.GetVerb() == "watch" && action.GetResource().Resource == "pods" {
+			watches++
+		}
+	}
+
+	return watches
+}
+
+func (c *fakeCluster) pod(t *testing.T, name string) *corev1.Pod {
+	t.Helper()
+
+	obj, err := c.Tracker().Get(corev1.SchemeGroupVersion.WithResource("pods"), testNamespace, name)
+	if err != nil {
+		t.Fatalf("get pod %s: %v", name, err)
+	}
+
+	return obj.(*corev1.Pod)
+}
+
+func (c *fakeCluster) persistentVolumeClaim(t *testing.T, name string) *corev1.PersistentVolumeClaim {
+	t.Helper()
+
+	obj, err := c.Tracker().Get(corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims"), testNamespace, name)
+	if err != nil {
+		t.Fatalf("get pvc %s: %v", name, err)
+	}
+
+	return obj.(*corev1.PersistentVolumeClaim)
+}
+
+func podRunning(pod *corev1.Pod) {
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.InitContainerStatuses = nil
+	for _, container := range pod.Spec.InitContainers {
+		pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, corev1.ContainerStatus{
+			Name: container.Name,
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"},
+			},
+		})
+	}
+
+	pod.Status.ContainerStatuses = nil
+	for _, container := range pod.Spec.Containers {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:  container.Name,
+			Ready: true,
+			State: corev1.ContainerState{
+				Running: &corev1.ContainerStateRunning{},
+			},
+		})
+	}
+}
+
+func podPending(pod *corev1.Pod) {
+	pod.Status.Phase = corev1.PodPending
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:   corev1.PodScheduled,
+		Status: corev1.ConditionFalse,
+		Reason: corev1.PodReasonUnschedulable,
+	}}
+}
+
+func podWaiting(reason string) podTransition {
+	return func(pod *corev1.Pod) {
+		pod.Status.Phase = corev1.PodPending
+		pod.Status.ContainerStatuses = nil
+		for _, container := range pod.Spec.Containers {
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+				Name: container.Name,
+				State: corev1.ContainerState{
+					Waiting: &corev1.ContainerStateWaiting{Reason: reason},
+				},
+			})
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	perrors "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pullSecretPrefix is the name prefix of the pull secrets created by getPullSecretsName
+const pullSecretPrefix = "devpod-pull-secret-"
+
+// Garbage is a leaked object found by FindGarbage
+type Garbage struct {
+	Resource string    `json:"resource"`
+	Name     string    `json:"name"`
+	Reason   string    `json:"reason"`
+	Created  time.Time `json:"created"`
+}
+
+func (g Garbage) String() string {
+	return fmt.Sprintf("%s/%s (%s)", g.Resource, g.Name, g.Reason)
+}
+
+// FindGarbage returns the objects created by the provider that outlived their workspace:
+// architecture detection pods, workspace pods, role bindings and pull secrets without a
+// workspace pvc or hibernation placeholder, and service accounts once no workspace is left.
+// Architecture detection pods only exist while a workspace starts, so they are garbage once
+// they are older than minAge. Objects younger than minAge are skipped, they might belong to
+// a workspace that is being created.
+func (k *KubernetesDriver) FindGarbage(ctx context.Context, minAge time.Duration) ([]Garbage, error) {
+	pvcs, err := k.client.ListPersistentVolumeClaims(ctx, DevPodCreatedLabel+"=true", false)
+	if err != nil {
+		return nil, perrors.Wrap(err, "list persistent volume claims")
+	}
+	workspaces := map[string]bool{}
+	for _, pvc := range pvcs {
+		workspaces[pvc.Name] = true
+	}
+
+	// hibernated workspaces only have their placeholder
+	placeholders, err := k.client.ListConfigMaps(ctx, DevPodHibernationLabel, false)
+	if kerrors.IsForbidden(err) {
+		// without hibernation the provider doesn't need to read config maps
+		k.Log.Debugf("Error listing hibernated workspaces: %v", err)
+	} else if err != nil {
+		return nil, perrors.Wrap(err, "list hibernated workspaces")
+	}
+	for _, placeholder := range placeholders {
+		workspaces[placeholder.Name] = true
+	}
+
+	garbage := []Garbage{}
+	isOld := func(obj metav1.Object) bool {
+		return time.Since(obj.GetCreationTimestamp().Time) >= minAge
+	}
+	add := func(resource string, obj metav1.Object, reason string) {
+		garbage = append(garbage, Garbage{
+			Resource: resource,
+			Name:     obj.GetName(),
+			Reason:   reason,
+			Created:  obj.GetCreationTimestamp().Time,
+		})
+	}
+
+	// architecture detection pods
+	archPods, err := k.client.ListPods(ctx, DevPodWorkspaceLabel, false)
+	if err != nil {
+		return nil, perrors.Wrap(err, "list architecture detection pods")
+	}
+	for i := range archPods {
+		if isOld(&archPods[i]) {
+			add("pods", &archPods[i], fmt.Sprintf("architecture detection pod older than %s", minAge))
+		}
+	}
+
+	// workspace pods
+	pods, err := k.client.ListPods(ctx, DevPodCreatedLabel+"=true", false)
+	if err != nil {
+		return nil, perrors.Wrap(err, "list pods")
+	}
+	for i, pod := range pods {
+		if !workspaces[pod.Name] && isOld(&pods[i]) {
+			add("pods", &pods[i], "no workspace pvc")
+		}
+	}
+
+	// service accounts, stopped and hibernated workspaces don't record which one they
+	// use, so they are only garbage once no workspace is left
+	if len(workspaces) == 0 {
+		serviceAccounts, err := k.client.ListServiceAccounts(ctx, DevPodCreatedLabel+"=true", false)
+		if err != nil {
+			return nil, perrors.Wrap(err, "list service accounts")
+		}
+		for i := range serviceAccounts {
+			if isOld(&serviceAccounts[i]) {
+				add("serviceaccounts", &serviceAccounts[i], "no workspace left")
+			}
+		}
+	}
+
+	// role bindings
+	roleBindings, err := k.client.ListRoleBindings(ctx, DevPodCreatedLabel+"=true", false)
+	if err != nil {
+		return nil, perrors.Wrap(err, "list role bindings")
+	}
+	for i, roleBinding := range roleBindings {
+		if !workspaces[roleBinding.Name] && isOld(&roleBindings[i]) {
+			add("rolebindings", &roleBindings[i], "no workspace pvc")
+		}
+	}
+
+	// pull secrets, selected by label so other secrets in the namespace aren't read
+	secrets, err := k.client.ListSecrets(ctx, DevPodCreatedLabel+"=true", false)
+	if err != nil {
+		return nil, perrors.Wrap(err, "list secrets")
+	}
+	for i, secret := range secrets {
+		if secret.Type != corev1.SecretTypeDockerConfigJson || !strings.HasPrefix(secret.Name, pullSecretPrefix) {
+			continue
+		}
+
+		if !workspaces[strings.TrimPrefix(secret.Name, pullSecretPrefix)] && isOld(&secrets[i]) {
+			add("secrets", &secrets[i], "no workspace pvc")
+		}
+	}
+
+	sort.SliceStable(garbage, func(i, j int) bool {
+		if garbage[i].Resource != garbage[j].Resource {
+			return garbage[i].Resource < garbage[j].Resource
+		}
+		return garbage[i].Name < garbage[j].Name
+	})
+
+	return garbage, nil
+}
+
+// DeleteGarbage deletes the objects returned by FindGarbage
+func (k *KubernetesDriver) DeleteGarbage(ctx context.Context, garbage []Garbage) error {
+	for _, obj := range garbage {
+		var err error
+		switch obj.Resource {
+		case "pods":
+			err = k.client.DeletePod(ctx, obj.Name, metav1.DeleteOptions{GracePeriodSeconds: &[]int64{0}[0]})
+		case "serviceaccounts":
+			err = k.client.DeleteServiceAccount(ctx, obj.Name, metav1.DeleteOptions{})
+		case "rolebindings":
+			err = k.client.DeleteRoleBinding(ctx, obj.Name, metav1.DeleteOptions{})
+		case "secrets":
+			err = k.client.DeleteSecret(ctx, obj.Name, metav1.DeleteOptions{})
+		default:
+			err = fmt.Errorf("unsupported resource %s", obj.Resource)
+		}
+		if err != nil && !kerrors.IsNotFound(err) {
+			return perrors.Wrapf(err, "delete %s/%s", obj.Resource, obj.Name)
+		}
+
+		k.Log.Infof("Deleted %s", obj.String())
+	}
+
+	return nil
+}
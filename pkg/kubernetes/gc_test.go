@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testObjectMeta(name string, age time.Duration, labels map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         testNamespace,
+		Labels:            labels,
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+	}
+}
+
+func TestFindGarbage(t *testing.T) {
+	created := map[string]string{DevPodCreatedLabel: "true"}
+	objects := existingWorkspace(t, &options.Options{})
+	objects = append(objects, []runtime.Object{
+		// hibernated workspace
+		&corev1.ConfigMap{ObjectMeta: testObjectMeta("devpod-hibernated", 2*time.Hour, map[string]string{DevPodHibernationLabel: "devpod-hibernated"})},
+		// architecture detection pods
+		&corev1.Pod{ObjectMeta: testObjectMeta("devpod-devpod-test-old", 2*time.Hour, map[string]string{DevPodWorkspaceLabel: "devpod-test"})},
+		&corev1.Pod{ObjectMeta: testObjectMeta("devpod-devpod-test-new", time.Minute, map[string]string{DevPodWorkspaceLabel: "devpod-test"})},
+		// workspace pod without pvc
+		&corev1.Pod{ObjectMeta: testObjectMeta("devpod-gone", 2*time.Hour, created)},
+		// service accounts are kept while a workspace exists
+		&corev1.ServiceAccount{ObjectMeta: testObjectMeta("devpod", 2*time.Hour, created)},
+		&corev1.ServiceAccount{ObjectMeta: testObjectMeta("default", 2*time.Hour, nil)},
+		// role bindings
+		&rbacv1.RoleBinding{ObjectMeta: testObjectMeta("devpod-test", 2*time.Hour, created)},
+		&rbacv1.RoleBinding{ObjectMeta: testObjectMeta("devpod-hibernated", 2*time.Hour, created)},
+		&rbacv1.RoleBinding{ObjectMeta: testObjectMeta("devpod-gone", 2*time.Hour, created)},
+		&rbacv1.RoleBinding{ObjectMeta: testObjectMeta("devpod-creating", time.Minute, created)},
+		// pull secrets, unlabelled ones aren't read
+		&corev1.Secret{ObjectMeta: testObjectMeta("devpod-pull-secret-devpod-test", 2*time.Hour, created), Type: corev1.SecretTypeDockerConfigJson},
+		&corev1.Secret{ObjectMeta: testObjectMeta("devpod-pull-secret-devpod-hibernated", 2*time.Hour, created), Type: corev1.SecretTypeDockerConfigJson},
+		&corev1.Secret{ObjectMeta: testObjectMeta("devpod-pull-secret-devpod-gone", 2*time.Hour, created), Type: corev1.SecretTypeDockerConfigJson},
+		&corev1.Secret{ObjectMeta: testObjectMeta("devpod-pull-secret-devpod-legacy", 2*time.Hour, nil), Type: corev1.SecretTypeDockerConfigJson},
+		&corev1.Secret{ObjectMeta: testObjectMeta("registry", 2*time.Hour, nil), Type: corev1.SecretTypeDockerConfigJson},
+	}...)
+
+	cluster := newFakeCluster(objects...)
+	d := cluster.driver(t, &options.Options{})
+
+	garbage, err := d.FindGarbage(context.Background(), time.Hour)
+	assert.NoError(t, err)
+
+	names := []string{}
+	for _, obj := range garbage {
+		names = append(names, obj.String())
+	}
+	for _, action := range cluster.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "secrets" {
+			assert.Equal(t, DevPodCreatedLabel+"=true", action.(k8stesting.ListAction).GetListRestrictions().Labels.String())
+		}
+	}
+	assert.Equal(t, []string{
+		"pods/devpod-devpod-test-old (architecture detection pod older than 1h0m0s)",
+		"pods/devpod-gone (no workspace pvc)",
+		"rolebindings/devpod-gone (no workspace pvc)",
+		"secrets/devpod-pull-secret-devpod-gone (no workspace pvc)",
+	}, names)
+	assert.Empty(t, cluster.deleted())
+
+	err = d.DeleteGarbage(context.Background(), garbage)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"pods/devpod-devpod-test-old",
+		"pods/devpod-gone",
+		"rolebindings/devpod-gone",
+		"secrets/devpod-pull-secret-devpod-gone",
+	}, cluster.deleted())
+}
+
+func TestFindGarbageServiceAccounts(t *testing.T) {
+	created := map[string]string{DevPodCreatedLabel: "true"}
+	cluster := newFakeCluster(
+		&corev1.ServiceAccount{ObjectMeta: testObjectMeta("devpod", 2*time.Hour, created)},
+		&corev1.ServiceAccount{ObjectMeta: testObjectMeta("devpod-new", time.Minute, created)},
+		&corev1.ServiceAccount{ObjectMeta: testObjectMeta("default", 2*time.Hour, nil)},
+	)
+	d := cluster.driver(t, &options.Options{})
+
+	// no workspace is left
+	garbage, err := d.FindGarbage(context.Background(), time.Hour)
+	assert.NoError(t, err)
+	if assert.Len(t, garbage, 1) {
+		assert.Equal(t, "serviceaccounts/devpod (no workspace left)", garbage[0].String())
+	}
+
+	// a stopped workspace might use the service account
+	pvc := existingWorkspace(t, &options.Options{})[0]
+	assert.NoError(t, cluster.Tracker().Add(pvc))
+	garbage, err = d.FindGarbage(context.Background(), time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, garbage)
+}
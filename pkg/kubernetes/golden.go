@@ -0,0 +1,82 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DevPodGoldenLabel marks volume snapshots that were taken as golden source for new
+// workspaces, its value is the id of the workspace the snapshot was taken of
+const DevPodGoldenLabel = "devpod.sh/golden"
+
+// GoldenOptions configure the snapshot a golden source is created as
+type GoldenOptions struct {
+	// SnapshotClass is the volume snapshot class, the default class of the cluster is used if it's empty
+	SnapshotClass string
+}
+
+// CreateGoldenSource takes a volume snapshot of the workspace with the given name, so
+// new workspaces can be populated from it with PVC_DATA_SOURCE. It returns the value of
+// the option. The snapshot isn't deleted with the workspace.
+func (k *KubernetesDriver) CreateGoldenSource(ctx context.Context, workspaceID, name string, opts *GoldenOptions) (string, error) {
+	id := getID(workspaceID)
+
+	dataSource := ""
+	err := k.withLock(ctx, id, "golden", func(ctx context.Context) error {
+		pvc, _, err := k.getDevContainerPvc(ctx, id)
+		if err != nil {
+			return err
+		} else if pvc == nil {
+			placeholder, err := k.getHibernationPlaceholder(ctx, id)
+			if err != nil {
+				return err
+			} else if placeholder != nil {
+				return fmt.Errorf("workspace '%s' is hibernated, start it to create a golden source from it", id)
+			}
+
+			return fmt.Errorf("workspace '%s' not found", id)
+		} else if !pvcInitialized(pvc) {
+			return fmt.Errorf("the volume of workspace '%s' wasn't initialized yet, run the workspace first", id)
+		}
+
+		pod, err := k.getPod(ctx, id)
+		if err != nil {
+			return err
+		} else if pod != nil {
+			k.Log.Infof("Workspace '%s' keeps running, the snapshot has the state of its volume after a crash. Stop the workspace first to snapshot a volume nothing writes to", id)
+		}
+
+		snapshot := &volumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					DevPodCreatedLabel: "true",
+					DevPodGoldenLabel:  id,
+				},
+			},
+			Spec: volumeSnapshotSpec{
+				Source: volumeSnapshotSource{PersistentVolumeClaimName: &id},
+			},
+		}
+		if opts.SnapshotClass != "" {
+			snapshot.Spec.VolumeSnapshotClassName = &opts.SnapshotClass
+		}
+
+		k.Log.Infof("Create volume snapshot '%s' of workspace '%s'...", name, id)
+		snapshot, err = k.createVolumeSnapshot(ctx, snapshot)
+		if err != nil {
+			return err
+		}
+
+		dataSource = "snapshot/" + snapshot.Name
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	k.Log.Infof("Volume snapshot '%s' is ready, set PVC_DATA_SOURCE=%s to populate new workspaces from it", name, dataSource)
+	return dataSource, nil
+}
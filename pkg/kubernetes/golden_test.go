@@ -0,0 +1,112 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseDataSource(t *testing.T) {
+	dataSource, err := parseDataSource("")
+	assert.NoError(t, err)
+	assert.Nil(t, dataSource)
+
+	dataSource, err = parseDataSource("pvc/golden")
+	assert.NoError(t, err)
+	assert.Equal(t, &corev1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "golden"}, dataSource)
+
+	dataSource, err = parseDataSource("VolumeSnapshot/golden")
+	assert.NoError(t, err)
+	assert.Equal(t, &corev1.TypedLocalObjectReference{APIGroup: &volumeSnapshotResource.Group, Kind: "VolumeSnapshot", Name: "golden"}, dataSource)
+
+	_, err = parseDataSource("golden")
+	assert.EqualError(t, err, "invalid PVC_DATA_SOURCE 'golden', expected pvc/<name> or snapshot/<name>")
+	_, err = parseDataSource("secret/golden")
+	assert.EqualError(t, err, "invalid PVC_DATA_SOURCE 'secret/golden', the kind must be pvc or snapshot")
+}
+
+func TestRunDevContainerFromGoldenPersistentVolumeClaim(t *testing.T) {
+	golden := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden", Namespace: testNamespace},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("20Gi")},
+		},
+	}
+	cluster := newFakeCluster(golden)
+	opts := &options.Options{ComparableOptions: options.ComparableOptions{PvcDataSource: "pvc/golden"}}
+	d := cluster.driver(t, opts)
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+
+	pvc := cluster.persistentVolumeClaim(t, "devpod-test")
+	assert.Equal(t, &corev1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "golden"}, pvc.Spec.DataSource)
+	assert.Equal(t, &corev1.TypedObjectReference{Kind: "PersistentVolumeClaim", Name: "golden"}, pvc.Spec.DataSourceRef)
+	// the volume can't be smaller than its source
+	assert.Equal(t, "20Gi", pvc.Spec.Resources.Requests.Storage().String())
+}
+
+func TestRunDevContainerGoldenSourceMissing(t *testing.T) {
+	cluster := newFakeCluster()
+	opts := &options.Options{ComparableOptions: options.ComparableOptions{PvcDataSource: "snapshot/golden"}}
+	d := cluster.driver(t, opts)
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.ErrorContains(t, err, "PVC_DATA_SOURCE: volume snapshot 'golden' not found")
+	assert.NotContains(t, cluster.created(), "persistentvolumeclaims/devpod-test")
+}
+
+func TestCreateGoldenSource(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	d := cluster.driver(t, &options.Options{})
+
+	dataSource, err := d.CreateGoldenSource(context.Background(), testWorkspaceID, "monorepo", &GoldenOptions{SnapshotClass: "csi-snapclass"})
+	assert.NoError(t, err)
+	assert.Equal(t, "snapshot/monorepo", dataSource)
+
+	snapshot, err := d.client.GetVolumeSnapshot(context.Background(), "monorepo")
+	assert.NoError(t, err)
+	assert.Equal(t, "devpod-test", *snapshot.Spec.Source.PersistentVolumeClaimName)
+	assert.Equal(t, "csi-snapclass", *snapshot.Spec.VolumeSnapshotClassName)
+	assert.Equal(t, "devpod-test", snapshot.Labels[DevPodGoldenLabel])
+	assert.NotContains(t, snapshot.Labels, DevPodHibernationLabel)
+
+	// a new workspace is populated from the snapshot
+	opts := &options.Options{ComparableOptions: options.ComparableOptions{PvcDataSource: dataSource}}
+	d = cluster.driver(t, opts)
+	err = d.RunDevContainer(context.Background(), "other", testRunOptions())
+	assert.NoError(t, err)
+	pvc := cluster.persistentVolumeClaim(t, "devpod-other")
+	assert.Equal(t, "monorepo", pvc.Spec.DataSource.Name)
+
+	// the snapshot outlives the workspace
+	err = d.DeleteDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	_, err = d.client.GetVolumeSnapshot(context.Background(), "monorepo")
+	assert.NoError(t, err)
+}
+
+func TestCreateGoldenSourceNotFound(t *testing.T) {
+	d := newFakeCluster().driver(t, &options.Options{})
+
+	_, err := d.CreateGoldenSource(context.Background(), testWorkspaceID, "monorepo", &GoldenOptions{})
+	assert.EqualError(t, err, "workspace 'devpod-test' not found")
+}
+
+func TestCreateGoldenSourceInvalidPodTimeout(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	d := cluster.driver(t, &options.Options{})
+	d.options.PodTimeout = ""
+
+	_, err := d.CreateGoldenSource(context.Background(), testWorkspaceID, "monorepo", &GoldenOptions{})
+	assert.ErrorContains(t, err, "parse pod timeout")
+
+	snapshots, err := d.client.ListVolumeSnapshots(context.Background(), "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+}
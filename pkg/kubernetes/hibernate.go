@@ -0,0 +1,473 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/random"
+	perrors "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// DevPodHibernationLabel marks the volume snapshots and the placeholder of a
+	// hibernated workspace, its value is the id of the workspace
+	DevPodHibernationLabel = "devpod.sh/hibernation"
+	// DevPodSnapshotAnnotation is the volume snapshot the pvc of a hibernated workspace
+	// is restored from
+	DevPodSnapshotAnnotation = "devpod.sh/snapshot"
+)
+
+// StatusHibernated is the detailed status of a workspace whose volume was replaced by a snapshot
+const StatusHibernated = "hibernated"
+
+// PhaseHibernated is the phase of hibernated workspaces
+const PhaseHibernated = "Hibernated"
+
+// pvcSpecKey is the key of the placeholder data that holds the spec of the deleted pvc
+const pvcSpecKey = "persistentVolumeClaimSpec"
+
+// snapshotPollInterval is how often the driver checks whether a snapshot is ready
+const snapshotPollInterval = 2 * time.Second
+
+// hibernate stops the workspace and replaces its pvc with a volume snapshot, so a
+// stopped workspace doesn't hold its volume. The annotations of the pvc are kept on a
+// placeholder config map with the name of the pvc until the workspace is started again.
+func (k *KubernetesDriver) hibernate(ctx context.Context, id string) error {
+	retention, err := k.snapshotRetention()
+	if err != nil {
+		return err
+	}
+
+	// the volume must be unmounted for a consistent snapshot
+	err = k.waitPodDeleted(ctx, id)
+	if err != nil {
+		return perrors.Wrapf(err, "stop devcontainer: %s", id)
+	}
+
+	pvc, _, err := k.getDevContainerPvc(ctx, id)
+	if err != nil {
+		return err
+	} else if pvc == nil {
+		// already hibernated
+		return nil
+	}
+
+	k.Log.Infof("Create volume snapshot of workspace '%s'...", id)
+	snapshot := &volumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: id + "-" + random.String(6),
+			Labels: map[string]string{
+				DevPodCreatedLabel:     "true",
+				DevPodHibernationLabel: id,
+			},
+		},
+		Spec: volumeSnapshotSpec{
+			Source: volumeSnapshotSource{PersistentVolumeClaimName: &id},
+		},
+	}
+	if k.options.HibernateSnapshotClass != "" {
+		snapshot.Spec.VolumeSnapshotClassName = &k.options.HibernateSnapshotClass
+	}
+	snapshot, err = k.createVolumeSnapshot(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+
+	err = k.createHibernationPlaceholder(ctx, id, pvc, snapshot.Name)
+	if err != nil {
+		return err
+	}
+
+	// the objects the pvc owns are deleted with it and created again on start
+	k.Log.Infof("Delete persistent volume claim '%s'...", id)
+	err = k.client.DeletePersistentVolumeClaim(ctx, id, metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return perrors.Wrap(err, "delete pvc")
+	}
+
+	k.pruneVolumeSnapshots(ctx, id, retention)
+	k.Log.Infof("Workspace '%s' hibernated to volume snapshot '%s'", id, snapshot.Name)
+	return nil
+}
+
+// snapshotRetention returns how many volume snapshots are kept per workspace
+func (k *KubernetesDriver) snapshotRetention() (int, error) {
+	if k.options.HibernateSnapshotRetention == "" {
+		return 1, nil
+	}
+
+	retention, err := strconv.Atoi(k.options.HibernateSnapshotRetention)
+	if err != nil {
+		return 0, perrors.Wrap(err, "parse HIBERNATE_SNAPSHOT_RETENTION")
+	} else if retention < 1 {
+		return 0, fmt.Errorf("HIBERNATE_SNAPSHOT_RETENTION must be at least 1, the latest snapshot is needed to restore the workspace")
+	}
+
+	return retention, nil
+}
+
+// createVolumeSnapshot creates the snapshot and waits until it's ready. Snapshots that
+// fail are deleted again.
+func (k *KubernetesDriver) createVolumeSnapshot(ctx context.Context, snapshot *volumeSnapshot) (*volumeSnapshot, error) {
+	_, err := k.client.CreateVolumeSnapshot(ctx, snapshot)
+	if kerrors.IsNotFound(err) {
+		return nil, fmt.Errorf("create volume snapshot: %w\nHint: Volume snapshots need the CSI snapshot CRDs and snapshot controller in the cluster.", err)
+	} else if err != nil {
+		return nil, perrors.Wrap(err, "create volume snapshot")
+	}
+
+	name := snapshot.Name
+	snapshot, err = k.waitVolumeSnapshotReady(ctx, name)
+	if err != nil {
+		cleanupCtx, cancel := cleanupContext(ctx)
+		defer cancel()
+
+		deleteErr := k.client.DeleteVolumeSnapshot(cleanupCtx, name, metav1.DeleteOptions{})
+		if deleteErr != nil && !kerrors.IsNotFound(deleteErr) {
+			k.Log.Warnf("Error deleting volume snapshot '%s': %v", name, deleteErr)
+		}
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// waitVolumeSnapshotReady waits until the snapshot can be restored, at most POD_TIMEOUT.
+// It returns the last seen state of the snapshot, also if it fails.
+func (k *KubernetesDriver) waitVolumeSnapshotReady(ctx context.Context, name string) (*volumeSnapshot, error) {
+	snapshot := &volumeSnapshot{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	timeoutDuration, err := time.ParseDuration(k.options.PodTimeout)
+	if err != nil {
+		return snapshot, perrors.Wrap(err, "parse pod timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeoutDuration)
+	defer cancel()
+
+	err = wait.PollUntilContextCancel(ctx, snapshotPollInterval, true, func(ctx context.Context) (bool, error) {
+		current, err := k.client.GetVolumeSnapshot(ctx, name)
+		if err != nil {
+			return false, perrors.Wrap(err, "get volume snapshot")
+		}
+		snapshot = current
+
+		if message := snapshot.errorMessage(); message != "" {
+			return false, fmt.Errorf("volume snapshot '%s' failed: %s", name, message)
+		}
+		return snapshot.readyToUse(), nil
+	})
+	if perrors.Is(err, context.DeadlineExceeded) {
+		return snapshot, fmt.Errorf("timed out waiting for volume snapshot '%s' to become ready", name)
+	}
+
+	return snapshot, err
+}
+
+// getReadyVolumeSnapshot returns the volume snapshot with the given name, which must be
+// ready to use
+func (k *KubernetesDriver) getReadyVolumeSnapshot(ctx context.Context, name string) (*volumeSnapshot, error) {
+	snapshot, err := k.client.GetVolumeSnapshot(ctx, name)
+	if kerrors.IsNotFound(err) {
+		return nil, fmt.Errorf("volume snapshot '%s' not found", name)
+	} else if err != nil {
+		return nil, perrors.Wrap(err, "get volume snapshot")
+	}
+
+	if message := snapshot.errorMessage(); message != "" {
+		return nil, fmt.Errorf("volume snapshot '%s' failed: %s", name, message)
+	} else if !snapshot.readyToUse() {
+		return nil, fmt.Errorf("volume snapshot '%s' isn't ready to use yet", name)
+	}
+
+	return snapshot, nil
+}
+
+// createHibernationPlaceholder creates the config map that keeps the labels, annotations
+// and spec of the pvc, so the workspace can be found and restored while it has no pvc
+func (k *KubernetesDriver) createHibernationPlaceholder(ctx context.Context, id string, pvc *corev1.PersistentVolumeClaim, snapshotName string) error {
+	spec := pvc.Spec.DeepCopy()
+	spec.VolumeName = ""
+	spec.DataSource = nil
+	spec.DataSourceRef = nil
+	rawSpec, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]string{}
+	for key, value := range pvc.Labels {
+		labels[key] = value
+	}
+	labels[DevPodHibernationLabel] = id
+
+	annotations := map[string]string{}
+	for key, value := range pvc.Annotations {
+		if !controllerAnnotation(key) {
+			annotations[key] = value
+		}
+	}
+	annotations[DevPodSnapshotAnnotation] = snapshotName
+
+	placeholder := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        id,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Data: map[string]string{
+			pvcSpecKey: string(rawSpec),
+		},
+	}
+
+	_, err = k.client.CreateConfigMap(ctx, placeholder)
+	if kerrors.IsAlreadyExists(err) {
+		// left behind by a restore that couldn't delete it
+		err = k.client.DeleteConfigMap(ctx, id, metav1.DeleteOptions{})
+		if err == nil {
+			_, err = k.client.CreateConfigMap(ctx, placeholder)
+		}
+	}
+	if err != nil {
+		return perrors.Wrap(err, "create hibernation placeholder")
+	}
+
+	return nil
+}
+
+// controllerAnnotation returns true for the annotations Kubernetes sets on bound pvcs,
+// which must not be copied to the restored pvc
+func controllerAnnotation(key string) bool {
+	for _, prefix := range []string{"pv.kubernetes.io/", "volume.kubernetes.io/", "volume.beta.kubernetes.io/"} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pruneVolumeSnapshots deletes the oldest snapshots of the workspace, so only the
+// given number of snapshots is kept
+func (k *KubernetesDriver) pruneVolumeSnapshots(ctx context.Context, id string, retention int) {
+	snapshots, err := k.client.ListVolumeSnapshots(ctx, DevPodHibernationLabel+"="+id, false)
+	if err != nil {
+		k.Log.Warnf("Error listing volume snapshots of workspace '%s': %v", id, err)
+		return
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].CreationTimestamp.After(snapshots[j].CreationTimestamp.Time)
+	})
+	for i := retention; i < len(snapshots); i++ {
+		k.Log.Infof("Delete old volume snapshot '%s'...", snapshots[i].Name)
+		err = k.client.DeleteVolumeSnapshot(ctx, snapshots[i].Name, metav1.DeleteOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			k.Log.Warnf("Error deleting volume snapshot '%s': %v", snapshots[i].Name, err)
+		}
+	}
+}
+
+// getHibernationPlaceholder returns the placeholder of the hibernated workspace or nil
+// if the workspace isn't hibernated
+func (k *KubernetesDriver) getHibernationPlaceholder(ctx context.Context, id string) (*corev1.ConfigMap, error) {
+	placeholder, err := k.client.GetConfigMap(ctx, id)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		} else if kerrors.IsForbidden(err) {
+			// without hibernation the provider doesn't need to read config maps
+			k.Log.Debugf("Error getting hibernation placeholder '%s': %v", id, err)
+			return nil, nil
+		}
+
+		return nil, perrors.Wrap(err, "get hibernation placeholder")
+	} else if placeholder.Labels[DevPodHibernationLabel] != id {
+		return nil, nil
+	}
+
+	return placeholder, nil
+}
+
+// restoreWorkspace recreates the pvc of a hibernated workspace from its volume snapshot
+// and deletes the placeholder. It returns nil if the workspace isn't hibernated.
+func (k *KubernetesDriver) restoreWorkspace(ctx context.Context, id string) (*corev1.PersistentVolumeClaim, *DevContainerInfo, error) {
+	placeholder, err := k.getHibernationPlaceholder(ctx, id)
+	if err != nil || placeholder == nil {
+		return nil, nil, err
+	}
+
+	snapshotName := placeholder.Annotations[DevPodSnapshotAnnotation]
+	snapshot, err := k.client.GetVolumeSnapshot(ctx, snapshotName)
+	if kerrors.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("volume snapshot '%s' of hibernated workspace '%s' not found", snapshotName, id)
+	} else if err != nil {
+		return nil, nil, perrors.Wrap(err, "get volume snapshot")
+	}
+
+	pvc, err := restoredPersistentVolumeClaim(placeholder, snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	k.Log.Infof("Restore workspace '%s' from volume snapshot '%s'", id, snapshotName)
+	stop := k.timing.track(phaseVolume)
+	pvc, err = k.client.CreatePersistentVolumeClaim(ctx, pvc)
+	stop()
+	if err != nil {
+		return nil, nil, withHint(perrors.Wrap(err, "restore pvc"))
+	}
+
+	err = k.client.DeleteConfigMap(ctx, id, metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		k.Log.Warnf("Error deleting hibernation placeholder '%s': %v", id, err)
+	}
+
+	containerInfo, err := devContainerInfo(pvc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pvc, containerInfo, nil
+}
+
+// restoredPersistentVolumeClaim builds the pvc of the hibernated workspace with the
+// snapshot as data source
+func restoredPersistentVolumeClaim(placeholder *corev1.ConfigMap, snapshot *volumeSnapshot) (*corev1.PersistentVolumeClaim, error) {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        placeholder.Name,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+	}
+	err := json.Unmarshal([]byte(placeholder.Data[pvcSpecKey]), &pvc.Spec)
+	if err != nil {
+		return nil, perrors.Wrap(err, "decode hibernated pvc spec")
+	}
+
+	for key, value := range placeholder.Labels {
+		if key != DevPodHibernationLabel {
+			pvc.Labels[key] = value
+		}
+	}
+	for key, value := range placeholder.Annotations {
+		if key != DevPodSnapshotAnnotation {
+			pvc.Annotations[key] = value
+		}
+	}
+
+	setSnapshotDataSource(pvc, snapshot)
+	return pvc, nil
+}
+
+// setSnapshotDataSource populates the pvc from the snapshot
+func setSnapshotDataSource(pvc *corev1.PersistentVolumeClaim, snapshot *volumeSnapshot) {
+	apiGroup := volumeSnapshotResource.Group
+	pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     volumeSnapshotTypeMeta.Kind,
+		Name:     snapshot.Name,
+	}
+
+	// the volume can't be smaller than the snapshot
+	if snapshot.Status != nil && snapshot.Status.RestoreSize != nil {
+		requestAtLeast(pvc, *snapshot.Status.RestoreSize)
+	}
+}
+
+// requestAtLeast raises the storage request of the pvc to the given size if it's smaller
+func requestAtLeast(pvc *corev1.PersistentVolumeClaim, size resource.Quantity) {
+	request := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if request.Cmp(size) >= 0 {
+		return
+	}
+
+	if pvc.Spec.Resources.Requests == nil {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{}
+	}
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+}
+
+// findHibernatedWorkspace returns the details of the hibernated workspace or nil if
+// the workspace isn't hibernated
+func (k *KubernetesDriver) findHibernatedWorkspace(ctx context.Context, id string) (*WorkspaceDetails, error) {
+	placeholder, err := k.getHibernationPlaceholder(ctx, id)
+	if err != nil || placeholder == nil {
+		return nil, err
+	}
+
+	labels := map[string]string{}
+	containerInfo := &DevContainerInfo{}
+	err = json.Unmarshal([]byte(placeholder.Annotations[DevPodInfoAnnotation]), containerInfo)
+	if err != nil {
+		return nil, perrors.Wrap(err, "decode dev container info")
+	} else if containerInfo.Options != nil {
+		labels = config.ListToObject(containerInfo.Options.Labels)
+	}
+
+	status := &WorkspaceStatus{
+		Status:             StatusHibernated,
+		Message:            fmt.Sprintf("The volume is restored from volume snapshot '%s' on start", placeholder.Annotations[DevPodSnapshotAnnotation]),
+		LastTransitionTime: &placeholder.CreationTimestamp.Time,
+	}
+
+	return &WorkspaceDetails{
+		ContainerDetails: &config.ContainerDetails{
+			ID:      id,
+			Created: placeholder.CreationTimestamp.String(),
+			State: config.ContainerDetailsState{
+				Status:    status.Status,
+				StartedAt: placeholder.CreationTimestamp.String(),
+			},
+			Config: config.ContainerDetailsConfig{
+				Labels: labels,
+			},
+		},
+		WorkspaceStatus: status,
+	}, nil
+}
+
+// deleteHibernation deletes the placeholder and the volume snapshots of the workspace
+func (k *KubernetesDriver) deleteHibernation(ctx context.Context, id string) error {
+	placeholder, err := k.getHibernationPlaceholder(ctx, id)
+	if err != nil {
+		return err
+	} else if placeholder == nil && !k.options.Hibernate {
+		return nil
+	}
+
+	if placeholder != nil {
+		k.Log.Infof("Delete hibernation placeholder '%s'...", id)
+		err = k.client.DeleteConfigMap(ctx, id, metav1.DeleteOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return perrors.Wrap(err, "delete hibernation placeholder")
+		}
+	}
+
+	snapshots, err := k.client.ListVolumeSnapshots(ctx, DevPodHibernationLabel+"="+id, false)
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return perrors.Wrap(err, "list volume snapshots")
+	}
+	for _, snapshot := range snapshots {
+		k.Log.Infof("Delete volume snapshot '%s'...", snapshot.Name)
+		err = k.client.DeleteVolumeSnapshot(ctx, snapshot.Name, metav1.DeleteOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return perrors.Wrap(err, "delete volume snapshot")
+		}
+	}
+
+	return nil
+}
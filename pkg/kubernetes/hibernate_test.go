@@ -0,0 +1,188 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func hibernateOptions() *options.Options {
+	return &options.Options{
+		Hibernate:              true,
+		HibernateSnapshotClass: "csi-snapclass",
+	}
+}
+
+func TestHibernateAndRestore(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, hibernateOptions())...)
+	d := cluster.driver(t, hibernateOptions())
+	pvc := cluster.persistentVolumeClaim(t, "devpod-test")
+
+	err := d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test", "persistentvolumeclaims/devpod-test"}, cluster.deleted())
+
+	snapshots, err := d.client.ListVolumeSnapshots(context.Background(), DevPodHibernationLabel+"=devpod-test", false)
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, "devpod-test", *snapshots[0].Spec.Source.PersistentVolumeClaimName)
+	assert.Equal(t, "csi-snapclass", *snapshots[0].Spec.VolumeSnapshotClassName)
+
+	placeholder, err := d.client.GetConfigMap(context.Background(), "devpod-test")
+	assert.NoError(t, err)
+	assert.Equal(t, pvc.Annotations[DevPodInfoAnnotation], placeholder.Annotations[DevPodInfoAnnotation])
+	assert.Equal(t, snapshots[0].Name, placeholder.Annotations[DevPodSnapshotAnnotation])
+	assert.Equal(t, pvc.Labels[DevPodWorkspaceUIDLabel], placeholder.Labels[DevPodWorkspaceUIDLabel])
+
+	// stopping a hibernated workspace is a no-op
+	err = d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+
+	details, err := d.FindWorkspace(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusHibernated, details.WorkspaceStatus.Status)
+	assert.Equal(t, StatusHibernated, details.State.Status)
+
+	workspaces, err := d.ListWorkspaces(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Len(t, workspaces, 1)
+	assert.Equal(t, PhaseHibernated, workspaces[0].Phase)
+	assert.Equal(t, "10Gi", workspaces[0].DiskSize)
+	assert.Equal(t, testRunOptions().Image, workspaces[0].Image)
+
+	err = d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+
+	restored := cluster.persistentVolumeClaim(t, "devpod-test")
+	assert.Equal(t, &corev1.TypedLocalObjectReference{
+		APIGroup: &volumeSnapshotResource.Group,
+		Kind:     "VolumeSnapshot",
+		Name:     snapshots[0].Name,
+	}, restored.Spec.DataSource)
+	assert.Equal(t, pvc.Annotations[DevPodInfoAnnotation], restored.Annotations[DevPodInfoAnnotation])
+	assert.NotContains(t, restored.Annotations, DevPodSnapshotAnnotation)
+	assert.NotContains(t, restored.Labels, DevPodHibernationLabel)
+	assert.Contains(t, cluster.deleted(), "configmaps/devpod-test")
+	assert.Equal(t, corev1.PodRunning, cluster.pod(t, "devpod-test").Status.Phase)
+
+	// the snapshot is kept until the workspace hibernates again or is deleted
+	err = d.DeleteDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	snapshots, err = d.client.ListVolumeSnapshots(context.Background(), "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+}
+
+func TestHibernateSnapshotFailed(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, hibernateOptions())...)
+	cluster.snapshotError = "csi driver doesn't support snapshots"
+	d := cluster.driver(t, hibernateOptions())
+
+	err := d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.ErrorContains(t, err, "csi driver doesn't support snapshots")
+
+	// the workspace is only stopped
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.deleted())
+	cluster.persistentVolumeClaim(t, "devpod-test")
+	snapshots, err := d.client.ListVolumeSnapshots(context.Background(), "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+}
+
+func TestHibernateInvalidPodTimeout(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, hibernateOptions())...)
+	d := cluster.driver(t, hibernateOptions())
+	d.options.PodTimeout = ""
+
+	err := d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.ErrorContains(t, err, "parse pod timeout")
+
+	// the snapshot is deleted again and the workspace is unlocked
+	snapshots, err := d.client.ListVolumeSnapshots(context.Background(), "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+	_, err = cluster.CoordinationV1().Leases(testNamespace).Get(context.Background(), "devpod-test", metav1.GetOptions{})
+	assert.True(t, kerrors.IsNotFound(err), err)
+}
+
+func TestHibernatePrunesSnapshots(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, hibernateOptions())...)
+	opts := hibernateOptions()
+	opts.HibernateSnapshotRetention = "2"
+	d := cluster.driver(t, opts)
+
+	for _, name := range []string{"devpod-test-old", "devpod-test-older"} {
+		_, err := d.client.CreateVolumeSnapshot(context.Background(), &volumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{DevPodHibernationLabel: "devpod-test"},
+			},
+		})
+		assert.NoError(t, err)
+	}
+	// the fake sets the creation time on create
+	older, err := d.client.GetVolumeSnapshot(context.Background(), "devpod-test-older")
+	assert.NoError(t, err)
+	older.CreationTimestamp = metav1.NewTime(older.CreationTimestamp.Add(-time.Hour))
+	obj, err := volumeSnapshotToUnstructured(older)
+	assert.NoError(t, err)
+	_, err = cluster.dynamic.Resource(volumeSnapshotResource).Namespace(testNamespace).Update(context.Background(), obj, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	err = d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+
+	snapshots, err := d.client.ListVolumeSnapshots(context.Background(), "", false)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.Name)
+	}
+	assert.Len(t, names, 2)
+	assert.Contains(t, names, "devpod-test-old")
+	assert.NotContains(t, names, "devpod-test-older")
+}
+
+func TestRestoredPersistentVolumeClaim(t *testing.T) {
+	placeholder := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "devpod-test",
+			Labels:      map[string]string{DevPodHibernationLabel: "devpod-test", DevPodCreatedLabel: "true"},
+			Annotations: map[string]string{DevPodSnapshotAnnotation: "devpod-test-abcdef", DevPodInfoAnnotation: "{}"},
+		},
+		Data: map[string]string{
+			pvcSpecKey: `{"accessModes":["ReadWriteOnce"],"resources":{"requests":{"storage":"5Gi"}}}`,
+		},
+	}
+	restoreSize := resource.MustParse("8Gi")
+	snapshot := &volumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "devpod-test-abcdef"},
+		Status:     &volumeSnapshotStatus{RestoreSize: &restoreSize},
+	}
+
+	pvc, err := restoredPersistentVolumeClaim(placeholder, snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{DevPodCreatedLabel: "true"}, pvc.Labels)
+	assert.Equal(t, map[string]string{DevPodInfoAnnotation: "{}"}, pvc.Annotations)
+	assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}, pvc.Spec.AccessModes)
+	// the volume can't be smaller than the snapshot
+	assert.Equal(t, "8Gi", pvc.Spec.Resources.Requests.Storage().String())
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	d := newFakeCluster().driver(t, &options.Options{})
+	retention, err := d.snapshotRetention()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, retention)
+
+	d.options.HibernateSnapshotRetention = "0"
+	_, err = d.snapshotRetention()
+	assert.ErrorContains(t, err, "HIBERNATE_SNAPSHOT_RETENTION must be at least 1")
+}
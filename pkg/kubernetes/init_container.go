@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"strings"
 
+	optionspkg "github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
 	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/log"
 	corev1 "k8s.io/api/core/v1"
 )
 
-func (k *KubernetesDriver) getInitContainers(options *driver.RunOptions, pod *corev1.Pod, initialize bool) ([]corev1.Container, error) {
+func getInitContainers(opts *optionspkg.Options, options *driver.RunOptions, pod *corev1.Pod, initialize bool, log log.Logger) ([]corev1.Container, error) {
 	if !initialize {
 		retContainers := []corev1.Container{}
 		// don't build init container and clean up existing one if defined
@@ -58,7 +60,7 @@ func (k *KubernetesDriver) getInitContainers(options *driver.RunOptions, pod *co
 		RunAsGroup:   &[]int64{0}[0],
 		RunAsNonRoot: &[]bool{false}[0],
 	}
-	if k.options.StrictSecurity {
+	if opts.StrictSecurity {
 		securityContext = nil
 	}
 
@@ -67,7 +69,7 @@ func (k *KubernetesDriver) getInitContainers(options *driver.RunOptions, pod *co
 		Image:           options.Image,
 		Command:         []string{"sh"},
 		Args:            []string{"-c", strings.Join(commands, "\n") + "\n"},
-		Resources:       parseResources(k.options.HelperResources, k.Log),
+		Resources:       parseResources(opts.HelperResources, log),
 		VolumeMounts:    volumeMounts,
 		SecurityContext: securityContext,
 	}
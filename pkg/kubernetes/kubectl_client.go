@@ -0,0 +1,804 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/loft-sh/devpod/pkg/command"
+	"github.com/loft-sh/log"
+	perrors "github.com/pkg/errors"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// kubectlClient is the legacy client that shells out to a kubectl binary. It is only
+// used if KUBECTL_PATH is set.
+type kubectlClient struct {
+	kubectl string
+
+	kubeConfig string
+	namespace  string
+	context    string
+
+	log log.Logger
+}
+
+func newKubectlClient(kubectl, kubeConfig, context, namespace string, log log.Logger) *kubectlClient {
+	return &kubectlClient{
+		kubectl:    kubectl,
+		kubeConfig: kubeConfig,
+		context:    context,
+		namespace:  namespace,
+		log:        log,
+	}
+}
+
+func (c *kubectlClient) Namespace() string {
+	return c.namespace
+}
+
+// kubeConfigNamespace returns the namespace of the kube config context, or
+// DefaultNamespace if the context doesn't set one or kubectl fails
+func (c *kubectlClient) kubeConfigNamespace() string {
+	out, err := c.buildCmd(context.Background(), []string{"config", "view", "--minify", "-o", "jsonpath={..namespace}"}).Output()
+	if err != nil {
+		c.log.Debugf("Error getting namespace from kube config: %v", err)
+		return DefaultNamespace
+	} else if namespace := strings.TrimSpace(string(out)); namespace != "" {
+		return namespace
+	}
+
+	return DefaultNamespace
+}
+
+func (c *kubectlClient) CreateNamespace(ctx context.Context, name string) error {
+	out, err := c.buildCmd(ctx, []string{"create", "ns", name}).CombinedOutput()
+	if err != nil {
+		return kubectlError(corev1.Resource("namespaces"), name, out, err)
+	}
+
+	return nil
+}
+
+func (c *kubectlClient) GetPod(ctx context.Context, name string) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	err := c.get(ctx, corev1.Resource("pods"), name, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+// WatchPod runs kubectl get --watch and decodes the streamed watch events. kubectl
+// doesn't support starting at a resource version, so the first event is always the
+// current state of the pod. If kubectl fails, e.g. because watching pods is forbidden,
+// its error is sent as the last event.
+func (c *kubectlClient) WatchPod(ctx context.Context, name, resourceVersion string) (watch.Interface, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := c.buildCmd(ctx, []string{"get", "pod", name, "--watch", "--output-watch-events", "-o", "json"})
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	err = cmd.Start()
+	if err != nil {
+		cancel()
+		return nil, perrors.Wrap(err, "start kubectl watch")
+	}
+
+	events := make(chan watch.Event)
+	watcher := watch.NewProxyWatcher(events)
+	go func() {
+		<-watcher.StopChan()
+		cancel()
+	}()
+	go func() {
+		defer close(events)
+
+		decoder := json.NewDecoder(stdout)
+		for {
+			watchEvent := &metav1.WatchEvent{}
+			err := decoder.Decode(watchEvent)
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = cmd.Wait()
+					if err != nil {
+						err = kubectlError(corev1.Resource("pods"), name, stderr.Bytes(), err)
+					}
+				} else {
+					// kubectl would block writing the rest of its output
+					cancel()
+					_ = cmd.Wait()
+					err = perrors.Wrap(err, "decode watch event")
+				}
+				if err == nil {
+					return
+				}
+
+				select {
+				case events <- watchErrorEvent(err):
+				case <-watcher.StopChan():
+				}
+				return
+			}
+
+			pod := &corev1.Pod{}
+			err = json.Unmarshal(watchEvent.Object.Raw, pod)
+			if err != nil {
+				c.log.Debugf("Error decoding watch event: %v", err)
+				continue
+			}
+
+			select {
+			case events <- watch.Event{Type: watch.EventType(watchEvent.Type), Object: pod}:
+			case <-watcher.StopChan():
+				return
+			}
+		}
+	}()
+
+	return watcher, nil
+}
+
+// watchErrorEvent converts the error a watch failed with into an error event
+func watchErrorEvent(err error) watch.Event {
+	var apiStatus kerrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		status := apiStatus.Status()
+		return watch.Event{Type: watch.Error, Object: &status}
+	}
+
+	return watch.Event{Type: watch.Error, Object: &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: err.Error(),
+	}}
+}
+
+func (c *kubectlClient) ListPods(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	err := c.list(ctx, corev1.Resource("pods"), labelSelector, allNamespaces, podList)
+	if err != nil {
+		return nil, err
+	}
+
+	return podList.Items, nil
+}
+
+func (c *kubectlClient) CreatePod(ctx context.Context, pod *corev1.Pod, opts metav1.CreateOptions) (*corev1.Pod, error) {
+	pod = pod.DeepCopy()
+	pod.TypeMeta = metav1.TypeMeta{Kind: "Pod", APIVersion: corev1.SchemeGroupVersion.String()}
+
+	created := &corev1.Pod{}
+	err := c.create(ctx, corev1.Resource("pods"), pod.Name, pod, created, createArgs(opts)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *kubectlClient) PatchPod(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	err := c.patch(ctx, corev1.Resource("pods"), name, patchType, data, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+func (c *kubectlClient) DeletePod(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.delete(ctx, corev1.Resource("pods"), name, opts)
+}
+
+func (c *kubectlClient) DeletePods(ctx context.Context, labelSelector string, opts metav1.DeleteOptions) error {
+	args := append([]string{"delete", "pods", "-l", labelSelector}, deleteArgs(opts)...)
+	out, err := c.buildCmd(ctx, args).CombinedOutput()
+	if err != nil {
+		return kubectlError(corev1.Resource("pods"), "", out, err)
+	}
+
+	return nil
+}
+
+func (c *kubectlClient) GetPersistentVolumeClaim(ctx context.Context, name string) (*corev1.PersistentVolumeClaim, error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := c.get(ctx, corev1.Resource("persistentvolumeclaims"), name, pvc)
+	if err != nil {
+		return nil, err
+	}
+
+	return pvc, nil
+}
+
+func (c *kubectlClient) ListPersistentVolumeClaims(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.PersistentVolumeClaim, error) {
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	err := c.list(ctx, corev1.Resource("persistentvolumeclaims"), labelSelector, allNamespaces, pvcList)
+	if err != nil {
+		return nil, err
+	}
+
+	return pvcList.Items, nil
+}
+
+func (c *kubectlClient) CreatePersistentVolumeClaim(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error) {
+	pvc = pvc.DeepCopy()
+	pvc.TypeMeta = metav1.TypeMeta{Kind: "PersistentVolumeClaim", APIVersion: corev1.SchemeGroupVersion.String()}
+
+	created := &corev1.PersistentVolumeClaim{}
+	err := c.create(ctx, corev1.Resource("persistentvolumeclaims"), pvc.Name, pvc, created)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *kubectlClient) PatchPersistentVolumeClaim(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.PersistentVolumeClaim, error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := c.patch(ctx, corev1.Resource("persistentvolumeclaims"), name, patchType, data, pvc)
+	if err != nil {
+		return nil, err
+	}
+
+	return pvc, nil
+}
+
+func (c *kubectlClient) DeletePersistentVolumeClaim(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.delete(ctx, corev1.Resource("persistentvolumeclaims"), name, opts)
+}
+
+func (c *kubectlClient) GetServiceAccount(ctx context.Context, name string) (*corev1.ServiceAccount, error) {
+	serviceAccount := &corev1.ServiceAccount{}
+	err := c.get(ctx, corev1.Resource("serviceaccounts"), name, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	return serviceAccount, nil
+}
+
+func (c *kubectlClient) ListServiceAccounts(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.ServiceAccount, error) {
+	serviceAccountList := &corev1.ServiceAccountList{}
+	err := c.list(ctx, corev1.Resource("serviceaccounts"), labelSelector, allNamespaces, serviceAccountList)
+	if err != nil {
+		return nil, err
+	}
+
+	return serviceAccountList.Items, nil
+}
+
+func (c *kubectlClient) CreateServiceAccount(ctx context.Context, serviceAccount *corev1.ServiceAccount) (*corev1.ServiceAccount, error) {
+	serviceAccount = serviceAccount.DeepCopy()
+	serviceAccount.TypeMeta = metav1.TypeMeta{Kind: "ServiceAccount", APIVersion: corev1.SchemeGroupVersion.String()}
+
+	created := &corev1.ServiceAccount{}
+	err := c.create(ctx, corev1.Resource("serviceaccounts"), serviceAccount.Name, serviceAccount, created)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *kubectlClient) DeleteServiceAccount(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.delete(ctx, corev1.Resource("serviceaccounts"), name, opts)
+}
+
+func (c *kubectlClient) GetRoleBinding(ctx context.Context, name string) (*rbacv1.RoleBinding, error) {
+	roleBinding := &rbacv1.RoleBinding{}
+	err := c.get(ctx, rbacv1.Resource("rolebindings"), name, roleBinding)
+	if err != nil {
+		return nil, err
+	}
+
+	return roleBinding, nil
+}
+
+func (c *kubectlClient) ListRoleBindings(ctx context.Context, labelSelector string, allNamespaces bool) ([]rbacv1.RoleBinding, error) {
+	roleBindingList := &rbacv1.RoleBindingList{}
+	err := c.list(ctx, rbacv1.Resource("rolebindings"), labelSelector, allNamespaces, roleBindingList)
+	if err != nil {
+		return nil, err
+	}
+
+	return roleBindingList.Items, nil
+}
+
+func (c *kubectlClient) CreateRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding) (*rbacv1.RoleBinding, error) {
+	roleBinding = roleBinding.DeepCopy()
+	roleBinding.TypeMeta = metav1.TypeMeta{Kind: "RoleBinding", APIVersion: rbacv1.SchemeGroupVersion.String()}
+
+	created := &rbacv1.RoleBinding{}
+	err := c.create(ctx, rbacv1.Resource("rolebindings"), roleBinding.Name, roleBinding, created)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *kubectlClient) PatchRoleBinding(ctx context.Context, name string, patchType types.PatchType, data []byte) (*rbacv1.RoleBinding, error) {
+	roleBinding := &rbacv1.RoleBinding{}
+	err := c.patch(ctx, rbacv1.Resource("rolebindings"), name, patchType, data, roleBinding)
+	if err != nil {
+		return nil, err
+	}
+
+	return roleBinding, nil
+}
+
+func (c *kubectlClient) DeleteRoleBinding(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.delete(ctx, rbacv1.Resource("rolebindings"), name, opts)
+}
+
+func (c *kubectlClient) GetSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := c.get(ctx, corev1.Resource("secrets"), name, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (c *kubectlClient) ListSecrets(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.Secret, error) {
+	secretList := &corev1.SecretList{}
+	err := c.list(ctx, corev1.Resource("secrets"), labelSelector, allNamespaces, secretList)
+	if err != nil {
+		return nil, err
+	}
+
+	return secretList.Items, nil
+}
+
+func (c *kubectlClient) CreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	secret = secret.DeepCopy()
+	secret.TypeMeta = metav1.TypeMeta{Kind: "Secret", APIVersion: corev1.SchemeGroupVersion.String()}
+
+	created := &corev1.Secret{}
+	err := c.create(ctx, corev1.Resource("secrets"), secret.Name, secret, created)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *kubectlClient) PatchSecret(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := c.patch(ctx, corev1.Resource("secrets"), name, patchType, data, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (c *kubectlClient) DeleteSecret(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.delete(ctx, corev1.Resource("secrets"), name, opts)
+}
+
+func (c *kubectlClient) GetConfigMap(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+	configMap := &corev1.ConfigMap{}
+	err := c.get(ctx, corev1.Resource("configmaps"), name, configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return configMap, nil
+}
+
+func (c *kubectlClient) ListConfigMaps(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.ConfigMap, error) {
+	configMapList := &corev1.ConfigMapList{}
+	err := c.list(ctx, corev1.Resource("configmaps"), labelSelector, allNamespaces, configMapList)
+	if err != nil {
+		return nil, err
+	}
+
+	return configMapList.Items, nil
+}
+
+func (c *kubectlClient) CreateConfigMap(ctx context.Context, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	configMap = configMap.DeepCopy()
+	configMap.TypeMeta = metav1.TypeMeta{Kind: "ConfigMap", APIVersion: corev1.SchemeGroupVersion.String()}
+
+	created := &corev1.ConfigMap{}
+	err := c.create(ctx, corev1.Resource("configmaps"), configMap.Name, configMap, created)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *kubectlClient) DeleteConfigMap(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.delete(ctx, corev1.Resource("configmaps"), name, opts)
+}
+
+func (c *kubectlClient) GetVolumeSnapshot(ctx context.Context, name string) (*volumeSnapshot, error) {
+	snapshot := &volumeSnapshot{}
+	err := c.get(ctx, volumeSnapshotResource.GroupResource(), name, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func (c *kubectlClient) ListVolumeSnapshots(ctx context.Context, labelSelector string, allNamespaces bool) ([]volumeSnapshot, error) {
+	snapshotList := &volumeSnapshotList{}
+	err := c.list(ctx, volumeSnapshotResource.GroupResource(), labelSelector, allNamespaces, snapshotList)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshotList.Items, nil
+}
+
+func (c *kubectlClient) CreateVolumeSnapshot(ctx context.Context, snapshot *volumeSnapshot) (*volumeSnapshot, error) {
+	withTypeMeta := *snapshot
+	withTypeMeta.TypeMeta = volumeSnapshotTypeMeta
+
+	created := &volumeSnapshot{}
+	err := c.create(ctx, volumeSnapshotResource.GroupResource(), snapshot.Name, &withTypeMeta, created)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *kubectlClient) DeleteVolumeSnapshot(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.delete(ctx, volumeSnapshotResource.GroupResource(), name, opts)
+}
+
+func (c *kubectlClient) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	nodeList := &corev1.NodeList{}
+	err := c.list(ctx, corev1.Resource("nodes"), "", false, nodeList)
+	if err != nil {
+		return nil, err
+	}
+
+	return nodeList.Items, nil
+}
+
+func (c *kubectlClient) GetStorageClass(ctx context.Context, name string) (*storagev1.StorageClass, error) {
+	storageClass := &storagev1.StorageClass{}
+	err := c.get(ctx, storagev1.Resource("storageclasses"), name, storageClass)
+	if err != nil {
+		return nil, err
+	}
+
+	return storageClass, nil
+}
+
+func (c *kubectlClient) ListNodePods(ctx context.Context) ([]corev1.Pod, error) {
+	args := []string{"get", "pods", "-o", "json", "--all-namespaces", "--field-selector", nodePodsFieldSelector}
+	out, err := c.buildCmd(ctx, args).Output()
+	if err != nil {
+		return nil, kubectlError(corev1.Resource("pods"), "", out, err)
+	}
+
+	podList := &corev1.PodList{}
+	err = json.Unmarshal(out, podList)
+	if err != nil {
+		return nil, perrors.Wrap(err, "unmarshal pods")
+	}
+
+	return podList.Items, nil
+}
+
+func (c *kubectlClient) ListEvents(ctx context.Context, involvedObjectName string) ([]corev1.Event, error) {
+	args := []string{"get", "events", "-o", "json", "--field-selector", "involvedObject.name=" + involvedObjectName}
+	out, err := c.buildCmd(ctx, args).Output()
+	if err != nil {
+		return nil, kubectlError(corev1.Resource("events"), "", out, err)
+	}
+
+	eventList := &corev1.EventList{}
+	err = json.Unmarshal(out, eventList)
+	if err != nil {
+		return nil, perrors.Wrap(err, "unmarshal events")
+	}
+
+	return eventList.Items, nil
+}
+
+func (c *kubectlClient) GetLease(ctx context.Context, name string) (*coordinationv1.Lease, error) {
+	lease := &coordinationv1.Lease{}
+	err := c.get(ctx, coordinationv1.Resource("leases"), name, lease)
+	if err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+func (c *kubectlClient) CreateLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	lease = lease.DeepCopy()
+	lease.TypeMeta = metav1.TypeMeta{Kind: "Lease", APIVersion: coordinationv1.SchemeGroupVersion.String()}
+
+	created := &coordinationv1.Lease{}
+	err := c.create(ctx, coordinationv1.Resource("leases"), lease.Name, lease, created)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *kubectlClient) UpdateLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	lease = lease.DeepCopy()
+	lease.TypeMeta = metav1.TypeMeta{Kind: "Lease", APIVersion: coordinationv1.SchemeGroupVersion.String()}
+
+	updated := &coordinationv1.Lease{}
+	err := c.replace(ctx, coordinationv1.Resource("leases"), lease.Name, lease, updated)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (c *kubectlClient) DeleteLease(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.delete(ctx, coordinationv1.Resource("leases"), name, opts)
+}
+
+func (c *kubectlClient) Exec(ctx context.Context, podName, container string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	args := []string{"exec", "-c", container}
+	if stdin != nil {
+		args = append(args, "-i")
+	}
+	args = append(args, podName, "--")
+	args = append(args, command...)
+
+	return c.runCommand(ctx, args, stdin, stdout, stderr)
+}
+
+func (c *kubectlClient) Logs(ctx context.Context, podName string, opts *corev1.PodLogOptions, stdout io.Writer) error {
+	args := []string{"logs", "pods/" + podName}
+	if opts != nil {
+		if opts.Container != "" {
+			args = append(args, "-c", opts.Container)
+		}
+		if opts.Follow {
+			args = append(args, "--follow")
+		}
+		if opts.Previous {
+			args = append(args, "--previous")
+		}
+		if opts.Timestamps {
+			args = append(args, "--timestamps")
+		}
+		if opts.TailLines != nil {
+			args = append(args, "--tail", strconv.FormatInt(*opts.TailLines, 10))
+		}
+		if opts.SinceSeconds != nil {
+			args = append(args, fmt.Sprintf("--since=%ds", *opts.SinceSeconds))
+		}
+		if opts.SinceTime != nil {
+			args = append(args, "--since-time", opts.SinceTime.Format(metav1.RFC3339Micro))
+		}
+	}
+
+	stderr := &bytes.Buffer{}
+	err := c.runCommand(ctx, args, nil, stdout, stderr)
+	if err != nil {
+		return kubectlError(corev1.Resource("pods"), podName, stderr.Bytes(), err)
+	}
+
+	return nil
+}
+
+func (c *kubectlClient) get(ctx context.Context, resource schema.GroupResource, name string, obj interface{}) error {
+	out, err := c.buildCmd(ctx, []string{"get", resource.String(), name, "--ignore-not-found", "-o", "json"}).Output()
+	if err != nil {
+		return kubectlError(resource, name, out, err)
+	} else if len(out) == 0 {
+		return kerrors.NewNotFound(resource, name)
+	}
+
+	err = json.Unmarshal(out, obj)
+	if err != nil {
+		return perrors.Wrapf(err, "unmarshal %s", resource.String())
+	}
+
+	return nil
+}
+
+func (c *kubectlClient) list(ctx context.Context, resource schema.GroupResource, labelSelector string, allNamespaces bool, into interface{}) error {
+	args := []string{"get", resource.String(), "-o", "json"}
+	if labelSelector != "" {
+		args = append(args, "-l", labelSelector)
+	}
+	if allNamespaces {
+		args = append(args, "--all-namespaces")
+	}
+
+	out, err := c.buildCmd(ctx, args).Output()
+	if err != nil {
+		return kubectlError(resource, "", out, err)
+	}
+
+	err = json.Unmarshal(out, into)
+	if err != nil {
+		return perrors.Wrapf(err, "unmarshal %s", resource.String())
+	}
+
+	return nil
+}
+
+func (c *kubectlClient) create(ctx context.Context, resource schema.GroupResource, name string, obj interface{}, into interface{}, extraArgs ...string) error {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	args := append([]string{"create", "-f", "-", "-o", "json"}, extraArgs...)
+	err = c.runCommand(ctx, args, bytes.NewReader(raw), stdout, stderr)
+	if err != nil {
+		return kubectlError(resource, name, stderr.Bytes(), err)
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), into)
+	if err != nil {
+		return perrors.Wrapf(err, "unmarshal %s", resource.String())
+	}
+
+	return nil
+}
+
+// replace updates the object, kubectl replace sends the resource version of obj so
+// concurrent changes fail with a conflict
+func (c *kubectlClient) replace(ctx context.Context, resource schema.GroupResource, name string, obj interface{}, into interface{}) error {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err = c.runCommand(ctx, []string{"replace", "-f", "-", "-o", "json"}, bytes.NewReader(raw), stdout, stderr)
+	if err != nil {
+		return kubectlError(resource, name, stderr.Bytes(), err)
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), into)
+	if err != nil {
+		return perrors.Wrapf(err, "unmarshal %s", resource.String())
+	}
+
+	return nil
+}
+
+func (c *kubectlClient) patch(ctx context.Context, resource schema.GroupResource, name string, patchType types.PatchType, data []byte, into interface{}) error {
+	var patchTypeArg string
+	switch patchType {
+	case types.JSONPatchType:
+		patchTypeArg = "json"
+	case types.MergePatchType:
+		patchTypeArg = "merge"
+	case types.StrategicMergePatchType:
+		patchTypeArg = "strategic"
+	default:
+		return fmt.Errorf("unsupported patch type %s", patchType)
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := c.runCommand(ctx, []string{"patch", resource.String(), name, "--type", patchTypeArg, "-p", string(data), "-o", "json"}, nil, stdout, stderr)
+	if err != nil {
+		return kubectlError(resource, name, stderr.Bytes(), err)
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), into)
+	if err != nil {
+		return perrors.Wrapf(err, "unmarshal %s", resource.String())
+	}
+
+	return nil
+}
+
+func (c *kubectlClient) delete(ctx context.Context, resource schema.GroupResource, name string, opts metav1.DeleteOptions) error {
+	args := append([]string{"delete", resource.String(), name}, deleteArgs(opts)...)
+	out, err := c.buildCmd(ctx, args).CombinedOutput()
+	if err != nil {
+		return kubectlError(resource, name, out, err)
+	}
+
+	return nil
+}
+
+func deleteArgs(opts metav1.DeleteOptions) []string {
+	args := []string{}
+	if opts.GracePeriodSeconds != nil {
+		args = append(args, "--grace-period="+strconv.FormatInt(*opts.GracePeriodSeconds, 10))
+		if *opts.GracePeriodSeconds == 0 {
+			args = append(args, "--force")
+		}
+	}
+	if opts.PropagationPolicy != nil {
+		args = append(args, "--cascade="+strings.ToLower(string(*opts.PropagationPolicy)))
+	}
+
+	return args
+}
+
+func createArgs(opts metav1.CreateOptions) []string {
+	args := []string{}
+	for _, dryRun := range opts.DryRun {
+		if dryRun == metav1.DryRunAll {
+			args = append(args, "--dry-run=server")
+		}
+	}
+
+	return args
+}
+
+// kubectlError converts the kubectl output into a typed API error if possible
+func kubectlError(resource schema.GroupResource, name string, out []byte, err error) error {
+	message := string(out)
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		message += string(exitError.Stderr)
+	}
+
+	switch {
+	case strings.Contains(message, "(NotFound)"), strings.Contains(message, "the server doesn't have a resource type"):
+		return kerrors.NewNotFound(resource, name)
+	case strings.Contains(message, "(AlreadyExists)"):
+		return kerrors.NewAlreadyExists(resource, name)
+	case strings.Contains(message, "(Conflict)"):
+		return kerrors.NewConflict(resource, name, errors.New(strings.TrimSpace(message)))
+	case strings.Contains(message, "(Forbidden)"):
+		return kerrors.NewForbidden(resource, name, errors.New(strings.TrimSpace(message)))
+	}
+
+	return command.WrapCommandError(out, err)
+}
+
+func (c *kubectlClient) buildCmd(ctx context.Context, args []string) *exec.Cmd {
+	newArgs := []string{}
+	if c.namespace != "" {
+		newArgs = append(newArgs, "--namespace", c.namespace)
+	}
+	if c.kubeConfig != "" {
+		newArgs = append(newArgs, "--kubeconfig", c.kubeConfig)
+	}
+	if c.context != "" {
+		newArgs = append(newArgs, "--context", c.context)
+	}
+	newArgs = append(newArgs, args...)
+	c.log.Debugf("Run command: %s %s", c.kubectl, strings.Join(newArgs, " "))
+	return exec.CommandContext(ctx, c.kubectl, newArgs...)
+}
+
+func (c *kubectlClient) runCommand(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	cmd := c.buildCmd(ctx, args)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
@@ -5,24 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os/exec"
-	"strings"
 
 	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
-	"github.com/loft-sh/devpod/pkg/command"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/devpod/pkg/random"
 	"github.com/loft-sh/log"
 	perrors "github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func NewKubernetesDriver(options *options.Options, log log.Logger) driver.Driver {
-	kubectl := "kubectl"
-	if options.KubectlPath != "" {
-		kubectl = options.KubectlPath
-	}
+var _ driver.Driver = &KubernetesDriver{}
 
+func NewKubernetesDriver(options *options.Options, log log.Logger) (*KubernetesDriver, error) {
 	if options.KubernetesNamespace != "" {
 		log.Debugf("Use Kubernetes Namespace '%s'", options.KubernetesNamespace)
 	}
@@ -32,113 +29,94 @@ func NewKubernetesDriver(options *options.Options, log log.Logger) driver.Driver
 	if options.KubernetesContext != "" {
 		log.Debugf("Use Kubernetes Context '%s'", options.KubernetesContext)
 	}
-	return &KubernetesDriver{
-		kubectl: kubectl,
 
-		kubeConfig: options.KubernetesConfig,
-		context:    options.KubernetesContext,
-		namespace:  options.KubernetesNamespace,
+	client, err := newClient(options, log)
+	if err != nil {
+		return nil, err
+	}
+
+	// use the namespace the client resolved from the kube config, so everything the
+	// driver derives from it matches the namespace of the api calls
+	return &KubernetesDriver{
+		client:    client,
+		namespace: client.Namespace(),
 
 		options: options,
 		Log:     log,
-	}
+	}, nil
 }
 
 type KubernetesDriver struct {
-	kubectl string
-
-	kubeConfig string
-	namespace  string
-	context    string
+	client    client
+	namespace string
 
 	options *options.Options
 	Log     log.Logger
+
+	// timing records the phases of the current run or start
+	timing *startupTiming
 }
 
 func (k *KubernetesDriver) FindDevContainer(ctx context.Context, workspaceId string) (*config.ContainerDetails, error) {
-	workspaceId = getID(workspaceId)
-
-	pvc, containerInfo, err := k.getDevContainerPvc(ctx, workspaceId)
-	if err != nil {
+	details, err := k.FindWorkspace(ctx, workspaceId)
+	if err != nil || details == nil {
 		return nil, err
 	}
 
-	return k.infoFromObject(ctx, pvc, containerInfo)
+	return details.ContainerDetails, nil
 }
 
 func (k *KubernetesDriver) getDevContainerPvc(ctx context.Context, id string) (*corev1.PersistentVolumeClaim, *DevContainerInfo, error) {
 	// try to find pvc
-	out, err := k.buildCmd(ctx, []string{"get", "pvc", id, "--ignore-not-found", "-o", "json"}).Output()
+	pvc, err := k.client.GetPersistentVolumeClaim(ctx, id)
 	if err != nil {
-		return nil, nil, command.WrapCommandError(out, err)
-	} else if len(out) == 0 {
-		return nil, nil, nil
-	}
+		if kerrors.IsNotFound(err) {
+			return nil, nil, nil
+		}
 
-	// try to unmarshal pvc
-	pvc := &corev1.PersistentVolumeClaim{}
-	err = json.Unmarshal(out, pvc)
-	if err != nil {
-		return nil, nil, perrors.Wrap(err, "unmarshal pvc")
-	} else if pvc.Annotations == nil || pvc.Annotations[DevPodInfoAnnotation] == "" {
-		return nil, nil, fmt.Errorf("pvc is missing dev container info annotation")
+		return nil, nil, perrors.Wrap(err, "get pvc")
 	}
 
-	// get container info
-	containerInfo := &DevContainerInfo{}
-	err = json.Unmarshal([]byte(pvc.GetAnnotations()[DevPodInfoAnnotation]), containerInfo)
+	containerInfo, err := devContainerInfo(pvc)
 	if err != nil {
-		return nil, nil, perrors.Wrap(err, "decode dev container info")
+		return nil, nil, err
 	}
 
 	return pvc, containerInfo, nil
 }
 
-func (k *KubernetesDriver) infoFromObject(ctx context.Context, pvc *corev1.PersistentVolumeClaim, containerInfo *DevContainerInfo) (*config.ContainerDetails, error) {
-	if pvc == nil {
-		return nil, nil
+// devContainerInfo decodes the dev container info annotation of the workspace pvc
+func devContainerInfo(pvc *corev1.PersistentVolumeClaim) (*DevContainerInfo, error) {
+	if pvc.Annotations == nil || pvc.Annotations[DevPodInfoAnnotation] == "" {
+		return nil, fmt.Errorf("pvc is missing dev container info annotation")
 	}
 
-	// check pod
-	pod, err := k.waitPodRunning(ctx, pvc.Name)
+	containerInfo := &DevContainerInfo{}
+	err := json.Unmarshal([]byte(pvc.GetAnnotations()[DevPodInfoAnnotation]), containerInfo)
 	if err != nil {
-		k.Log.Infof("Error finding pod: %v", err)
-		k.Log.Warn("If the pod does not come up automatically it is stuck in an error state. Recreate the workspace to recover from this")
-		pod = nil
-	}
-
-	// determine status
-	status := "exited"
-	if pod != nil {
-		status = "running"
+		return nil, perrors.Wrap(err, "decode dev container info")
 	}
 
-	// check started
-	startedAt := pvc.CreationTimestamp.String()
-	if pod != nil {
-		startedAt = pod.CreationTimestamp.String()
-	}
-
-	return &config.ContainerDetails{
-		ID:      pvc.Name,
-		Created: pvc.CreationTimestamp.String(),
-		State: config.ContainerDetailsState{
-			Status:    status,
-			StartedAt: startedAt,
-		},
-		Config: config.ContainerDetailsConfig{
-			Labels: config.ListToObject(containerInfo.Options.Labels),
-		},
-	}, nil
+	return containerInfo, nil
 }
 
 func (k *KubernetesDriver) StopDevContainer(ctx context.Context, workspaceId string) error {
 	workspaceId = getID(workspaceId)
 
+	return k.withLock(ctx, workspaceId, "stop", func(ctx context.Context) error {
+		return k.stopDevContainer(ctx, workspaceId)
+	})
+}
+
+func (k *KubernetesDriver) stopDevContainer(ctx context.Context, workspaceId string) error {
+	if k.options.Hibernate {
+		return k.hibernate(ctx, workspaceId)
+	}
+
 	// delete pod
-	out, err := k.buildCmd(ctx, []string{"delete", "po", workspaceId, "--ignore-not-found"}).CombinedOutput()
-	if err != nil {
-		return perrors.Wrapf(err, "delete pod: %s", string(out))
+	err := k.client.DeletePod(ctx, workspaceId, metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return perrors.Wrap(err, "delete pod")
 	}
 
 	return nil
@@ -147,6 +125,12 @@ func (k *KubernetesDriver) StopDevContainer(ctx context.Context, workspaceId str
 func (k *KubernetesDriver) DeleteDevContainer(ctx context.Context, workspaceId string) error {
 	workspaceId = getID(workspaceId)
 
+	return k.withLock(ctx, workspaceId, "delete", func(ctx context.Context) error {
+		return k.deleteDevContainer(ctx, workspaceId)
+	})
+}
+
+func (k *KubernetesDriver) deleteDevContainer(ctx context.Context, workspaceId string) error {
 	// delete pod
 	k.Log.Infof("Delete pod '%s'...", workspaceId)
 	err := k.deletePod(ctx, workspaceId)
@@ -154,19 +138,29 @@ func (k *KubernetesDriver) DeleteDevContainer(ctx context.Context, workspaceId s
 		return err
 	}
 
-	// delete pvc
+	// delete pvc, in the foreground so the objects it owns are deleted with it
 	k.Log.Infof("Delete persistent volume claim '%s'...", workspaceId)
-	out, err := k.buildCmd(ctx, []string{"delete", "pvc", workspaceId, "--ignore-not-found", "--grace-period=5"}).CombinedOutput()
+	propagationPolicy := metav1.DeletePropagationForeground
+	err = k.client.DeletePersistentVolumeClaim(ctx, workspaceId, metav1.DeleteOptions{
+		GracePeriodSeconds: &[]int64{5}[0],
+		PropagationPolicy:  &propagationPolicy,
+	})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return perrors.Wrap(err, "delete pvc")
+	}
+
+	// delete volume snapshots of a hibernated workspace
+	err = k.deleteHibernation(ctx, workspaceId)
 	if err != nil {
-		return perrors.Wrapf(err, "delete pvc: %s", string(out))
+		return err
 	}
 
 	// delete role binding & service account
 	if k.options.ClusterRole != "" {
 		k.Log.Infof("Delete role binding '%s'...", workspaceId)
-		out, err := k.buildCmd(ctx, []string{"delete", "rolebinding", workspaceId, "--ignore-not-found"}).CombinedOutput()
-		if err != nil {
-			return perrors.Wrapf(err, "delete role binding: %s", string(out))
+		err = k.client.DeleteRoleBinding(ctx, workspaceId, metav1.DeleteOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return perrors.Wrap(err, "delete role binding")
 		}
 	}
 
@@ -183,9 +177,9 @@ func (k *KubernetesDriver) DeleteDevContainer(ctx context.Context, workspaceId s
 }
 
 func (k *KubernetesDriver) deletePod(ctx context.Context, podName string) error {
-	out, err := k.buildCmd(ctx, []string{"delete", "po", podName, "--ignore-not-found", "--grace-period=10"}).CombinedOutput()
-	if err != nil {
-		return perrors.Wrapf(err, "delete pod: %s", string(out))
+	err := k.client.DeletePod(ctx, podName, metav1.DeleteOptions{GracePeriodSeconds: &[]int64{10}[0]})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return perrors.Wrap(err, "delete pod")
 	}
 
 	return nil
@@ -194,53 +188,17 @@ func (k *KubernetesDriver) deletePod(ctx context.Context, podName string) error
 func (k *KubernetesDriver) CommandDevContainer(ctx context.Context, workspaceId, user, command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
 	workspaceId = getID(workspaceId)
 
-	args := []string{"exec", "-c", "devpod"}
-	if stdin != nil {
-		args = append(args, "-i")
-	}
-	args = append(args, workspaceId)
+	// mark the processes of the command, so they can be terminated if ctx is cancelled
+	commandID := random.String(16)
+	args := []string{"env", commandIDEnv + "=" + commandID, "sh", "-c", command}
 	if user != "" && user != "root" {
-		args = append(args, "--", "su", user, "-c", command)
-	} else {
-		args = append(args, "--", "sh", "-c", command)
+		args = []string{"env", commandIDEnv + "=" + commandID, "su", user, "-c", command}
 	}
 
-	return k.runCommand(ctx, args, stdin, stdout, stderr)
-}
-
-func (k *KubernetesDriver) GetDevContainerLogs(ctx context.Context, workspaceID string, stdout io.Writer, stderr io.Writer) error {
-	workspaceID = getID(workspaceID)
-
-	args := []string{"logs", "pods/" + workspaceID, "-c", "devpod"}
-
-	return k.runCommand(ctx, args, nil, stdout, stderr)
-}
-
-func (k *KubernetesDriver) buildCmd(ctx context.Context, args []string) *exec.Cmd {
-	newArgs := []string{}
-	if k.namespace != "" {
-		newArgs = append(newArgs, "--namespace", k.namespace)
-	}
-	if k.kubeConfig != "" {
-		newArgs = append(newArgs, "--kubeconfig", k.kubeConfig)
-	}
-	if k.context != "" {
-		newArgs = append(newArgs, "--context", k.context)
+	err := k.client.Exec(ctx, workspaceId, DevContainerName, args, stdin, stdout, stderr)
+	if err != nil && ctx.Err() != nil {
+		k.terminateCommand(ctx, workspaceId, commandID)
 	}
-	newArgs = append(newArgs, args...)
-	k.Log.Debugf("Run command: %s %s", k.kubectl, strings.Join(newArgs, " "))
-	return exec.CommandContext(ctx, k.kubectl, newArgs...)
-}
-
-func (k *KubernetesDriver) runCommand(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
-	return k.runCommandWithDir(ctx, "", args, stdin, stdout, stderr)
-}
 
-func (k *KubernetesDriver) runCommandWithDir(ctx context.Context, dir string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
-	cmd := k.buildCmd(ctx, args)
-	cmd.Dir = dir
-	cmd.Stdin = stdin
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-	return cmd.Run()
+	return err
 }
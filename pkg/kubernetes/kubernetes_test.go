@@ -0,0 +1,565 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testWorkspaceID = "test"
+
+func testRunOptions() *driver.RunOptions {
+	return &driver.RunOptions{
+		UID:        "test-uid",
+		Image:      "mcr.microsoft.com/devcontainers/go",
+		Entrypoint: "/bin/sh",
+		Cmd:        []string{"-c", "sleep infinity"},
+		Labels:     []string{"dev.containers.id=test"},
+		WorkspaceMount: &config.Mount{
+			Type:   "bind",
+			Source: "/src/test",
+			Target: "/workspaces/test",
+		},
+		Mounts: []*config.Mount{
+			{
+				Type:   "volume",
+				Source: "home",
+				Target: "/home/vscode",
+			},
+		},
+	}
+}
+
+// existingWorkspace returns the pvc and running pod of an already provisioned workspace
+func existingWorkspace(t *testing.T, opts *options.Options) []runtime.Object {
+	t.Helper()
+
+	id := getID(testWorkspaceID)
+	d := newFakeCluster().driver(t, opts)
+	pvc, err := buildPersistentVolumeClaim(d.options, id, testRunOptions(), d.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pvc.Namespace = testNamespace
+	pvc.UID = types.UID("uid-" + id)
+	delete(pvc.Annotations, DevPodUninitializedAnnotation)
+
+	lastApplied, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        id,
+			Namespace:   testNamespace,
+			Labels:      map[string]string{DevPodCreatedLabel: "true", DevPodWorkspaceUIDLabel: testRunOptions().UID},
+			Annotations: map[string]string{DevPodLastAppliedAnnotation: string(lastApplied)},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: DevContainerName}},
+		},
+	}
+	podRunning(pod)
+
+	return []runtime.Object{pvc, pod}
+}
+
+func TestRunDevContainer(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"persistentvolumeclaims/devpod-test",
+		"pods/devpod-test",
+	}, cluster.created())
+
+	pvc := cluster.persistentVolumeClaim(t, "devpod-test")
+	assert.Equal(t, "true", pvc.Labels[DevPodCreatedLabel])
+	assert.Equal(t, "test-uid", pvc.Labels[DevPodWorkspaceUIDLabel])
+	assert.Equal(t, "10Gi", pvc.Spec.Resources.Requests.Storage().String())
+	assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}, pvc.Spec.AccessModes)
+
+	containerInfo := &DevContainerInfo{}
+	assert.NoError(t, json.Unmarshal([]byte(pvc.Annotations[DevPodInfoAnnotation]), containerInfo))
+	assert.Equal(t, "devpod-test", containerInfo.WorkspaceID)
+	assert.Equal(t, testRunOptions(), containerInfo.Options)
+
+	pod := cluster.pod(t, "devpod-test")
+	assert.Equal(t, "test-uid", pod.Labels[DevPodWorkspaceUIDLabel])
+	assert.Contains(t, pod.Annotations, DevPodLastAppliedAnnotation)
+	assert.Len(t, pod.Spec.InitContainers, 1)
+	assert.Equal(t, InitContainerName, pod.Spec.InitContainers[0].Name)
+	assert.Len(t, pod.Spec.Containers, 1)
+	assert.Equal(t, "mcr.microsoft.com/devcontainers/go", pod.Spec.Containers[0].Image)
+	assert.Equal(t, []corev1.Volume{{
+		Name: "devpod",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "devpod-test"},
+		},
+	}}, pod.Spec.Volumes)
+}
+
+func TestRunDevContainerReusesExistingPvc(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	cluster := newFakeCluster(objects[0])
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+
+	// volumes are only initialized on the first run
+	pod := cluster.pod(t, "devpod-test")
+	assert.Empty(t, pod.Spec.InitContainers)
+}
+
+func TestRunDevContainerWithoutOptionsAndPvc(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, nil)
+	assert.ErrorContains(t, err, "No options provided")
+	assert.Empty(t, cluster.created())
+}
+
+func TestRunDevContainerServiceAccount(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			ServiceAccount: "devpod",
+			ClusterRole:    "edit",
+		},
+	})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"persistentvolumeclaims/devpod-test",
+		"serviceaccounts/devpod",
+		"rolebindings/devpod-test",
+		"pods/devpod-test",
+	}, cluster.created())
+
+	roleBinding, err := cluster.RbacV1().RoleBindings(testNamespace).Get(context.Background(), "devpod-test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "edit"}, roleBinding.RoleRef)
+	assert.Equal(t, []rbacv1.Subject{{Kind: "ServiceAccount", Name: "devpod"}}, roleBinding.Subjects)
+	assert.Equal(t, "devpod", cluster.pod(t, "devpod-test").Spec.ServiceAccountName)
+}
+
+func TestRunDevContainerPullSecret(t *testing.T) {
+	dockerConfig := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("user:password"))
+	err := os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte(`{"auths":{"https://index.docker.io/v1/":{"auth":"`+auth+`"}}}`), 0600)
+	assert.NoError(t, err)
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			KubernetesPullSecretsEnabled: "true",
+		},
+	})
+
+	runOptions := testRunOptions()
+	runOptions.Image = "loftsh/private:latest"
+	err = d.RunDevContainer(context.Background(), testWorkspaceID, runOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"persistentvolumeclaims/devpod-test",
+		"secrets/devpod-pull-secret-devpod-test",
+		"pods/devpod-test",
+	}, cluster.created())
+
+	secret, err := cluster.CoreV1().Secrets(testNamespace).Get(context.Background(), "devpod-pull-secret-devpod-test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+	authToken, err := DecodeAuthTokenFromPullSecret(*secret, OfficialDockerRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, "user:password", authToken)
+
+	pod := cluster.pod(t, "devpod-test")
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "devpod-pull-secret-devpod-test"}}, pod.Spec.ImagePullSecrets)
+}
+
+func TestRunDevContainerOwnerReferences(t *testing.T) {
+	dockerConfig := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("user:password"))
+	err := os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte(`{"auths":{"https://index.docker.io/v1/":{"auth":"`+auth+`"}}}`), 0600)
+	assert.NoError(t, err)
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			KubernetesPullSecretsEnabled: "true",
+			ServiceAccount:               "devpod",
+			ClusterRole:                  "edit",
+		},
+	})
+
+	runOptions := testRunOptions()
+	runOptions.Image = "loftsh/private:latest"
+	err = d.RunDevContainer(context.Background(), testWorkspaceID, runOptions)
+	assert.NoError(t, err)
+
+	owner := []metav1.OwnerReference{{
+		APIVersion: "v1",
+		Kind:       "PersistentVolumeClaim",
+		Name:       "devpod-test",
+		UID:        "uid-devpod-test",
+	}}
+	assert.Equal(t, owner, cluster.pod(t, "devpod-test").OwnerReferences)
+
+	roleBinding, err := cluster.RbacV1().RoleBindings(testNamespace).Get(context.Background(), "devpod-test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, owner, roleBinding.OwnerReferences)
+
+	secret, err := cluster.CoreV1().Secrets(testNamespace).Get(context.Background(), "devpod-pull-secret-devpod-test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, owner, secret.OwnerReferences)
+
+	// the shared service account is not owned by the workspace
+	serviceAccount, err := cluster.CoreV1().ServiceAccounts(testNamespace).Get(context.Background(), "devpod", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, serviceAccount.OwnerReferences)
+}
+
+func TestStartDevContainerAdoptsExistingObjects(t *testing.T) {
+	opts := &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			ServiceAccount: "devpod",
+			ClusterRole:    "edit",
+		},
+	}
+	objects := existingWorkspace(t, opts)
+	roleBinding := buildRoleBinding("devpod-test", "devpod", "edit")
+	roleBinding.Namespace = testNamespace
+	serviceAccount := buildServiceAccount("devpod")
+	serviceAccount.Namespace = testNamespace
+	cluster := newFakeCluster(append(objects, roleBinding, serviceAccount)...)
+	d := cluster.driver(t, opts)
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Empty(t, cluster.created())
+	assert.Empty(t, cluster.deleted())
+
+	assert.Equal(t, "uid-devpod-test", string(cluster.pod(t, "devpod-test").OwnerReferences[0].UID))
+	roleBinding, err = cluster.RbacV1().RoleBindings(testNamespace).Get(context.Background(), "devpod-test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "uid-devpod-test", string(roleBinding.OwnerReferences[0].UID))
+}
+
+func TestRunDevContainerArchitectureAffinity(t *testing.T) {
+	archPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devpod-devpod-test-abcdef",
+			Namespace: testNamespace,
+			Labels:    map[string]string{DevPodWorkspaceLabel: "devpod-test"},
+		},
+	}
+	cluster := newFakeCluster(archPod)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-devpod-test-abcdef"}, cluster.deleted())
+
+	pod := cluster.pod(t, "devpod-test")
+	terms := pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	assert.Len(t, terms, 1)
+	assert.Equal(t, []string{"devpod-test"}, terms[0].LabelSelector.MatchExpressions[0].Values)
+}
+
+func TestRunDevContainerCrashLoop(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.scriptPod("devpod-test", podPending, podWaiting("ContainerCreating"), podWaiting("CrashLoopBackOff"))
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.ErrorContains(t, err, "CrashLoopBackOff")
+}
+
+func TestRunDevContainerWatchForbidden(t *testing.T) {
+	cluster := newFakeCluster()
+	watched := false
+	cluster.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		watched = true
+		return true, nil, kerrors.NewForbidden(corev1.Resource("pods"), "", errors.New("cannot watch resource \"pods\""))
+	})
+	// the pod comes up while the driver polls it
+	polls := 0
+	cluster.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !watched {
+			return false, nil, nil
+		}
+
+		polls++
+		if polls == 3 {
+			pod := cluster.pod(t, "devpod-test").DeepCopy()
+			podRunning(pod)
+			_ = cluster.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, testNamespace)
+		}
+		return false, nil, nil
+	})
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cluster.watches())
+	assert.Equal(t, corev1.PodRunning, cluster.pod(t, "devpod-test").Status.Phase)
+}
+
+func TestRunDevContainerWatchFailed(t *testing.T) {
+	cluster := newFakeCluster()
+	failed := false
+	cluster.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		if failed {
+			return false, nil, nil
+		}
+
+		// the connection drops, the driver watches again after a delay
+		failed = true
+		watcher := watch.NewRaceFreeFake()
+		watcher.Error(&kerrors.NewInternalError(errors.New("connection reset")).ErrStatus)
+		watcher.Stop()
+		return true, watcher, nil
+	})
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cluster.watches())
+}
+
+func TestStartDevContainer(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	cluster := newFakeCluster(objects[0])
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+
+	// starting again with the same options doesn't recreate the pod
+	err = d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+	assert.Empty(t, cluster.deleted())
+}
+
+func TestStartDevContainerOptionsChanged(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			Resources: "requests.cpu=1",
+		},
+	})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.deleted())
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+	assert.Equal(t, "1", cluster.pod(t, "devpod-test").Spec.Containers[0].Resources.Requests.Cpu().String())
+	assert.Equal(t, []string{"devpod-test"}, cluster.dryRuns)
+}
+
+func TestStartDevContainerOptionsChangedRejected(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	cluster.dryRunError = kerrors.NewForbidden(corev1.Resource("pods"), "devpod-test", errors.New("violates PodSecurity \"restricted:latest\": privileged"))
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			Resources: "requests.cpu=1",
+		},
+	})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.ErrorContains(t, err, "rejected the new pod spec")
+	assert.ErrorContains(t, err, "violates PodSecurity")
+	assert.Empty(t, cluster.deleted())
+	assert.Empty(t, cluster.created())
+}
+
+func TestStartDevContainerOptionsChangedQuotaExceeded(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	cluster.dryRunError = kerrors.NewForbidden(corev1.Resource("pods"), "devpod-test", errors.New("exceeded quota: compute, requested: requests.cpu=1"))
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			Resources: "requests.cpu=1",
+		},
+	})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+}
+
+func TestStartDevContainerSpecUnchanged(t *testing.T) {
+	archPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devpod-devpod-test-abcdef",
+			Namespace: testNamespace,
+			Labels:    map[string]string{DevPodWorkspaceLabel: "devpod-test"},
+		},
+	}
+	cluster := newFakeCluster(archPod)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+	cluster.ClearActions()
+
+	// neither the init container nor the architecture affinity of the first start cause a reprovision
+	err = d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Empty(t, cluster.deleted())
+	assert.Empty(t, cluster.created())
+}
+
+func TestStartDevContainerTemplateFileChanged(t *testing.T) {
+	template := filepath.Join(t.TempDir(), "pod.yaml")
+	err := os.WriteFile(template, []byte("spec:\n  nodeSelector:\n    disktype: ssd\n"), 0600)
+	assert.NoError(t, err)
+
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			PodManifestTemplate: template,
+		},
+	})
+	err = d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+	cluster.ClearActions()
+
+	err = os.WriteFile(template, []byte("spec:\n  nodeSelector:\n    disktype: hdd\n"), 0600)
+	assert.NoError(t, err)
+
+	err = d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.deleted())
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+	assert.Equal(t, map[string]string{"disktype": "hdd"}, cluster.pod(t, "devpod-test").Spec.NodeSelector)
+}
+
+func TestStartDevContainerWithoutPvc(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.ErrorContains(t, err, "not found")
+	assert.Empty(t, cluster.created())
+}
+
+func TestStopDevContainer(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.deleted())
+
+	// stopping a stopped workspace is a no-op
+	err = d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+}
+
+func TestDeleteDevContainer(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	objects = append(objects,
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "devpod-test", Namespace: testNamespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "devpod-pull-secret-devpod-test", Namespace: testNamespace}},
+	)
+	cluster := newFakeCluster(objects...)
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			ClusterRole:                  "edit",
+			KubernetesPullSecretsEnabled: "true",
+		},
+	})
+
+	err := d.DeleteDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"pods/devpod-test",
+		"persistentvolumeclaims/devpod-test",
+		"rolebindings/devpod-test",
+		"secrets/devpod-pull-secret-devpod-test",
+	}, cluster.deleted())
+	assert.Empty(t, cluster.created())
+}
+
+func TestFindDevContainer(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	d := cluster.driver(t, &options.Options{})
+
+	details, err := d.FindDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, "devpod-test", details.ID)
+	assert.Equal(t, "running", details.State.Status)
+	assert.Equal(t, map[string]string{"dev.containers.id": "test"}, details.Config.Labels)
+	assert.Empty(t, cluster.created())
+	assert.Empty(t, cluster.deleted())
+}
+
+func TestFindDevContainerNotFound(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	details, err := d.FindDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Nil(t, details)
+}
+
+func TestTargetArchitecture(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	arch, err := d.TargetArchitecture(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	// the fake API always returns "fake logs" as uname output
+	assert.Equal(t, "amd64", arch)
+
+	created := cluster.created()
+	assert.Len(t, created, 1)
+
+	pods, err := cluster.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{LabelSelector: DevPodWorkspaceLabel + "=devpod-test"})
+	assert.NoError(t, err)
+	assert.Len(t, pods.Items, 1)
+	assert.Equal(t, "pods/"+pods.Items[0].Name, created[0])
+	assert.Equal(t, "busybox:latest", pods.Items[0].Spec.Containers[0].Image)
+}
+
+func TestRunDevContainerSucceededPodDeletedOnce(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.scriptPod("devpod-test", podTerminated("Completed", 0))
+	// the pod stays around, so the driver only sees the pod it deleted
+	cluster.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	d := cluster.driver(t, &options.Options{PodTimeout: "3s"})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.ErrorContains(t, err, "timed out waiting for pod 'devpod-test' to come up")
+	// deleted once while waiting and once by the rollback
+	assert.Equal(t, []string{"pods/devpod-test", "pods/devpod-test", "persistentvolumeclaims/devpod-test"}, cluster.deleted())
+}
@@ -0,0 +1,155 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	perrors "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkspaceSummary describes a workspace found in the cluster
+type WorkspaceSummary struct {
+	Namespace    string     `json:"namespace"`
+	ID           string     `json:"id"`
+	Image        string     `json:"image,omitempty"`
+	Phase        string     `json:"phase"`
+	Node         string     `json:"node,omitempty"`
+	DiskSize     string     `json:"diskSize,omitempty"`
+	StorageClass string     `json:"storageClass,omitempty"`
+	Created      time.Time  `json:"created"`
+	LastStart    *time.Time `json:"lastStart,omitempty"`
+	DiskUsage    *DiskUsage `json:"diskUsage,omitempty"`
+}
+
+// PhaseStopped is the phase of workspaces without a pod
+const PhaseStopped = "Stopped"
+
+// ListWorkspaces returns all workspaces of this provider in the namespace of the driver
+// or across all namespaces
+func (k *KubernetesDriver) ListWorkspaces(ctx context.Context, allNamespaces bool) ([]WorkspaceSummary, error) {
+	selector := DevPodCreatedLabel + "=true"
+	pvcs, err := k.client.ListPersistentVolumeClaims(ctx, selector, allNamespaces)
+	if err != nil {
+		return nil, perrors.Wrap(err, "list persistent volume claims")
+	}
+
+	pods, err := k.client.ListPods(ctx, selector, allNamespaces)
+	if err != nil {
+		return nil, perrors.Wrap(err, "list pods")
+	}
+	podsByName := map[string]*corev1.Pod{}
+	for i, pod := range pods {
+		podsByName[pod.Namespace+"/"+pod.Name] = &pods[i]
+	}
+
+	workspaces := []WorkspaceSummary{}
+	runningPods := map[int]*corev1.Pod{}
+	for _, pvc := range pvcs {
+		workspace := WorkspaceSummary{
+			Namespace: pvc.Namespace,
+			ID:        strings.TrimPrefix(pvc.Name, "devpod-"),
+			Phase:     PhaseStopped,
+			DiskSize:  pvcSize(&pvc),
+			Created:   pvc.CreationTimestamp.Time,
+		}
+		if pvc.Spec.StorageClassName != nil {
+			workspace.StorageClass = *pvc.Spec.StorageClassName
+		}
+
+		k.summarizeAnnotations(&workspace, "pvc", &pvc.ObjectMeta)
+
+		pod := podsByName[pvc.Namespace+"/"+pvc.Name]
+		if pod != nil {
+			workspace.Phase = string(pod.Status.Phase)
+			workspace.Node = pod.Spec.NodeName
+			if pod.DeletionTimestamp != nil {
+				workspace.Phase = "Terminating"
+			} else if pod.Status.Phase == corev1.PodRunning && (!allNamespaces || pod.Namespace == k.namespace) {
+				// commands can only be run in pods of the namespace of the driver
+				runningPods[len(workspaces)] = pod
+			}
+
+			// fall back to the pod if the last start couldn't be recorded
+			if workspace.LastStart == nil || pod.CreationTimestamp.Time.After(*workspace.LastStart) {
+				workspace.LastStart = &pod.CreationTimestamp.Time
+			}
+		}
+
+		workspaces = append(workspaces, workspace)
+	}
+
+	// hibernated workspaces only have their placeholder
+	placeholders, err := k.client.ListConfigMaps(ctx, DevPodHibernationLabel, allNamespaces)
+	if err != nil {
+		k.Log.Debugf("Error listing hibernated workspaces: %v", err)
+	}
+	for _, placeholder := range placeholders {
+		workspace := WorkspaceSummary{
+			Namespace: placeholder.Namespace,
+			ID:        strings.TrimPrefix(placeholder.Name, "devpod-"),
+			Phase:     PhaseHibernated,
+			Created:   placeholder.CreationTimestamp.Time,
+		}
+
+		spec := &corev1.PersistentVolumeClaimSpec{}
+		err = json.Unmarshal([]byte(placeholder.Data[pvcSpecKey]), spec)
+		if err != nil {
+			k.Log.Debugf("Error decoding pvc spec of hibernated workspace '%s/%s': %v", placeholder.Namespace, placeholder.Name, err)
+		} else {
+			if request, ok := spec.Resources.Requests[corev1.ResourceStorage]; ok {
+				workspace.DiskSize = request.String()
+			}
+			if spec.StorageClassName != nil {
+				workspace.StorageClass = *spec.StorageClassName
+			}
+		}
+		k.summarizeAnnotations(&workspace, "hibernation placeholder", &placeholder.ObjectMeta)
+
+		workspaces = append(workspaces, workspace)
+	}
+
+	k.listDiskUsage(ctx, workspaces, runningPods)
+
+	sort.Slice(workspaces, func(i, j int) bool {
+		if workspaces[i].Namespace != workspaces[j].Namespace {
+			return workspaces[i].Namespace < workspaces[j].Namespace
+		}
+		return workspaces[i].ID < workspaces[j].ID
+	})
+
+	return workspaces, nil
+}
+
+// summarizeAnnotations sets the image and last start of the workspace from the
+// annotations of its pvc or hibernation placeholder
+func (k *KubernetesDriver) summarizeAnnotations(workspace *WorkspaceSummary, kind string, obj *metav1.ObjectMeta) {
+	containerInfo := &DevContainerInfo{}
+	err := json.Unmarshal([]byte(obj.Annotations[DevPodInfoAnnotation]), containerInfo)
+	if err != nil {
+		k.Log.Debugf("Error decoding dev container info of %s '%s/%s': %v", kind, obj.Namespace, obj.Name, err)
+	} else if containerInfo.Options != nil {
+		workspace.Image = containerInfo.Options.Image
+	}
+
+	lastStart, err := time.Parse(time.RFC3339, obj.Annotations[DevPodLastStartAnnotation])
+	if err == nil {
+		workspace.LastStart = &lastStart
+	}
+}
+
+// pvcSize returns the actual capacity of the pvc or the requested size if it isn't bound yet
+func pvcSize(pvc *corev1.PersistentVolumeClaim) string {
+	if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+		return capacity.String()
+	}
+	if request, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		return request.String()
+	}
+
+	return ""
+}
@@ -0,0 +1,87 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListWorkspaces(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	running := objects[1].(*corev1.Pod)
+	running.Spec.NodeName = "node-1"
+
+	lastStart := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	stopped := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devpod-stopped",
+			Namespace: "other",
+			Labels:    map[string]string{DevPodCreatedLabel: "true"},
+			Annotations: map[string]string{
+				DevPodInfoAnnotation:      `{"WorkspaceID":"devpod-stopped","Options":{"image":"alpine"}}`,
+				DevPodLastStartAnnotation: lastStart.Format(time.RFC3339),
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &[]string{"fast"}[0],
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("20Gi")},
+		},
+	}
+	unrelated := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "data",
+			Namespace: testNamespace,
+		},
+	}
+
+	cluster := newFakeCluster(append(objects, stopped, unrelated)...)
+	d := cluster.driver(t, &options.Options{})
+
+	workspaces, err := d.ListWorkspaces(context.Background(), false)
+	assert.NoError(t, err)
+	if assert.Len(t, workspaces, 1) {
+		assert.Equal(t, testNamespace, workspaces[0].Namespace)
+		assert.Equal(t, testWorkspaceID, workspaces[0].ID)
+		assert.Equal(t, testRunOptions().Image, workspaces[0].Image)
+		assert.Equal(t, string(corev1.PodRunning), workspaces[0].Phase)
+		assert.Equal(t, "node-1", workspaces[0].Node)
+		assert.Equal(t, "10Gi", workspaces[0].DiskSize)
+		assert.NotNil(t, workspaces[0].LastStart)
+	}
+
+	workspaces, err = d.ListWorkspaces(context.Background(), true)
+	assert.NoError(t, err)
+	if assert.Len(t, workspaces, 2) {
+		assert.Equal(t, testNamespace, workspaces[0].Namespace)
+		assert.Equal(t, WorkspaceSummary{
+			Namespace:    "other",
+			ID:           "stopped",
+			Image:        "alpine",
+			Phase:        PhaseStopped,
+			DiskSize:     "20Gi",
+			StorageClass: "fast",
+			LastStart:    &lastStart,
+		}, workspaces[1])
+	}
+}
+
+func TestRunDevContainerRecordsLastStart(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+
+	pvc := cluster.persistentVolumeClaim(t, "devpod-test")
+	lastStart, err := time.Parse(time.RFC3339, pvc.Annotations[DevPodLastStartAnnotation])
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), lastStart, time.Minute)
+}
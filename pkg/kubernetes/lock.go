@@ -0,0 +1,300 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	perrors "github.com/pkg/errors"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// DevPodLockOperationAnnotation is the driver operation the holder of a workspace lease runs
+const DevPodLockOperationAnnotation = "devpod.sh/lock-operation"
+
+const (
+	// leaseDuration is how long a lease is valid without being renewed. Holders that
+	// crashed or lost their connection are replaced once it passed.
+	leaseDuration = 30 * time.Second
+	// leaseRenewInterval is how often the holder renews its lease
+	leaseRenewInterval = leaseDuration / 3
+	// leaseAcquireAttempts is how often acquiring is retried when another caller
+	// changed the lease at the same time
+	leaseAcquireAttempts = 3
+)
+
+// lockHolder identifies this process as holder of workspace leases
+var lockHolder = defaultLockHolder()
+
+func defaultLockHolder() string {
+	username := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		username = u.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s@%s (pid %d)", username, hostname, os.Getpid())
+}
+
+// withLock runs fn while holding the lease of the workspace with the given id, so
+// concurrent run, start, stop and delete calls for the same workspace don't race each
+// other. The context passed to fn is cancelled if the lease is lost. If the lease can't
+// be used because of missing permissions fn runs without it.
+func (k *KubernetesDriver) withLock(ctx context.Context, id, operation string, fn func(ctx context.Context) error) error {
+	lease, err := k.acquireLease(ctx, id, operation)
+	if err != nil {
+		return err
+	} else if lease == nil {
+		return fn(ctx)
+	}
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	renewer := &leaseRenewer{driver: k, lease: lease}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		renewer.run(lockCtx, cancel)
+	}()
+
+	err = fn(lockCtx)
+	cancel()
+	<-done
+
+	// release even if the passed context was cancelled, otherwise the next caller
+	// has to wait until the lease expired
+	releaseCtx, releaseCancel := cleanupContext(ctx)
+	defer releaseCancel()
+	k.releaseLease(releaseCtx, renewer.current())
+
+	if err != nil && renewer.lost() != nil {
+		return perrors.Wrapf(err, "lost lock of workspace '%s'", id)
+	}
+
+	return err
+}
+
+// acquireLease creates the lease of the workspace or takes it over if its holder
+// didn't renew it in time. It returns nil if leases can't be used in the namespace.
+func (k *KubernetesDriver) acquireLease(ctx context.Context, id, operation string) (*coordinationv1.Lease, error) {
+	for i := 0; i < leaseAcquireAttempts; i++ {
+		now := metav1.NewMicroTime(time.Now())
+		lease, err := k.client.CreateLease(ctx, buildLease(id, operation, now))
+		if err == nil {
+			k.Log.Debugf("Acquired lock of workspace '%s'", id)
+			return lease, nil
+		} else if kerrors.IsForbidden(err) {
+			k.Log.Warnf("Not allowed to lock workspace '%s', continuing without lock: %v", id, err)
+			return nil, nil
+		} else if !kerrors.IsAlreadyExists(err) {
+			return nil, perrors.Wrap(err, "create lease")
+		}
+
+		existing, err := k.client.GetLease(ctx, id)
+		if err != nil {
+			if kerrors.IsNotFound(err) {
+				// released in the meantime
+				continue
+			}
+
+			return nil, perrors.Wrap(err, "get lease")
+		}
+
+		if leaseHeld(existing, now.Time) {
+			return nil, lockedError(id, existing, now.Time)
+		}
+
+		// the holder didn't renew the lease in time, take it over
+		if existing.Spec.HolderIdentity != nil && *existing.Spec.HolderIdentity != "" {
+			k.Log.Warnf("Taking over stale lock of workspace '%s' from %s", id, *existing.Spec.HolderIdentity)
+		}
+		transitions := int32(1)
+		if existing.Spec.LeaseTransitions != nil {
+			transitions = *existing.Spec.LeaseTransitions + 1
+		}
+		stolen := buildLease(id, operation, now)
+		stolen.ObjectMeta = *existing.ObjectMeta.DeepCopy()
+		if stolen.Annotations == nil {
+			stolen.Annotations = map[string]string{}
+		}
+		stolen.Annotations[DevPodLockOperationAnnotation] = operation
+		stolen.Spec.LeaseTransitions = &transitions
+		lease, err = k.client.UpdateLease(ctx, stolen)
+		if err == nil {
+			k.Log.Debugf("Acquired lock of workspace '%s'", id)
+			return lease, nil
+		} else if !kerrors.IsConflict(err) && !kerrors.IsNotFound(err) {
+			return nil, perrors.Wrap(err, "update lease")
+		}
+	}
+
+	return nil, fmt.Errorf("workspace '%s' is being modified by another caller, please try again", id)
+}
+
+// releaseLease deletes the lease if this process still holds it
+func (k *KubernetesDriver) releaseLease(ctx context.Context, lease *coordinationv1.Lease) {
+	if lease == nil {
+		return
+	}
+
+	err := k.client.DeleteLease(ctx, lease.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			UID:             &lease.UID,
+			ResourceVersion: &lease.ResourceVersion,
+		},
+	})
+	if err != nil && !kerrors.IsNotFound(err) && !kerrors.IsConflict(err) {
+		k.Log.Warnf("Error releasing lock of workspace '%s', it expires in %s: %v", lease.Name, leaseDuration, err)
+		return
+	}
+
+	k.Log.Debugf("Released lock of workspace '%s'", lease.Name)
+}
+
+// leaseRenewer keeps a lease alive until its context is cancelled
+type leaseRenewer struct {
+	driver *KubernetesDriver
+
+	m       sync.Mutex
+	lease   *coordinationv1.Lease
+	lostErr error
+}
+
+func (r *leaseRenewer) run(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		lease := r.current().DeepCopy()
+		now := metav1.NewMicroTime(time.Now())
+		lease.Spec.RenewTime = &now
+		updated, err := r.driver.client.UpdateLease(ctx, lease)
+		if err == nil {
+			r.m.Lock()
+			r.lease = updated
+			r.m.Unlock()
+			continue
+		} else if ctx.Err() != nil {
+			return
+		}
+
+		// somebody else took over or deleted the lease, stop working on the workspace
+		if kerrors.IsConflict(err) || kerrors.IsNotFound(err) {
+			r.m.Lock()
+			r.lostErr = err
+			r.lease = nil
+			r.m.Unlock()
+
+			r.driver.Log.Errorf("Lost lock of workspace '%s', aborting: %v", lease.Name, err)
+			cancel()
+			return
+		}
+
+		// retry on the next tick, the lease stays valid for a while
+		r.driver.Log.Debugf("Error renewing lock of workspace '%s': %v", lease.Name, err)
+	}
+}
+
+func (r *leaseRenewer) current() *coordinationv1.Lease {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.lease
+}
+
+func (r *leaseRenewer) lost() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.lostErr
+}
+
+func buildLease(id, operation string, now metav1.MicroTime) *coordinationv1.Lease {
+	labels := map[string]string{}
+	for k, v := range ExtraDevPodLabels {
+		labels[k] = v
+	}
+
+	holder := lockHolder
+	durationSeconds := int32(leaseDuration.Seconds())
+	return &coordinationv1.Lease{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Lease",
+			APIVersion: coordinationv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   id,
+			Labels: labels,
+			Annotations: map[string]string{
+				DevPodLockOperationAnnotation: operation,
+			},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &durationSeconds,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+}
+
+// leaseHeld returns true if the lease has a holder that renewed it in time
+func leaseHeld(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return false
+	}
+
+	return now.Before(leaseExpiry(lease))
+}
+
+func leaseExpiry(lease *coordinationv1.Lease) time.Time {
+	renewTime := lease.CreationTimestamp.Time
+	if lease.Spec.RenewTime != nil {
+		renewTime = lease.Spec.RenewTime.Time
+	} else if lease.Spec.AcquireTime != nil {
+		renewTime = lease.Spec.AcquireTime.Time
+	}
+
+	durationSeconds := int32(leaseDuration.Seconds())
+	if lease.Spec.LeaseDurationSeconds != nil {
+		durationSeconds = *lease.Spec.LeaseDurationSeconds
+	}
+
+	return renewTime.Add(time.Duration(durationSeconds) * time.Second)
+}
+
+func lockedError(id string, lease *coordinationv1.Lease, now time.Time) error {
+	operation := lease.Annotations[DevPodLockOperationAnnotation]
+	if operation == "" {
+		operation = "unknown operation"
+	}
+	since := ""
+	if lease.Spec.AcquireTime != nil {
+		since = fmt.Sprintf(" for %s", duration.HumanDuration(now.Sub(lease.Spec.AcquireTime.Time)))
+	}
+
+	return fmt.Errorf(
+		"workspace '%s' is being modified by %s (%s%s), please try again once it finished or after the lock expired in %s",
+		id,
+		*lease.Spec.HolderIdentity,
+		operation,
+		since,
+		duration.HumanDuration(leaseExpiry(lease).Sub(now)),
+	)
+}
@@ -0,0 +1,112 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testLease(holder string, renewed time.Duration) *coordinationv1.Lease {
+	acquireTime := metav1.NewMicroTime(time.Now().Add(-renewed - time.Minute))
+	renewTime := metav1.NewMicroTime(time.Now().Add(-renewed))
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devpod-test",
+			Namespace: testNamespace,
+			Annotations: map[string]string{
+				DevPodLockOperationAnnotation: "delete",
+			},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &[]int32{30}[0],
+			AcquireTime:          &acquireTime,
+			RenewTime:            &renewTime,
+			LeaseTransitions:     &[]int32{1}[0],
+		},
+	}
+}
+
+func leaseActions(cluster *fakeCluster) []string {
+	actions := []string{}
+	for _, action := range cluster.Actions() {
+		if action.GetResource().Resource == "leases" {
+			actions = append(actions, action.GetVerb())
+		}
+	}
+
+	return actions
+}
+
+func TestStartDevContainerLocksWorkspace(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"create", "delete"}, leaseActions(cluster))
+
+	lease := cluster.Actions()[0].(k8stesting.CreateAction).GetObject().(*coordinationv1.Lease)
+	assert.Equal(t, "devpod-test", lease.Name)
+	assert.Equal(t, lockHolder, *lease.Spec.HolderIdentity)
+	assert.Equal(t, "start", lease.Annotations[DevPodLockOperationAnnotation])
+
+	_, err = cluster.CoordinationV1().Leases(testNamespace).Get(context.Background(), "devpod-test", metav1.GetOptions{})
+	assert.True(t, kerrors.IsNotFound(err))
+}
+
+func TestStartDevContainerLocked(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	cluster := newFakeCluster(append(objects[:1], testLease("alice@laptop (pid 1)", 5*time.Second))...)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.ErrorContains(t, err, "workspace 'devpod-test' is being modified by alice@laptop (pid 1) (delete for ")
+	assert.Empty(t, cluster.created())
+
+	// the lease of the other holder is kept
+	lease, err := cluster.CoordinationV1().Leases(testNamespace).Get(context.Background(), "devpod-test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@laptop (pid 1)", *lease.Spec.HolderIdentity)
+}
+
+func TestStartDevContainerStealsExpiredLock(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	cluster := newFakeCluster(append(objects[:1], testLease("alice@laptop (pid 1)", time.Minute))...)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+	assert.Equal(t, []string{"create", "get", "update", "delete"}, leaseActions(cluster))
+
+	var stolen *coordinationv1.Lease
+	for _, action := range cluster.Actions() {
+		if updateAction, ok := action.(k8stesting.UpdateAction); ok && action.GetResource().Resource == "leases" {
+			stolen = updateAction.GetObject().(*coordinationv1.Lease)
+		}
+	}
+	assert.Equal(t, lockHolder, *stolen.Spec.HolderIdentity)
+	assert.Equal(t, int32(2), *stolen.Spec.LeaseTransitions)
+	assert.Equal(t, "start", stolen.Annotations[DevPodLockOperationAnnotation])
+}
+
+func TestStopDevContainerWithoutLeasePermissions(t *testing.T) {
+	cluster := newFakeCluster(existingWorkspace(t, &options.Options{})...)
+	cluster.PrependReactor("create", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, kerrors.NewForbidden(coordinationv1.Resource("leases"), "devpod-test", nil)
+	})
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StopDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.deleted())
+}
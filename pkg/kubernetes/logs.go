@@ -0,0 +1,202 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// LogOptions select the containers and the part of their logs GetWorkspaceLogs streams
+type LogOptions struct {
+	// Container is the container to stream the logs of, defaults to the dev container
+	Container string
+	// AllContainers streams the logs of all init containers, containers and sidecars of
+	// the pod with each line prefixed by the container name
+	AllContainers bool
+
+	// Follow keeps streaming new logs until the context is cancelled
+	Follow bool
+	// Previous streams the logs of the previous instance of the container, e.g. after it crashed
+	Previous bool
+	// Timestamps prefixes each line with its timestamp
+	Timestamps bool
+	// Since only streams logs newer than this duration
+	Since time.Duration
+	// Tail only streams this number of the most recent lines, all lines if negative
+	Tail int64
+}
+
+func (k *KubernetesDriver) GetDevContainerLogs(ctx context.Context, workspaceID string, stdout io.Writer, stderr io.Writer) error {
+	return k.GetWorkspaceLogs(ctx, workspaceID, &LogOptions{Tail: -1}, stdout, stderr)
+}
+
+// GetWorkspaceLogs streams the logs of the workspace pod to stdout
+func (k *KubernetesDriver) GetWorkspaceLogs(ctx context.Context, workspaceID string, opts *LogOptions, stdout io.Writer, stderr io.Writer) error {
+	id := getID(workspaceID)
+	pod, err := k.getPod(ctx, id)
+	if err != nil {
+		return err
+	} else if pod == nil {
+		return fmt.Errorf("pod '%s' not found, is the workspace running?", id)
+	}
+
+	if !opts.AllContainers {
+		container := opts.Container
+		if container == "" {
+			container = DevContainerName
+		}
+
+		err = checkLogContainer(pod, container, opts.Previous)
+		if err != nil {
+			return err
+		}
+
+		return k.client.Logs(ctx, id, podLogOptions(container, opts), stdout)
+	}
+
+	containers := []string{}
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		// only containers that restarted have previous logs
+		if opts.Previous && checkLogContainer(pod, container.Name, true) != nil {
+			continue
+		}
+
+		containers = append(containers, container.Name)
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("no container of pod '%s' restarted, there are no previous logs", id)
+	}
+
+	// logs of finished containers are streamed one after the other, followed logs never
+	// end so they are streamed at the same time
+	out := &syncWriter{writer: stdout}
+	errs := make([]error, len(containers))
+	wg := sync.WaitGroup{}
+	for i, container := range containers {
+		stream := func(i int, container string) {
+			writer := &prefixWriter{prefix: "[" + container + "] ", writer: out}
+			errs[i] = k.client.Logs(ctx, id, podLogOptions(container, opts), writer)
+			if errs[i] == nil {
+				errs[i] = writer.Flush()
+			}
+		}
+
+		if !opts.Follow {
+			stream(i, container)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, container string) {
+			defer wg.Done()
+			stream(i, container)
+		}(i, container)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("logs of container '%s': %w", containers[i], err)
+		}
+	}
+
+	return nil
+}
+
+// checkLogContainer returns an error if the pod has no container with the given name or
+// it has no previous logs because it didn't restart
+func checkLogContainer(pod *corev1.Pod, name string, previous bool) error {
+	names := []string{}
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		names = append(names, container.Name)
+	}
+	if !containsString(names, name) {
+		return fmt.Errorf("pod '%s' has no container '%s', choose one of: %s", pod.Name, name, strings.Join(names, ", "))
+	} else if !previous {
+		return nil
+	}
+
+	for _, containerStatus := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if containerStatus.Name == name && containerStatus.RestartCount > 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("container '%s' of pod '%s' didn't restart, there are no previous logs", name, pod.Name)
+}
+
+func podLogOptions(container string, opts *LogOptions) *corev1.PodLogOptions {
+	podLogOptions := &corev1.PodLogOptions{
+		Container:  container,
+		Follow:     opts.Follow,
+		Previous:   opts.Previous,
+		Timestamps: opts.Timestamps,
+	}
+	if opts.Since > 0 {
+		sinceSeconds := int64(opts.Since.Round(time.Second) / time.Second)
+		if sinceSeconds < 1 {
+			sinceSeconds = 1
+		}
+		podLogOptions.SinceSeconds = &sinceSeconds
+	}
+	if opts.Tail >= 0 {
+		tail := opts.Tail
+		podLogOptions.TailLines = &tail
+	}
+
+	return podLogOptions
+}
+
+// syncWriter serializes the writes of the containers streamed at the same time
+type syncWriter struct {
+	m      sync.Mutex
+	writer io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.writer.Write(p)
+}
+
+// prefixWriter prefixes every line with the container name and only writes complete
+// lines, so the lines of containers streamed at the same time don't interleave
+type prefixWriter struct {
+	prefix string
+	writer io.Writer
+	buffer []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	for {
+		idx := bytes.IndexByte(w.buffer, '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+
+		_, err := w.writer.Write(append([]byte(w.prefix), w.buffer[:idx+1]...))
+		if err != nil {
+			return 0, err
+		}
+		w.buffer = w.buffer[idx+1:]
+	}
+}
+
+// Flush writes the last line if it didn't end with a newline
+func (w *prefixWriter) Flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	_, err := w.writer.Write(append(append([]byte(w.prefix), w.buffer...), '\n'))
+	w.buffer = nil
+	return err
+}
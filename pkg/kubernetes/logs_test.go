@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// crashedWorkspace returns the objects of a workspace with an init container and a
+// sidecar whose dev container restarted
+func crashedWorkspace(t *testing.T) *fakeCluster {
+	t.Helper()
+
+	objects := existingWorkspace(t, &options.Options{})
+	pod := objects[1].(*corev1.Pod)
+	pod.Spec.InitContainers = []corev1.Container{{Name: InitContainerName}}
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "proxy"})
+	podRunning(pod)
+	pod.Status.ContainerStatuses[0].RestartCount = 2
+
+	return newFakeCluster(objects...)
+}
+
+func TestGetDevContainerLogs(t *testing.T) {
+	cluster := crashedWorkspace(t)
+	d := cluster.driver(t, &options.Options{})
+
+	out := &bytes.Buffer{}
+	err := d.GetDevContainerLogs(context.Background(), testWorkspaceID, out, out)
+	assert.NoError(t, err)
+	assert.Equal(t, "logs of devpod\n", out.String())
+	assert.Equal(t, []*corev1.PodLogOptions{{Container: DevContainerName}}, cluster.logs)
+}
+
+func TestGetWorkspaceLogsOptions(t *testing.T) {
+	cluster := crashedWorkspace(t)
+	d := cluster.driver(t, &options.Options{})
+
+	out := &bytes.Buffer{}
+	err := d.GetWorkspaceLogs(context.Background(), testWorkspaceID, &LogOptions{
+		Previous:   true,
+		Follow:     true,
+		Timestamps: true,
+		Since:      90 * time.Second,
+		Tail:       100,
+	}, out, out)
+	assert.NoError(t, err)
+
+	sinceSeconds, tailLines := int64(90), int64(100)
+	assert.Equal(t, []*corev1.PodLogOptions{{
+		Container:    DevContainerName,
+		Follow:       true,
+		Previous:     true,
+		Timestamps:   true,
+		SinceSeconds: &sinceSeconds,
+		TailLines:    &tailLines,
+	}}, cluster.logs)
+}
+
+func TestGetWorkspaceLogsContainer(t *testing.T) {
+	cluster := crashedWorkspace(t)
+	d := cluster.driver(t, &options.Options{})
+
+	out := &bytes.Buffer{}
+	err := d.GetWorkspaceLogs(context.Background(), testWorkspaceID, &LogOptions{Container: InitContainerName, Tail: -1}, out, out)
+	assert.NoError(t, err)
+	assert.Equal(t, "logs of devpod-init\n", out.String())
+
+	err = d.GetWorkspaceLogs(context.Background(), testWorkspaceID, &LogOptions{Container: "missing", Tail: -1}, out, out)
+	assert.EqualError(t, err, "pod 'devpod-test' has no container 'missing', choose one of: devpod-init, devpod, proxy")
+
+	err = d.GetWorkspaceLogs(context.Background(), testWorkspaceID, &LogOptions{Container: "proxy", Previous: true, Tail: -1}, out, out)
+	assert.EqualError(t, err, "container 'proxy' of pod 'devpod-test' didn't restart, there are no previous logs")
+}
+
+func TestGetWorkspaceLogsAllContainers(t *testing.T) {
+	cluster := crashedWorkspace(t)
+	d := cluster.driver(t, &options.Options{})
+
+	out := &bytes.Buffer{}
+	err := d.GetWorkspaceLogs(context.Background(), testWorkspaceID, &LogOptions{AllContainers: true, Tail: -1}, out, out)
+	assert.NoError(t, err)
+	assert.Equal(t, "[devpod-init] logs of devpod-init\n[devpod] logs of devpod\n[proxy] logs of proxy\n", out.String())
+
+	// only the dev container restarted
+	out.Reset()
+	err = d.GetWorkspaceLogs(context.Background(), testWorkspaceID, &LogOptions{AllContainers: true, Previous: true, Tail: -1}, out, out)
+	assert.NoError(t, err)
+	assert.Equal(t, "[devpod] logs of devpod\n", out.String())
+}
+
+func TestGetWorkspaceLogsStopped(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	cluster := newFakeCluster(objects[0])
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.GetWorkspaceLogs(context.Background(), testWorkspaceID, &LogOptions{Tail: -1}, &bytes.Buffer{}, &bytes.Buffer{})
+	assert.EqualError(t, err, "pod 'devpod-test' not found, is the workspace running?")
+}
+
+func TestPrefixWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	writer := &prefixWriter{prefix: "[devpod] ", writer: out}
+
+	_, err := writer.Write([]byte("first\nsec"))
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("ond\nthird"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[devpod] first\n[devpod] second\n", out.String())
+
+	assert.NoError(t, writer.Flush())
+	assert.Equal(t, "[devpod] first\n[devpod] second\n[devpod] third\n", out.String())
+}
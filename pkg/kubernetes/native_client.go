@@ -0,0 +1,424 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+
+	perrors "github.com/pkg/errors"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// nativeClient talks to the Kubernetes API directly through client-go
+type nativeClient struct {
+	clientset  k8s.Interface
+	restConfig *rest.Config
+	namespace  string
+
+	// dynamicClient talks to the APIs client-go has no types for, e.g. volume snapshots
+	dynamicClient dynamic.Interface
+}
+
+func newNativeClient(kubeConfig, kubeContext, namespace string) (*nativeClient, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeConfig != "" {
+		loadingRules.ExplicitPath = kubeConfig
+	}
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+	}
+	overrides.Context.Namespace = namespace
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, perrors.Wrap(err, "load kube config")
+	}
+
+	if namespace == "" {
+		namespace, err = kubeConfigNamespace(clientConfig, kubeContext)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clientset, err := k8s.NewForConfig(restConfig)
+	if err != nil {
+		return nil, perrors.Wrap(err, "create kubernetes client")
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, perrors.Wrap(err, "create dynamic kubernetes client")
+	}
+
+	return &nativeClient{
+		clientset:     clientset,
+		restConfig:    restConfig,
+		namespace:     namespace,
+		dynamicClient: dynamicClient,
+	}, nil
+}
+
+// kubeConfigNamespace returns the namespace of the kube config context, or
+// DefaultNamespace if the context doesn't set one
+func kubeConfigNamespace(clientConfig clientcmd.ClientConfig, kubeContext string) (string, error) {
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return "", perrors.Wrap(err, "load kube config")
+	} else if len(rawConfig.Contexts) == 0 {
+		// in-cluster config, use the namespace of the service account
+		namespace, _, err := clientConfig.Namespace()
+		if err != nil {
+			return "", perrors.Wrap(err, "get namespace from kube config")
+		}
+
+		return namespace, nil
+	}
+
+	if kubeContext == "" {
+		kubeContext = rawConfig.CurrentContext
+	}
+	if contextConfig, ok := rawConfig.Contexts[kubeContext]; ok && contextConfig.Namespace != "" {
+		return contextConfig.Namespace, nil
+	}
+
+	return DefaultNamespace, nil
+}
+
+func (c *nativeClient) Namespace() string {
+	return c.namespace
+}
+
+func (c *nativeClient) CreateNamespace(ctx context.Context, name string) error {
+	_, err := c.clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}, metav1.CreateOptions{})
+	return err
+}
+
+func (c *nativeClient) GetPod(ctx context.Context, name string) (*corev1.Pod, error) {
+	return c.clientset.CoreV1().Pods(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *nativeClient) WatchPod(ctx context.Context, name, resourceVersion string) (watch.Interface, error) {
+	return c.clientset.CoreV1().Pods(c.namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+		ResourceVersion: resourceVersion,
+	})
+}
+
+func (c *nativeClient) ListPods(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.Pod, error) {
+	podList, err := c.clientset.CoreV1().Pods(c.listNamespace(allNamespaces)).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	return podList.Items, nil
+}
+
+func (c *nativeClient) CreatePod(ctx context.Context, pod *corev1.Pod, opts metav1.CreateOptions) (*corev1.Pod, error) {
+	return c.clientset.CoreV1().Pods(c.namespace).Create(ctx, pod, opts)
+}
+
+func (c *nativeClient) PatchPod(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.Pod, error) {
+	return c.clientset.CoreV1().Pods(c.namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+}
+
+func (c *nativeClient) DeletePod(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.clientset.CoreV1().Pods(c.namespace).Delete(ctx, name, opts)
+}
+
+// DeletePods deletes the matching pods one by one like kubectl does, which only
+// needs the delete instead of the deletecollection permission
+func (c *nativeClient) DeletePods(ctx context.Context, labelSelector string, opts metav1.DeleteOptions) error {
+	pods, err := c.ListPods(ctx, labelSelector, false)
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods {
+		err = c.DeletePod(ctx, pod.Name, opts)
+		if err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *nativeClient) GetPersistentVolumeClaim(ctx context.Context, name string) (*corev1.PersistentVolumeClaim, error) {
+	return c.clientset.CoreV1().PersistentVolumeClaims(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *nativeClient) ListPersistentVolumeClaims(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.PersistentVolumeClaim, error) {
+	pvcList, err := c.clientset.CoreV1().PersistentVolumeClaims(c.listNamespace(allNamespaces)).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	return pvcList.Items, nil
+}
+
+func (c *nativeClient) CreatePersistentVolumeClaim(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error) {
+	return c.clientset.CoreV1().PersistentVolumeClaims(c.namespace).Create(ctx, pvc, metav1.CreateOptions{})
+}
+
+func (c *nativeClient) PatchPersistentVolumeClaim(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.PersistentVolumeClaim, error) {
+	return c.clientset.CoreV1().PersistentVolumeClaims(c.namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+}
+
+func (c *nativeClient) DeletePersistentVolumeClaim(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.clientset.CoreV1().PersistentVolumeClaims(c.namespace).Delete(ctx, name, opts)
+}
+
+func (c *nativeClient) GetServiceAccount(ctx context.Context, name string) (*corev1.ServiceAccount, error) {
+	return c.clientset.CoreV1().ServiceAccounts(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *nativeClient) ListServiceAccounts(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.ServiceAccount, error) {
+	serviceAccountList, err := c.clientset.CoreV1().ServiceAccounts(c.listNamespace(allNamespaces)).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	return serviceAccountList.Items, nil
+}
+
+func (c *nativeClient) CreateServiceAccount(ctx context.Context, serviceAccount *corev1.ServiceAccount) (*corev1.ServiceAccount, error) {
+	return c.clientset.CoreV1().ServiceAccounts(c.namespace).Create(ctx, serviceAccount, metav1.CreateOptions{})
+}
+
+func (c *nativeClient) DeleteServiceAccount(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.clientset.CoreV1().ServiceAccounts(c.namespace).Delete(ctx, name, opts)
+}
+
+func (c *nativeClient) GetRoleBinding(ctx context.Context, name string) (*rbacv1.RoleBinding, error) {
+	return c.clientset.RbacV1().RoleBindings(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *nativeClient) ListRoleBindings(ctx context.Context, labelSelector string, allNamespaces bool) ([]rbacv1.RoleBinding, error) {
+	roleBindingList, err := c.clientset.RbacV1().RoleBindings(c.listNamespace(allNamespaces)).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	return roleBindingList.Items, nil
+}
+
+func (c *nativeClient) CreateRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding) (*rbacv1.RoleBinding, error) {
+	return c.clientset.RbacV1().RoleBindings(c.namespace).Create(ctx, roleBinding, metav1.CreateOptions{})
+}
+
+func (c *nativeClient) PatchRoleBinding(ctx context.Context, name string, patchType types.PatchType, data []byte) (*rbacv1.RoleBinding, error) {
+	return c.clientset.RbacV1().RoleBindings(c.namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+}
+
+func (c *nativeClient) DeleteRoleBinding(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.clientset.RbacV1().RoleBindings(c.namespace).Delete(ctx, name, opts)
+}
+
+func (c *nativeClient) GetSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	return c.clientset.CoreV1().Secrets(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *nativeClient) ListSecrets(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.Secret, error) {
+	secretList, err := c.clientset.CoreV1().Secrets(c.listNamespace(allNamespaces)).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	return secretList.Items, nil
+}
+
+func (c *nativeClient) CreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	return c.clientset.CoreV1().Secrets(c.namespace).Create(ctx, secret, metav1.CreateOptions{})
+}
+
+func (c *nativeClient) PatchSecret(ctx context.Context, name string, patchType types.PatchType, data []byte) (*corev1.Secret, error) {
+	return c.clientset.CoreV1().Secrets(c.namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{})
+}
+
+func (c *nativeClient) DeleteSecret(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.clientset.CoreV1().Secrets(c.namespace).Delete(ctx, name, opts)
+}
+
+func (c *nativeClient) GetConfigMap(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+	return c.clientset.CoreV1().ConfigMaps(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *nativeClient) ListConfigMaps(ctx context.Context, labelSelector string, allNamespaces bool) ([]corev1.ConfigMap, error) {
+	configMapList, err := c.clientset.CoreV1().ConfigMaps(c.listNamespace(allNamespaces)).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	return configMapList.Items, nil
+}
+
+func (c *nativeClient) CreateConfigMap(ctx context.Context, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	return c.clientset.CoreV1().ConfigMaps(c.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+}
+
+func (c *nativeClient) DeleteConfigMap(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.clientset.CoreV1().ConfigMaps(c.namespace).Delete(ctx, name, opts)
+}
+
+func (c *nativeClient) GetVolumeSnapshot(ctx context.Context, name string) (*volumeSnapshot, error) {
+	obj, err := c.dynamicClient.Resource(volumeSnapshotResource).Namespace(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return volumeSnapshotFromUnstructured(obj)
+}
+
+func (c *nativeClient) ListVolumeSnapshots(ctx context.Context, labelSelector string, allNamespaces bool) ([]volumeSnapshot, error) {
+	list, err := c.dynamicClient.Resource(volumeSnapshotResource).Namespace(c.listNamespace(allNamespaces)).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []volumeSnapshot{}
+	for i := range list.Items {
+		snapshot, err := volumeSnapshotFromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	return snapshots, nil
+}
+
+func (c *nativeClient) CreateVolumeSnapshot(ctx context.Context, snapshot *volumeSnapshot) (*volumeSnapshot, error) {
+	obj, err := volumeSnapshotToUnstructured(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err = c.dynamicClient.Resource(volumeSnapshotResource).Namespace(c.namespace).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return volumeSnapshotFromUnstructured(obj)
+}
+
+func (c *nativeClient) DeleteVolumeSnapshot(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.dynamicClient.Resource(volumeSnapshotResource).Namespace(c.namespace).Delete(ctx, name, opts)
+}
+
+func (c *nativeClient) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	nodeList, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return nodeList.Items, nil
+}
+
+func (c *nativeClient) GetStorageClass(ctx context.Context, name string) (*storagev1.StorageClass, error) {
+	return c.clientset.StorageV1().StorageClasses().Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *nativeClient) ListNodePods(ctx context.Context) ([]corev1.Pod, error) {
+	podList, err := c.clientset.CoreV1().Pods(c.listNamespace(true)).List(ctx, metav1.ListOptions{
+		FieldSelector: nodePodsFieldSelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return podList.Items, nil
+}
+
+func (c *nativeClient) ListEvents(ctx context.Context, involvedObjectName string) ([]corev1.Event, error) {
+	eventList, err := c.clientset.CoreV1().Events(c.namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.name", involvedObjectName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return eventList.Items, nil
+}
+
+func (c *nativeClient) GetLease(ctx context.Context, name string) (*coordinationv1.Lease, error) {
+	return c.clientset.CoordinationV1().Leases(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *nativeClient) CreateLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	return c.clientset.CoordinationV1().Leases(c.namespace).Create(ctx, lease, metav1.CreateOptions{})
+}
+
+func (c *nativeClient) UpdateLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	return c.clientset.CoordinationV1().Leases(c.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+}
+
+func (c *nativeClient) DeleteLease(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.clientset.CoordinationV1().Leases(c.namespace).Delete(ctx, name, opts)
+}
+
+func (c *nativeClient) Exec(ctx context.Context, podName, container string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(c.namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(c.restConfig, "POST", req.URL())
+	if err != nil {
+		return perrors.Wrap(err, "create executor")
+	}
+
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
+
+func (c *nativeClient) Logs(ctx context.Context, podName string, opts *corev1.PodLogOptions, stdout io.Writer) error {
+	stream, err := c.clientset.CoreV1().Pods(c.namespace).GetLogs(podName, opts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	_, err = io.Copy(stdout, stream)
+	return err
+}
+
+// listNamespace returns the namespace to list objects in, the empty namespace lists
+// across all namespaces
+func (c *nativeClient) listNamespace(allNamespaces bool) string {
+	if allNamespaces {
+		return metav1.NamespaceAll
+	}
+
+	return c.namespace
+}
@@ -0,0 +1,66 @@
+package kubernetes
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pvcOwnerReference returns an owner reference to the workspace pvc, so the other objects of
+// the workspace get garbage collected with it. It returns nil if the pvc wasn't created yet.
+func pvcOwnerReference(pvc *corev1.PersistentVolumeClaim) *metav1.OwnerReference {
+	if pvc == nil || pvc.UID == "" {
+		return nil
+	}
+
+	return &metav1.OwnerReference{
+		APIVersion: corev1.SchemeGroupVersion.String(),
+		Kind:       "PersistentVolumeClaim",
+		Name:       pvc.Name,
+		UID:        pvc.UID,
+	}
+}
+
+// setOwnerReference adds the owner reference to the object if it doesn't have it yet
+func setOwnerReference(obj metav1.Object, owner *metav1.OwnerReference) {
+	if owner == nil || hasOwnerReference(obj, owner) {
+		return
+	}
+
+	obj.SetOwnerReferences(append(obj.GetOwnerReferences(), *owner))
+}
+
+func hasOwnerReference(obj metav1.Object, owner *metav1.OwnerReference) bool {
+	for _, ownerReference := range obj.GetOwnerReferences() {
+		if ownerReference.UID == owner.UID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// adopt adds the owner reference to an object that was created before the provider set
+// owner references. Failing to adopt isn't fatal, the object is then only cleaned up by
+// DeleteDevContainer or gc.
+func (k *KubernetesDriver) adopt(resource string, obj metav1.Object, owner *metav1.OwnerReference, patch func(data []byte) error) {
+	if owner == nil || hasOwnerReference(obj, owner) {
+		return
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": append(obj.GetOwnerReferences(), *owner),
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	k.Log.Debugf("Adopt %s/%s by persistent volume claim '%s'", resource, obj.GetName(), owner.Name)
+	err = patch(data)
+	if err != nil {
+		k.Log.Warnf("Error adding owner reference to %s/%s: %v", resource, obj.GetName(), err)
+	}
+}
@@ -2,35 +2,50 @@ package kubernetes
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	"github.com/loft-sh/devpod-provider-kubernetes/pkg/docker"
+	"github.com/loft-sh/log"
 	perrors "github.com/pkg/errors"
 	k8sv1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 func (k *KubernetesDriver) EnsurePullSecret(
 	ctx context.Context,
 	pullSecretName string,
 	dockerImage string,
+	owner *metav1.OwnerReference,
+) (bool, error) {
+	return k.ensurePullSecret(ctx, pullSecretName, dockerImage, owner, nil)
+}
+
+func (k *KubernetesDriver) ensurePullSecret(
+	ctx context.Context,
+	pullSecretName string,
+	dockerImage string,
+	owner *metav1.OwnerReference,
+	created *createdObjects,
 ) (bool, error) {
 	k.Log.Debugf("Ensure pull secrets")
 
-	host, err := GetRegistryFromImageName(dockerImage)
+	dockerCredentials, err := getPullSecretCredentials(dockerImage, k.Log)
 	if err != nil {
-		return false, fmt.Errorf("get registry from image name: %w", err)
-	}
-
-	dockerCredentials, err := docker.GetAuthConfig(host)
-	if err != nil || dockerCredentials == nil || dockerCredentials.Username == "" || dockerCredentials.Secret == "" {
-		k.Log.Debugf("Couldn't retrieve credentials for registry: %s", host)
+		return false, err
+	} else if dockerCredentials == nil {
 		return false, nil
 	}
 
-	if k.secretExists(ctx, pullSecretName) {
-		if !k.shouldRecreateSecret(ctx, dockerCredentials, pullSecretName, host) {
+	secret, err := k.client.GetSecret(ctx, pullSecretName)
+	if err == nil {
+		if !k.shouldRecreateSecret(ctx, dockerCredentials, pullSecretName, dockerCredentials.ServerURL) {
 			k.Log.Debugf("Pull secret '%s' already exists and is up to date", pullSecretName)
+			k.adopt("secrets", secret, owner, func(data []byte) error {
+				_, err := k.client.PatchSecret(ctx, pullSecretName, types.MergePatchType, data)
+				return err
+			})
 			return true, nil
 		}
 
@@ -41,57 +56,54 @@ func (k *KubernetesDriver) EnsurePullSecret(
 		}
 	}
 
-	err = k.createPullSecret(ctx, pullSecretName, dockerCredentials)
+	err = k.createPullSecret(ctx, pullSecretName, dockerCredentials, owner)
 	if err != nil {
 		return false, err
 	}
+	created.add("secrets", pullSecretName, func(ctx context.Context) error {
+		return k.client.DeleteSecret(ctx, pullSecretName, metav1.DeleteOptions{})
+	})
 
 	k.Log.Infof("Pull secret '%s' created", pullSecretName)
 	return true, nil
 }
 
+// getPullSecretCredentials returns the local docker credentials for the registry of the
+// given image or nil if there are none
+func getPullSecretCredentials(dockerImage string, log log.Logger) (*docker.Credentials, error) {
+	host, err := GetRegistryFromImageName(dockerImage)
+	if err != nil {
+		return nil, fmt.Errorf("get registry from image name: %w", err)
+	}
+
+	dockerCredentials, err := docker.GetAuthConfig(host)
+	if err != nil || dockerCredentials == nil || dockerCredentials.Username == "" || dockerCredentials.Secret == "" {
+		log.Debugf("Couldn't retrieve credentials for registry: %s", host)
+		return nil, nil
+	}
+
+	return dockerCredentials, nil
+}
+
 func (k *KubernetesDriver) ReadSecretContents(
 	ctx context.Context,
 	pullSecretName string,
 	host string,
 ) (string, error) {
-	args := []string{
-		"get",
-		"secret",
-		pullSecretName,
-		"-o", "json",
-	}
-
-	out, err := k.buildCmd(ctx, args).CombinedOutput()
-	if err != nil {
-		return "", perrors.Wrapf(err, "delete pull secret: %s", string(out))
-	}
-
-	var secret k8sv1.Secret
-	err = json.Unmarshal(out, &secret)
+	secret, err := k.client.GetSecret(ctx, pullSecretName)
 	if err != nil {
-		return "", perrors.Wrap(err, "unmarshal secret")
+		return "", perrors.Wrap(err, "get pull secret")
 	}
 
-	return DecodeAuthTokenFromPullSecret(secret, host)
+	return DecodeAuthTokenFromPullSecret(*secret, host)
 }
 
 func (k *KubernetesDriver) DeletePullSecret(
 	ctx context.Context,
 	pullSecretName string) error {
-	if !k.secretExists(ctx, pullSecretName) {
-		return nil
-	}
-
-	args := []string{
-		"delete",
-		"secret",
-		pullSecretName,
-	}
-
-	out, err := k.buildCmd(ctx, args).CombinedOutput()
-	if err != nil {
-		return perrors.Wrapf(err, "delete pull secret: %s", string(out))
+	err := k.client.DeleteSecret(ctx, pullSecretName, metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return perrors.Wrap(err, "delete pull secret")
 	}
 
 	return nil
@@ -105,50 +117,47 @@ func (k *KubernetesDriver) shouldRecreateSecret(ctx context.Context, dockerCrede
 	return existingAuthToken != dockerCredentials.AuthToken()
 }
 
-func (k *KubernetesDriver) secretExists(
+func (k *KubernetesDriver) createPullSecret(
 	ctx context.Context,
 	pullSecretName string,
-) bool {
-	args := []string{
-		"get",
-		"secret",
-		pullSecretName,
+	dockerCredentials *docker.Credentials,
+	owner *metav1.OwnerReference,
+) error {
+	secret, err := buildPullSecret(pullSecretName, dockerCredentials)
+	if err != nil {
+		return err
 	}
+	setOwnerReference(secret, owner)
 
-	_, err := k.buildCmd(ctx, args).CombinedOutput()
+	_, err = k.client.CreateSecret(ctx, secret)
 	if err != nil {
-		return false
+		return perrors.Wrap(err, "create pull secret")
 	}
-	return true
-}
 
-func (k *KubernetesDriver) createPullSecret(
-	ctx context.Context,
-	pullSecretName string,
-	dockerCredentials *docker.Credentials,
-) error {
+	return nil
+}
 
+func buildPullSecret(pullSecretName string, dockerCredentials *docker.Credentials) (*k8sv1.Secret, error) {
 	authToken := dockerCredentials.AuthToken()
 	email := "noreply@loft.sh"
 
 	encodedSecretData, err := PreparePullSecretData(dockerCredentials.ServerURL, authToken, email)
 	if err != nil {
-		return perrors.Wrap(err, "prepare pull secret data")
-	}
-
-	args := []string{
-		"create",
-		"secret",
-		"generic",
-		pullSecretName,
-		"--type", string(k8sv1.SecretTypeDockerConfigJson),
-		"--from-literal", encodedSecretData,
-	}
-
-	out, err := k.buildCmd(ctx, args).CombinedOutput()
-	if err != nil {
-		return perrors.Wrapf(err, "create pull secret: %s", string(out))
-	}
-
-	return nil
+		return nil, perrors.Wrap(err, "prepare pull secret data")
+	}
+
+	return &k8sv1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: k8sv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   pullSecretName,
+			Labels: ExtraDevPodLabels,
+		},
+		Type: k8sv1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			k8sv1.DockerConfigJsonKey: encodedSecretData,
+		},
+	}, nil
 }
@@ -1,14 +1,17 @@
 package kubernetes
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 
+	optionspkg "github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
 	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/log"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -17,47 +20,57 @@ func (k *KubernetesDriver) createPersistentVolumeClaim(
 	ctx context.Context,
 	id string,
 	options *driver.RunOptions,
-) error {
-	pvcString, err := k.buildPersistentVolumeClaim(id, options)
+) (*corev1.PersistentVolumeClaim, error) {
+	pvc, err := buildPersistentVolumeClaim(k.options, id, options, k.Log)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	err = k.sizeFromDataSource(ctx, pvc)
+	if err != nil {
+		return nil, err
 	}
 
 	k.Log.Infof("Create Persistent Volume Claim '%s'", id)
-	buf := &bytes.Buffer{}
-	err = k.runCommand(ctx, []string{"create", "-f", "-"}, strings.NewReader(pvcString), buf, buf)
+	pvc, err = k.client.CreatePersistentVolumeClaim(ctx, pvc)
 	if err != nil {
-		return errors.Wrapf(err, "create pvc: %s", buf.String())
+		return nil, withHint(errors.Wrap(err, "create pvc"))
 	}
 
-	return nil
+	return pvc, nil
 }
 
-func (k *KubernetesDriver) buildPersistentVolumeClaim(
+func buildPersistentVolumeClaim(
+	opts *optionspkg.Options,
 	id string,
 	options *driver.RunOptions,
-) (string, error) {
-	containerInfo, err := k.getDevContainerInformation(id, options)
+	log log.Logger,
+) (*corev1.PersistentVolumeClaim, error) {
+	containerInfo, err := getDevContainerInformation(id, options)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	size := "10Gi"
-	if k.options.DiskSize != "" {
-		size = k.options.DiskSize
+	if opts.DiskSize != "" {
+		size = opts.DiskSize
 	}
 	quantity, err := resource.ParseQuantity(size)
 	if err != nil {
-		return "", errors.Wrapf(err, "parse persistent volume size '%s'", size)
+		return nil, errors.Wrapf(err, "parse persistent volume size '%s'", size)
 	}
 
 	var storageClassName *string
-	if k.options.StorageClass != "" {
-		storageClassName = &k.options.StorageClass
+	if opts.StorageClass != "" {
+		storageClassName = &opts.StorageClass
+	}
+	dataSource, err := parseDataSource(opts.PvcDataSource)
+	if err != nil {
+		return nil, err
 	}
 	accessMode := []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
-	if k.options.PvcAccessMode != "" {
-		switch k.options.PvcAccessMode {
+	if opts.PvcAccessMode != "" {
+		switch opts.PvcAccessMode {
 		case "RWO":
 			accessMode = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
 		case "ROX":
@@ -79,9 +92,10 @@ func (k *KubernetesDriver) buildPersistentVolumeClaim(
 
 	annotations := map[string]string{}
 	annotations[DevPodInfoAnnotation] = containerInfo
-	extraAnnotations, err := parseLabels(k.options.PvcAnnotations)
+	annotations[DevPodUninitializedAnnotation] = "true"
+	extraAnnotations, err := parseLabels(opts.PvcAnnotations)
 	if err != nil {
-		k.Log.Error("Failed to parse annotations from PVC_ANNOTATIONS option: %v", err)
+		log.Errorf("Failed to parse annotations from PVC_ANNOTATIONS option: %v", err)
 	}
 	for k, v := range extraAnnotations {
 		annotations[k] = v
@@ -99,7 +113,7 @@ func (k *KubernetesDriver) buildPersistentVolumeClaim(
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			AccessModes: accessMode,
-			Resources: corev1.ResourceRequirements{
+			Resources: corev1.VolumeResourceRequirements{
 				Requests: map[corev1.ResourceName]resource.Quantity{
 					corev1.ResourceStorage: quantity,
 				},
@@ -107,16 +121,92 @@ func (k *KubernetesDriver) buildPersistentVolumeClaim(
 			StorageClassName: storageClassName,
 		},
 	}
+	if dataSource != nil {
+		// the api server requires both to match, older clusters only read dataSource
+		pvc.Spec.DataSource = dataSource
+		pvc.Spec.DataSourceRef = &corev1.TypedObjectReference{
+			APIGroup: dataSource.APIGroup,
+			Kind:     dataSource.Kind,
+			Name:     dataSource.Name,
+		}
+	}
 
-	raw, err := json.Marshal(pvc)
-	if err != nil {
-		return "", err
+	return pvc, nil
+}
+
+// parseDataSource parses the PVC_DATA_SOURCE option, which names the pvc or volume
+// snapshot new workspace volumes are populated from as pvc/<name> or snapshot/<name>
+func parseDataSource(str string) (*corev1.TypedLocalObjectReference, error) {
+	if str == "" {
+		return nil, nil
+	}
+
+	kind, name, found := strings.Cut(str, "/")
+	if !found || name == "" {
+		return nil, fmt.Errorf("invalid PVC_DATA_SOURCE '%s', expected pvc/<name> or snapshot/<name>", str)
 	}
 
-	return string(raw), nil
+	switch strings.ToLower(kind) {
+	case "pvc", "persistentvolumeclaim":
+		return &corev1.TypedLocalObjectReference{
+			Kind: "PersistentVolumeClaim",
+			Name: name,
+		}, nil
+	case "snapshot", "volumesnapshot":
+		apiGroup := volumeSnapshotResource.Group
+		return &corev1.TypedLocalObjectReference{
+			APIGroup: &apiGroup,
+			Kind:     volumeSnapshotTypeMeta.Kind,
+			Name:     name,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid PVC_DATA_SOURCE '%s', the kind must be pvc or snapshot", str)
+}
+
+// sizeFromDataSource checks that the data source of the pvc can be used and raises the
+// size of the pvc to the size of the source, as a volume can't be populated from a
+// larger one
+func (k *KubernetesDriver) sizeFromDataSource(ctx context.Context, pvc *corev1.PersistentVolumeClaim) error {
+	dataSource := pvc.Spec.DataSource
+	if dataSource == nil {
+		return nil
+	}
+
+	var size *resource.Quantity
+	if dataSource.Kind == volumeSnapshotTypeMeta.Kind {
+		snapshot, err := k.getReadyVolumeSnapshot(ctx, dataSource.Name)
+		if err != nil {
+			return errors.Wrap(err, "PVC_DATA_SOURCE")
+		} else if snapshot.Status != nil {
+			size = snapshot.Status.RestoreSize
+		}
+	} else {
+		source, err := k.client.GetPersistentVolumeClaim(ctx, dataSource.Name)
+		if kerrors.IsNotFound(err) {
+			return fmt.Errorf("PVC_DATA_SOURCE: persistent volume claim '%s' not found", dataSource.Name)
+		} else if err != nil {
+			return errors.Wrap(err, "get pvc of PVC_DATA_SOURCE")
+		}
+
+		if capacity, ok := source.Status.Capacity[corev1.ResourceStorage]; ok {
+			size = &capacity
+		} else if request, ok := source.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			size = &request
+		}
+	}
+
+	request := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if size != nil && request.Cmp(*size) < 0 {
+		k.Log.Infof("Raise the size of persistent volume claim '%s' to %s, the size of its data source %s '%s'", pvc.Name, size.String(), dataSource.Kind, dataSource.Name)
+		requestAtLeast(pvc, *size)
+	}
+
+	k.Log.Infof("Populate persistent volume claim '%s' from %s '%s'", pvc.Name, dataSource.Kind, dataSource.Name)
+	return nil
 }
 
-func (k *KubernetesDriver) getDevContainerInformation(
+func getDevContainerInformation(
 	id string,
 	options *driver.RunOptions,
 ) (string, error) {
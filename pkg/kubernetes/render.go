@@ -0,0 +1,375 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/log"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// WorkspaceManifests are the objects the driver creates for a workspace
+type WorkspaceManifests struct {
+	Pod                   *corev1.Pod
+	PersistentVolumeClaim *corev1.PersistentVolumeClaim
+	ServiceAccount        *corev1.ServiceAccount
+	RoleBinding           *rbacv1.RoleBinding
+	PullSecret            *corev1.Secret
+}
+
+// Objects returns all manifests in the order they need to be created
+func (m *WorkspaceManifests) Objects() []runtime.Object {
+	objects := []runtime.Object{}
+	if m.ServiceAccount != nil {
+		objects = append(objects, m.ServiceAccount)
+	}
+	if m.RoleBinding != nil {
+		objects = append(objects, m.RoleBinding)
+	}
+	if m.PullSecret != nil {
+		objects = append(objects, m.PullSecret)
+	}
+	if m.PersistentVolumeClaim != nil {
+		objects = append(objects, m.PersistentVolumeClaim)
+	}
+	if m.Pod != nil {
+		objects = append(objects, m.Pod)
+	}
+
+	return objects
+}
+
+// RenderOptions hold the cluster state the rendered manifests depend on
+type RenderOptions struct {
+	// Namespace is the namespace the workspace is created in
+	Namespace string
+	// Initialize adds the init container that copies the volume mounts into the workspace volume
+	Initialize bool
+	// PullSecret is the name of the image pull secret, if one was created
+	PullSecret string
+	// ArchDetectionPod is true if an architecture detection pod for this workspace exists
+	ArchDetectionPod bool
+	// Owner is the reference to the workspace pvc, if it exists already
+	Owner *metav1.OwnerReference
+}
+
+// podTemplate returns the pod from POD_MANIFEST_TEMPLATE or the default pod template
+func podTemplate(opts *options.Options) (*corev1.Pod, error) {
+	if len(opts.PodManifestTemplate) > 0 {
+		return getPodTemplate(opts.PodManifestTemplate)
+	}
+
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}, nil
+}
+
+// RenderWorkspace builds the pod and persistent volume claim of the workspace with the given id.
+// It does not talk to the cluster, everything it depends on is passed in.
+func RenderWorkspace(
+	opts *options.Options,
+	id string,
+	runOptions *driver.RunOptions,
+	template *corev1.Pod,
+	renderOptions RenderOptions,
+	log log.Logger,
+) (*WorkspaceManifests, error) {
+	pvc, err := buildPersistentVolumeClaim(opts, id, runOptions, log)
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := buildPod(opts, id, runOptions, template, renderOptions, log)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := &WorkspaceManifests{
+		Pod:                   pod,
+		PersistentVolumeClaim: pvc,
+	}
+	if opts.ServiceAccount != "" {
+		manifests.ServiceAccount = buildServiceAccount(opts.ServiceAccount)
+		if opts.ClusterRole != "" {
+			manifests.RoleBinding = buildRoleBinding(id, opts.ServiceAccount, opts.ClusterRole)
+			setOwnerReference(manifests.RoleBinding, renderOptions.Owner)
+		}
+	}
+
+	return manifests, nil
+}
+
+// RenderDevContainer renders the manifests RunDevContainer would create for a new
+// workspace without talking to the cluster. The pull secret is built from the local
+// docker credentials.
+func RenderDevContainer(
+	opts *options.Options,
+	workspaceId string,
+	runOptions *driver.RunOptions,
+	log log.Logger,
+) (*WorkspaceManifests, error) {
+	if runOptions == nil {
+		return nil, fmt.Errorf("no run options provided for workspace '%s'", workspaceId)
+	}
+	id := getID(workspaceId)
+
+	template, err := podTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pullSecret, err := renderPullSecret(opts, id, runOptions.Image, log)
+	if err != nil {
+		return nil, err
+	}
+
+	renderOptions := RenderOptions{
+		Namespace:  opts.KubernetesNamespace,
+		Initialize: true,
+	}
+	if pullSecret != nil {
+		renderOptions.PullSecret = pullSecret.Name
+	}
+	manifests, err := RenderWorkspace(opts, id, runOptions, template, renderOptions, log)
+	if err != nil {
+		return nil, err
+	}
+	manifests.PullSecret = pullSecret
+
+	for _, obj := range manifests.Objects() {
+		obj.(metav1.Object).SetNamespace(opts.KubernetesNamespace)
+	}
+
+	return manifests, nil
+}
+
+// WriteManifests writes the objects as multi-document yaml
+func WriteManifests(w io.Writer, objects ...runtime.Object) error {
+	for i, obj := range objects {
+		raw, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			_, err = w.Write([]byte("---\n"))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = w.Write(raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func buildPod(
+	opts *options.Options,
+	id string,
+	runOptions *driver.RunOptions,
+	template *corev1.Pod,
+	renderOptions RenderOptions,
+	log log.Logger,
+) (*corev1.Pod, error) {
+	// get workspace mount
+	if runOptions.WorkspaceMount == nil || runOptions.WorkspaceMount.Target == "" {
+		return nil, fmt.Errorf("workspace mount target is empty")
+	}
+	mount := *runOptions.WorkspaceMount
+	if opts.WorkspaceVolumeMount != "" {
+		// Ensure workspace volume mount option is parent or same dir as workspace mount
+		rel, err := filepath.Rel(opts.WorkspaceVolumeMount, mount.Target)
+		if err != nil {
+			log.Warn("Relative filepath: %v", err)
+		} else if strings.HasPrefix(rel, "..") {
+			log.Warnf("Workspace volume mount needs to be the same as the workspace mount or a parent, skipping option. WorkspaceVolumeMount: %s, MountTarget: %s", opts.WorkspaceVolumeMount, mount.Target)
+		} else {
+			mount.Target = opts.WorkspaceVolumeMount
+			log.Debugf("Using workspace volume mount: %s", opts.WorkspaceVolumeMount)
+		}
+	}
+
+	// don't modify the passed in template
+	pod := template.DeepCopy()
+
+	// get init containers
+	initContainers, err := getInitContainers(opts, runOptions, pod, renderOptions.Initialize, log)
+	if err != nil {
+		return nil, errors.Wrap(err, "build init container")
+	}
+
+	// loop over volume mounts
+	volumeMounts := []corev1.VolumeMount{getVolumeMount(0, &mount)}
+	for idx, mount := range runOptions.Mounts {
+		volumeMount := getVolumeMount(idx+1, mount)
+		if mount.Type == "bind" || mount.Type == "volume" {
+			volumeMounts = append(volumeMounts, volumeMount)
+		} else {
+			log.Warnf("Unsupported mount type '%s' in mount '%s', will skip", mount.Type, mount.String())
+		}
+	}
+
+	// capabilities
+	var capabilities *corev1.Capabilities
+	if len(runOptions.CapAdd) > 0 {
+		capabilities = &corev1.Capabilities{}
+		for _, cap := range runOptions.CapAdd {
+			capabilities.Add = append(capabilities.Add, corev1.Capability(cap))
+		}
+	}
+
+	// env vars, sorted so the rendered pod is stable
+	envVars := []corev1.EnvVar{}
+	for k, v := range runOptions.Env {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  k,
+			Value: v,
+		})
+	}
+	sort.Slice(envVars, func(i, j int) bool {
+		return envVars[i].Name < envVars[j].Name
+	})
+
+	// labels
+	labels, err := getLabels(pod, opts.Labels)
+	if err != nil {
+		return nil, err
+	}
+	labels[DevPodWorkspaceUIDLabel] = runOptions.UID
+
+	// node selector
+	nodeSelector, err := getNodeSelector(pod, opts.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	// parse resources
+	resources := corev1.ResourceRequirements{}
+	if len(pod.Spec.Containers) > 0 {
+		resources = pod.Spec.Containers[0].Resources
+	}
+	if opts.Resources != "" {
+		resources = parseResources(opts.Resources, log)
+	}
+
+	// set configuration before creating the pod
+	lastAppliedConfigRaw, err := json.Marshal(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal last applied config")
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[DevPodLastAppliedAnnotation] = string(lastAppliedConfigRaw)
+
+	pod.TypeMeta = metav1.TypeMeta{
+		Kind:       "Pod",
+		APIVersion: corev1.SchemeGroupVersion.String(),
+	}
+	pod.ObjectMeta.Name = id
+	pod.ObjectMeta.Labels = labels
+	setOwnerReference(pod, renderOptions.Owner)
+
+	pod.Spec.ServiceAccountName = opts.ServiceAccount
+	pod.Spec.NodeSelector = nodeSelector
+	pod.Spec.InitContainers = initContainers
+	pod.Spec.Containers = getContainers(pod, runOptions.Image, runOptions.Entrypoint, runOptions.Cmd, envVars, volumeMounts, capabilities, resources, runOptions.Privileged, opts.DangerouslyOverrideImage, opts.StrictSecurity)
+	pod.Spec.Volumes = getVolumes(pod, id)
+
+	if renderOptions.PullSecret != "" {
+		pod.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: renderOptions.PullSecret}}
+	}
+
+	// hash the spec before adding the affinity to the architecture detection pod, which is only
+	// there on the first start
+	specHashes, err := podSpecHashes(pod)
+	if err != nil {
+		return nil, errors.Wrap(err, "hash pod spec")
+	}
+	specHashesRaw, err := json.Marshal(specHashes)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal pod spec hash")
+	}
+	pod.Annotations[DevPodSpecHashAnnotation] = string(specHashesRaw)
+
+	if renderOptions.ArchDetectionPod && opts.NodeSelector == "" {
+		// ensure we have a pod affinity, and in that case we have, just add ours
+		if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAffinity == nil {
+			if pod.Spec.Affinity == nil {
+				pod.Spec.Affinity = &corev1.Affinity{}
+			}
+			pod.Spec.Affinity.PodAffinity = &corev1.PodAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{},
+			}
+		}
+
+		// append our affinity term
+		pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+			corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{
+							Key:      DevPodWorkspaceLabel,
+							Operator: metav1.LabelSelectorOpIn,
+							Values:   []string{id},
+						},
+					},
+				},
+				Namespaces:  []string{renderOptions.Namespace},
+				TopologyKey: "kubernetes.io/hostname",
+			})
+	}
+
+	return pod, nil
+}
+
+// renderPullSecret builds the pull secret of the workspace from the local docker
+// credentials, or returns nil if pull secrets are disabled or there are no credentials
+func renderPullSecret(opts *options.Options, id, image string, log log.Logger) (*corev1.Secret, error) {
+	if opts.KubernetesPullSecretsEnabled != "true" {
+		return nil, nil
+	}
+
+	dockerCredentials, err := getPullSecretCredentials(image, log)
+	if err != nil || dockerCredentials == nil {
+		return nil, err
+	}
+
+	return buildPullSecret(getPullSecretsName(id), dockerCredentials)
+}
+
+// RedactPullSecret returns a copy of the pull secret without the registry credentials
+func RedactPullSecret(secret *corev1.Secret) *corev1.Secret {
+	if secret == nil {
+		return nil
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data = nil
+	secret.StringData = map[string]string{
+		corev1.DockerConfigJsonKey: redacted,
+	}
+
+	return secret
+}
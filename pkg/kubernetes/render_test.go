@@ -0,0 +1,312 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	"github.com/loft-sh/devpod/pkg/driver"
+	"github.com/loft-sh/log"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+const testPodTemplate = `
+metadata:
+  labels:
+    team: platform
+spec:
+  nodeSelector:
+    disktype: ssd
+  securityContext:
+    runAsUser: 1000
+  initContainers:
+  - name: devpod-init
+    env:
+    - name: FROM_TEMPLATE
+      value: "true"
+  - name: setup
+    image: busybox
+  containers:
+  - name: devpod
+    imagePullPolicy: Always
+    env:
+    - name: FROM_TEMPLATE
+      value: "true"
+    securityContext:
+      runAsNonRoot: true
+      runAsUser: 1000
+    resources:
+      limits:
+        memory: 1Gi
+    volumeMounts:
+    - name: cache
+      mountPath: /cache
+  - name: sidecar
+    image: nginx
+  volumes:
+  - name: cache
+    emptyDir: {}
+`
+
+func TestRenderWorkspace(t *testing.T) {
+	testCases := []struct {
+		name          string
+		options       options.ComparableOptions
+		runOptions    func(runOptions *driver.RunOptions)
+		renderOptions RenderOptions
+	}{
+		{
+			name:          "default",
+			options:       options.ComparableOptions{},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name:          "no-initialize",
+			options:       options.ComparableOptions{},
+			renderOptions: RenderOptions{Initialize: false},
+		},
+		{
+			name: "template",
+			options: options.ComparableOptions{
+				PodManifestTemplate: testPodTemplate,
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name: "template-no-initialize",
+			options: options.ComparableOptions{
+				PodManifestTemplate: testPodTemplate,
+			},
+			renderOptions: RenderOptions{Initialize: false},
+		},
+		{
+			name: "strict-security",
+			options: options.ComparableOptions{
+				StrictSecurity: true,
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name: "strict-security-template",
+			options: options.ComparableOptions{
+				PodManifestTemplate: testPodTemplate,
+				StrictSecurity:      true,
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name: "workspace-volume-mount",
+			options: options.ComparableOptions{
+				WorkspaceVolumeMount: "/workspaces",
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name: "workspace-volume-mount-not-parent",
+			options: options.ComparableOptions{
+				WorkspaceVolumeMount: "/other",
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name:    "arch-detection-affinity",
+			options: options.ComparableOptions{},
+			renderOptions: RenderOptions{
+				Initialize:       true,
+				ArchDetectionPod: true,
+			},
+		},
+		{
+			name: "arch-detection-node-selector",
+			options: options.ComparableOptions{
+				NodeSelector: "kubernetes.io/arch=arm64",
+			},
+			renderOptions: RenderOptions{
+				Initialize:       true,
+				ArchDetectionPod: true,
+			},
+		},
+		{
+			name:    "pull-secret",
+			options: options.ComparableOptions{},
+			renderOptions: RenderOptions{
+				Initialize: true,
+				PullSecret: getPullSecretsName(getID(testWorkspaceID)),
+			},
+		},
+		{
+			name: "owner",
+			options: options.ComparableOptions{
+				ServiceAccount: "devpod",
+				ClusterRole:    "edit",
+			},
+			renderOptions: RenderOptions{
+				Initialize: true,
+				Owner: &metav1.OwnerReference{
+					APIVersion: "v1",
+					Kind:       "PersistentVolumeClaim",
+					Name:       getID(testWorkspaceID),
+					UID:        "uid-devpod-test",
+				},
+			},
+		},
+		{
+			name: "service-account",
+			options: options.ComparableOptions{
+				ServiceAccount: "devpod",
+				ClusterRole:    "edit",
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name: "options",
+			options: options.ComparableOptions{
+				Resources:       "requests.cpu=500m,limits.memory=2Gi",
+				HelperResources: "requests.cpu=100m",
+				Labels:          "team=backend",
+				NodeSelector:    "disktype=ssd",
+				DiskSize:        "20Gi",
+				StorageClass:    "fast",
+				PvcAccessMode:   "RWX",
+				PvcAnnotations:  "backup=true",
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name: "override-image",
+			options: options.ComparableOptions{
+				DangerouslyOverrideImage: "ubuntu:22.04",
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+		{
+			name:    "run-options",
+			options: options.ComparableOptions{},
+			runOptions: func(runOptions *driver.RunOptions) {
+				runOptions.Env = map[string]string{"B": "2", "A": "1"}
+				runOptions.CapAdd = []string{"SYS_PTRACE"}
+				runOptions.Privileged = &[]bool{true}[0]
+				runOptions.Mounts = append(runOptions.Mounts,
+					&config.Mount{Type: "bind", Source: "/tmp", Target: "/tmp"},
+					&config.Mount{Type: "tmpfs", Target: "/run"},
+				)
+			},
+			renderOptions: RenderOptions{Initialize: true},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			runOptions := testRunOptions()
+			if testCase.runOptions != nil {
+				testCase.runOptions(runOptions)
+			}
+			testCase.renderOptions.Namespace = testNamespace
+
+			opts := &options.Options{ComparableOptions: testCase.options}
+			template, err := podTemplate(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			manifests, err := RenderWorkspace(opts, getID(testWorkspaceID), runOptions, template, testCase.renderOptions, log.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, filepath.Join("testdata", "render", testCase.name+".yaml"), manifests.Objects()...)
+		})
+	}
+}
+
+func TestRenderWorkspaceEmptyMount(t *testing.T) {
+	runOptions := testRunOptions()
+	runOptions.WorkspaceMount = &config.Mount{}
+
+	_, err := RenderWorkspace(&options.Options{}, getID(testWorkspaceID), runOptions, &corev1.Pod{}, RenderOptions{}, log.Discard)
+	assert.EqualError(t, err, "workspace mount target is empty")
+}
+
+func TestRenderWorkspaceDoesNotModifyTemplate(t *testing.T) {
+	opts := &options.Options{ComparableOptions: options.ComparableOptions{PodManifestTemplate: testPodTemplate}}
+	template, err := podTemplate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := template.DeepCopy()
+
+	_, err = RenderWorkspace(opts, getID(testWorkspaceID), testRunOptions(), template, RenderOptions{Initialize: true, ArchDetectionPod: true}, log.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, original, template)
+}
+
+func TestRenderDevContainer(t *testing.T) {
+	dockerConfig := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("user:password"))
+	err := os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte(`{"auths":{"https://index.docker.io/v1/":{"auth":"`+auth+`"}}}`), 0600)
+	assert.NoError(t, err)
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+
+	opts := &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			KubernetesPullSecretsEnabled: "true",
+			ServiceAccount:               "devpod",
+		},
+		KubernetesNamespace: testNamespace,
+	}
+	runOptions := testRunOptions()
+	runOptions.Image = "loftsh/private:latest"
+
+	manifests, err := RenderDevContainer(opts, testWorkspaceID, runOptions, log.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, filepath.Join("testdata", "render", "devcontainer.yaml"), manifests.Objects()...)
+}
+
+func TestRenderDevContainerWithoutRunOptions(t *testing.T) {
+	_, err := RenderDevContainer(&options.Options{}, testWorkspaceID, nil, log.Discard)
+	assert.EqualError(t, err, "no run options provided for workspace 'test'")
+}
+
+// assertGolden compares the objects as multi-document yaml to the golden file,
+// run the tests with -update to rewrite it
+func assertGolden(t *testing.T, path string, objects ...runtime.Object) {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	err := WriteManifests(out, objects...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, out.Bytes(), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file, run with -update to create it: %v", err)
+	}
+	assert.Equal(t, string(golden), out.String(), "rendered manifests differ from %s, run with -update if the change is intended", path)
+}
@@ -0,0 +1,61 @@
+package kubernetes
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// createdObjects tracks the objects a run created while initializing a workspace, so
+// they can be deleted again if the run fails. All methods are no-ops on a nil tracker.
+type createdObjects struct {
+	objects []createdObject
+}
+
+type createdObject struct {
+	resource string
+	name     string
+	delete   func(ctx context.Context) error
+}
+
+func (c *createdObjects) add(resource, name string, delete func(ctx context.Context) error) {
+	if c == nil {
+		return
+	}
+
+	c.objects = append(c.objects, createdObject{
+		resource: resource,
+		name:     name,
+		delete:   delete,
+	})
+}
+
+// rollback deletes the created objects in the reverse order they were created. The
+// workspace pvc is created first and deleted last, if it can't be deleted it keeps the
+// uninitialized annotation and the next run initializes the volume again.
+func (k *KubernetesDriver) rollback(ctx context.Context, created *createdObjects) {
+	if created == nil || len(created.objects) == 0 {
+		return
+	}
+
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	k.Log.Infof("Rolling back the objects created by the failed run...")
+	for i := len(created.objects) - 1; i >= 0; i-- {
+		obj := created.objects[i]
+		err := obj.delete(ctx)
+		if err != nil && !kerrors.IsNotFound(err) {
+			k.Log.Warnf("Error deleting %s/%s, please delete it manually: %v", obj.resource, obj.name, err)
+			continue
+		}
+
+		k.Log.Debugf("Deleted %s/%s", obj.resource, obj.name)
+	}
+}
+
+// pvcInitialized returns false if the workspace volume wasn't seeded by a successful run yet
+func pvcInitialized(pvc *corev1.PersistentVolumeClaim) bool {
+	return pvc.Annotations[DevPodUninitializedAnnotation] != "true"
+}
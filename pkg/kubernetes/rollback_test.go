@@ -0,0 +1,119 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// uninitializedWorkspace returns the pvc of a workspace whose first run failed
+func uninitializedWorkspace(t *testing.T) *corev1.PersistentVolumeClaim {
+	t.Helper()
+
+	pvc := existingWorkspace(t, &options.Options{})[0].(*corev1.PersistentVolumeClaim)
+	pvc.Annotations[DevPodUninitializedAnnotation] = "true"
+	return pvc
+}
+
+func TestRunDevContainerMarksVolumeInitialized(t *testing.T) {
+	cluster := newFakeCluster()
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+
+	pvc := cluster.persistentVolumeClaim(t, "devpod-test")
+	assert.NotContains(t, pvc.Annotations, DevPodUninitializedAnnotation)
+	assert.True(t, pvcInitialized(pvc))
+}
+
+func TestRunDevContainerRollsBackOnFailure(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.scriptPod("devpod-test", podPending, podWaiting("CrashLoopBackOff"))
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			ServiceAccount: "devpod",
+			ClusterRole:    "edit",
+		},
+	})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.ErrorContains(t, err, "CrashLoopBackOff")
+	assert.Equal(t, []string{
+		"pods/devpod-test",
+		"rolebindings/devpod-test",
+		"serviceaccounts/devpod",
+		"persistentvolumeclaims/devpod-test",
+	}, cluster.deleted())
+}
+
+func TestRunDevContainerRollbackKeepsExistingObjects(t *testing.T) {
+	serviceAccount := buildServiceAccount("devpod")
+	serviceAccount.Namespace = testNamespace
+	cluster := newFakeCluster(serviceAccount)
+	cluster.scriptPod("devpod-test", podPending, podWaiting("CrashLoopBackOff"))
+	d := cluster.driver(t, &options.Options{
+		ComparableOptions: options.ComparableOptions{
+			ServiceAccount: "devpod",
+		},
+	})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"pods/devpod-test",
+		"persistentvolumeclaims/devpod-test",
+	}, cluster.deleted())
+}
+
+func TestRunDevContainerInitializesAfterFailedRollback(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.scriptPod("devpod-test", podPending, podWaiting("CrashLoopBackOff"))
+	cluster.PrependReactor("delete", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, kerrors.NewForbidden(corev1.Resource("persistentvolumeclaims"), "devpod-test", nil)
+	})
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.Error(t, err)
+	assert.False(t, pvcInitialized(cluster.persistentVolumeClaim(t, "devpod-test")))
+
+	// the next run seeds the volume again
+	err = d.RunDevContainer(context.Background(), testWorkspaceID, nil)
+	assert.NoError(t, err)
+	pod := cluster.pod(t, "devpod-test")
+	assert.Len(t, pod.Spec.InitContainers, 1)
+	assert.Equal(t, InitContainerName, pod.Spec.InitContainers[0].Name)
+	assert.True(t, pvcInitialized(cluster.persistentVolumeClaim(t, "devpod-test")))
+}
+
+func TestRunDevContainerUninitializedKeepsPvcOnFailure(t *testing.T) {
+	cluster := newFakeCluster(uninitializedWorkspace(t))
+	cluster.scriptPod("devpod-test", podPending, podWaiting("CrashLoopBackOff"))
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, nil)
+	assert.Error(t, err)
+
+	// only the objects of this attempt are rolled back
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.deleted())
+	assert.False(t, pvcInitialized(cluster.persistentVolumeClaim(t, "devpod-test")))
+}
+
+func TestStartDevContainerInitializesUninitializedPvc(t *testing.T) {
+	cluster := newFakeCluster(uninitializedWorkspace(t))
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+
+	pod := cluster.pod(t, "devpod-test")
+	assert.Len(t, pod.Spec.InitContainers, 1)
+	assert.True(t, pvcInitialized(cluster.persistentVolumeClaim(t, "devpod-test")))
+}
@@ -1,20 +1,21 @@
 package kubernetes
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	optionspkg "github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
 	"github.com/loft-sh/devpod/pkg/devcontainer/config"
 	"github.com/loft-sh/devpod/pkg/driver"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 const DevContainerName = "devpod"
@@ -27,6 +28,11 @@ const (
 
 	DevPodInfoAnnotation        = "devpod.sh/info"
 	DevPodLastAppliedAnnotation = "devpod.sh/last-applied-configuration"
+	DevPodSpecHashAnnotation    = "devpod.sh/spec-hash"
+	DevPodLastStartAnnotation   = "devpod.sh/last-start"
+	// DevPodUninitializedAnnotation marks workspace pvcs whose volume wasn't seeded by
+	// the init container yet, it is removed once the first pod is running
+	DevPodUninitializedAnnotation = "devpod.sh/uninitialized"
 )
 
 var ExtraDevPodLabels = map[string]string{
@@ -44,35 +50,66 @@ func (k *KubernetesDriver) RunDevContainer(
 	options *driver.RunOptions,
 ) error {
 	workspaceId = getID(workspaceId)
+	k.timing = newStartupTiming(workspaceId, "run")
 
 	// namespace
 	if k.namespace != "" && k.options.CreateNamespace == "true" {
 		k.Log.Debugf("Create namespace '%s'", k.namespace)
-		buf := &bytes.Buffer{}
-		err := k.runCommand(ctx, []string{"create", "ns", k.namespace}, nil, buf, buf)
+		stop := k.timing.track(phaseNamespace)
+		err := k.client.CreateNamespace(ctx, k.namespace)
+		stop()
 		if err != nil {
-			k.Log.Debugf("Error creating namespace: %s%v", buf.String(), err)
+			k.Log.Debugf("Error creating namespace: %v", err)
 		}
 	}
 
+	err := k.withLock(ctx, workspaceId, "run", func(ctx context.Context) error {
+		return k.runDevContainer(ctx, workspaceId, options)
+	})
+	if err != nil {
+		return err
+	}
+
+	k.reportStartupTiming()
+	return nil
+}
+
+func (k *KubernetesDriver) runDevContainer(ctx context.Context, workspaceId string, options *driver.RunOptions) error {
 	// check if persistent volume claim already exists
 	initialize := false
 	pvc, containerInfo, err := k.getDevContainerPvc(ctx, workspaceId)
 	if err != nil {
 		return err
+	} else if pvc == nil {
+		pvc, containerInfo, err = k.restoreWorkspace(ctx, workspaceId)
+		if err != nil {
+			return err
+		}
 	}
 
+	// objects created while initializing the workspace are deleted again if the run fails
+	var created *createdObjects
 	if pvc == nil {
 		if options == nil {
 			return fmt.Errorf("No options provided and no persistent volume claim found for workspace '%s'", workspaceId)
 		}
 
 		// create persistent volume claim
-		err = k.createPersistentVolumeClaim(ctx, workspaceId, options)
+		created = &createdObjects{}
+		stop := k.timing.track(phaseVolume)
+		pvc, err = k.createPersistentVolumeClaim(ctx, workspaceId, options)
+		stop()
 		if err != nil {
 			return err
 		}
+		created.add("persistentvolumeclaims", pvc.Name, func(ctx context.Context) error {
+			return k.client.DeletePersistentVolumeClaim(ctx, pvc.Name, metav1.DeleteOptions{})
+		})
 
+		initialize = true
+	} else if !pvcInitialized(pvc) {
+		k.Log.Infof("The volume of workspace '%s' wasn't initialized by the previous run, initializing it again", workspaceId)
+		created = &createdObjects{}
 		initialize = true
 	}
 
@@ -81,193 +118,95 @@ func (k *KubernetesDriver) RunDevContainer(
 		options = containerInfo.Options
 	}
 
+	// existing volumes grow with DISK_SIZE
+	pvc, err = k.expandPersistentVolumeClaim(ctx, pvc)
+	if err != nil {
+		return err
+	}
+
 	// create dev container
-	err = k.runContainer(ctx, workspaceId, options, initialize)
+	err = k.runContainer(ctx, workspaceId, pvc, options, initialize, created)
+	if err != nil {
+		k.rollback(ctx, created)
+		return err
+	}
+
+	err = k.waitFileSystemResized(ctx, pvc)
 	if err != nil {
 		return err
 	}
 
+	k.reportDiskUsage(ctx, workspaceId)
 	return nil
 }
 
 func (k *KubernetesDriver) runContainer(
 	ctx context.Context,
 	id string,
+	pvc *corev1.PersistentVolumeClaim,
 	options *driver.RunOptions,
 	initialize bool,
+	created *createdObjects,
 ) (err error) {
-	// get workspace mount
-	mount := options.WorkspaceMount
-	if mount.Target == "" {
-		return fmt.Errorf("workspace mount target is empty")
-	}
-	if k.options.WorkspaceVolumeMount != "" {
-		// Ensure workspace volume mount option is parent or same dir as workspace mount
-		rel, err := filepath.Rel(k.options.WorkspaceVolumeMount, mount.Target)
-		if err != nil {
-			k.Log.Warn("Relative filepath: %v", err)
-		} else if strings.HasPrefix(rel, "..") {
-			k.Log.Warnf("Workspace volume mount needs to be the same as the workspace mount or a parent, skipping option. WorkspaceVolumeMount: %s, MountTarget: %s", k.options.WorkspaceVolumeMount, mount.Target)
-		} else {
-			mount.Target = k.options.WorkspaceVolumeMount
-			k.Log.Debugf("Using workspace volume mount: %s", k.options.WorkspaceVolumeMount)
-		}
-	}
+	// the other objects of the workspace are owned by the pvc
+	owner := pvcOwnerReference(pvc)
 
 	// read pod template
-	pod := &corev1.Pod{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Pod",
-			APIVersion: corev1.SchemeGroupVersion.String(),
-		},
-		Spec: corev1.PodSpec{
-			RestartPolicy: corev1.RestartPolicyNever,
-		},
-	}
 	if len(k.options.PodManifestTemplate) > 0 {
 		k.Log.Debugf("trying to get pod template manifest from %s", k.options.PodManifestTemplate)
-		pod, err = getPodTemplate(k.options.PodManifestTemplate)
-		if err != nil {
-			return err
-		}
 	}
-
-	// get init containers
-	initContainers, err := k.getInitContainers(options, pod, initialize)
+	template, err := podTemplate(k.options)
 	if err != nil {
-		return errors.Wrap(err, "build init container")
-	}
-
-	// loop over volume mounts
-	volumeMounts := []corev1.VolumeMount{getVolumeMount(0, mount)}
-	for idx, mount := range options.Mounts {
-		volumeMount := getVolumeMount(idx+1, mount)
-		if mount.Type == "bind" || mount.Type == "volume" {
-			volumeMounts = append(volumeMounts, volumeMount)
-		} else {
-			k.Log.Warnf("Unsupported mount type '%s' in mount '%s', will skip", mount.Type, mount.String())
-		}
-	}
-
-	// capabilities
-	var capabilities *corev1.Capabilities
-	if len(options.CapAdd) > 0 {
-		capabilities = &corev1.Capabilities{}
-		for _, cap := range options.CapAdd {
-			capabilities.Add = append(capabilities.Add, corev1.Capability(cap))
-		}
-	}
-
-	// env vars
-	envVars := []corev1.EnvVar{}
-	for k, v := range options.Env {
-		envVars = append(envVars, corev1.EnvVar{
-			Name:  k,
-			Value: v,
-		})
+		return err
 	}
 
 	// service account
-	serviceAccount := ""
 	if k.options.ServiceAccount != "" {
-		serviceAccount = k.options.ServiceAccount
-
 		// create service account
-		err = k.createServiceAccount(ctx, id, serviceAccount)
+		err = k.createServiceAccount(ctx, id, k.options.ServiceAccount, owner, created)
 		if err != nil {
 			return fmt.Errorf("create service account: %w", err)
 		}
 	}
 
-	// labels
-	labels, err := getLabels(pod, k.options.Labels)
-	if err != nil {
-		return err
-	}
-	labels[DevPodWorkspaceUIDLabel] = options.UID
-
-	// node selector
-	nodeSelector, err := getNodeSelector(pod, k.options.NodeSelector)
-	if err != nil {
-		return err
-	}
-
-	// parse resources
-	resources := corev1.ResourceRequirements{}
-	if len(pod.Spec.Containers) > 0 {
-		resources = pod.Spec.Containers[0].Resources
-	}
-	if k.options.Resources != "" {
-		resources = parseResources(k.options.Resources, k.Log)
-	}
-
 	// ensure pull secrets
-	pullSecretsCreated := false
+	pullSecret := ""
 	if k.options.KubernetesPullSecretsEnabled == "true" {
-		pullSecretsCreated, err = k.EnsurePullSecret(ctx, getPullSecretsName(id), options.Image)
+		stop := k.timing.track(phasePullSecret)
+		pullSecretsCreated, err := k.ensurePullSecret(ctx, getPullSecretsName(id), options.Image, owner, created)
+		stop()
 		if err != nil {
 			return err
+		} else if pullSecretsCreated {
+			pullSecret = getPullSecretsName(id)
 		}
 	}
 
-	// create the pod manifest
-	pod.ObjectMeta.Name = id
-	pod.ObjectMeta.Labels = labels
-
-	pod.Spec.ServiceAccountName = serviceAccount
-	pod.Spec.NodeSelector = nodeSelector
-	pod.Spec.InitContainers = initContainers
-	pod.Spec.Containers = getContainers(pod, options.Image, options.Entrypoint, options.Cmd, envVars, volumeMounts, capabilities, resources, options.Privileged, k.options.DangerouslyOverrideImage, k.options.StrictSecurity)
-	pod.Spec.Volumes = getVolumes(pod, id)
-
 	affinity := false
-	stdout := &bytes.Buffer{}
-	stderr := &bytes.Buffer{}
-	affinityPodID := ""
-
-	err = k.runCommand(ctx, []string{"get", "pods", "-o=name", "-l", DevPodWorkspaceLabel + "=" + id}, nil, stdout, stderr)
+	archDetectionPods, err := k.client.ListPods(ctx, DevPodWorkspaceLabel+"="+id, false)
 	if err != nil {
-		k.Log.Debugf("skipping finding cluster architecture: %s %s %w", stdout.String(), stderr.String(), err)
+		k.Log.Debugf("skipping finding cluster architecture: %v", err)
 	}
-	if stdout.String() != "" {
-		affinityPodID = strings.TrimSpace(stdout.String())
+	if len(archDetectionPods) > 0 {
 		affinity = true
-	}
-
-	if affinity && k.options.NodeSelector == "" {
-		k.Log.Infof("Found architecture detecting pod: %s, using PodAffinity...", affinityPodID)
-
-		// ensure we have a pod affinity, and in that case we have, just add ours
-		if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAffinity == nil {
-			if pod.Spec.Affinity == nil {
-				pod.Spec.Affinity = &corev1.Affinity{}
-			}
-			pod.Spec.Affinity.PodAffinity = &corev1.PodAffinity{
-				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{},
-			}
+		k.timing.addArchDetection(&archDetectionPods[0])
+		if k.options.NodeSelector == "" {
+			k.Log.Infof("Found architecture detecting pod: %s, using PodAffinity...", archDetectionPods[0].Name)
 		}
-
-		// append our affinity term
-		pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
-			pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
-			corev1.PodAffinityTerm{
-				LabelSelector: &metav1.LabelSelector{
-					MatchExpressions: []metav1.LabelSelectorRequirement{
-						{
-							Key:      DevPodWorkspaceLabel,
-							Operator: metav1.LabelSelectorOpIn,
-							Values:   []string{id},
-						},
-					},
-				},
-				Namespaces:  []string{k.namespace},
-				TopologyKey: "kubernetes.io/hostname",
-			})
 	}
 
-	if k.options.KubernetesPullSecretsEnabled == "true" && pullSecretsCreated {
-		pod.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: getPullSecretsName(id)}}
+	// create the pod manifest
+	manifests, err := RenderWorkspace(k.options, id, options, template, RenderOptions{
+		Namespace:        k.namespace,
+		Initialize:       initialize,
+		PullSecret:       pullSecret,
+		ArchDetectionPod: affinity,
+		Owner:            owner,
+	}, k.Log)
+	if err != nil {
+		return err
 	}
+	pod := manifests.Pod
 
 	// try to get existing pod
 	existingPod, err := k.getPod(ctx, id)
@@ -275,28 +214,57 @@ func (k *KubernetesDriver) runContainer(
 		return errors.Wrapf(err, "get pod: %s", id)
 	}
 
-	if existingPod != nil {
-		existingOptions := &optionspkg.Options{}
-		err := json.Unmarshal([]byte(existingPod.GetAnnotations()[DevPodLastAppliedAnnotation]), existingOptions)
+	// terminated pods never run again, e.g. after an eviction, so they are replaced
+	if existingPod != nil && (existingPod.Status.Phase == corev1.PodFailed || existingPod.Status.Phase == corev1.PodSucceeded) {
+		k.Log.Infof("Pod '%s' is %s (%s), recreating it", id, strings.ToLower(string(existingPod.Status.Phase)), existingPod.Status.Reason)
+		err = k.waitPodDeleted(ctx, id)
 		if err != nil {
-			k.Log.Errorf("Error unmarshalling existing provider options, continuing...: %s", err)
+			return errors.Wrapf(err, "delete terminated pod: %s", id)
 		}
+		existingPod = nil
+	}
 
-		if optionspkg.Equal(&existingOptions.ComparableOptions, &k.options.ComparableOptions) {
-			// Nothing changed, can safely return
-			k.Log.Debug("Provider options did not change, skipping update")
+	if existingPod != nil && !k.podChanged(existingPod, pod) {
+		// Nothing changed, adopt the pod
+		k.adopt("pods", existingPod, owner, func(data []byte) error {
+			_, err := k.client.PatchPod(ctx, id, types.MergePatchType, data)
+			return err
+		})
+
+		// find doesn't wait for the pod, so it might still be starting
+		k.Log.Infof("Waiting for DevContainer Pod '%s' to come up...", id)
+		runningPod, err := k.waitPodRunning(ctx, id)
+		if err != nil {
+			return err
+		} else if runningPod != nil {
+			k.recordPodTiming(ctx, runningPod)
+
+			// the pod of an interrupted run already initialized the volume
+			if initialize {
+				k.recordLastStart(ctx, id)
+			}
 			return nil
 		}
 
+		// the pod was deleted while waiting, create it again
+		existingPod = nil
+	}
+
+	if existingPod != nil {
+		// make sure the new pod is accepted before deleting the current one
+		err = k.validatePod(ctx, pod)
+		if err != nil {
+			return err
+		}
+
 		// Stop the current pod
-		k.Log.Debug("Provider options changed")
 		err = k.waitPodDeleted(ctx, id)
 		if err != nil {
 			return errors.Wrapf(err, "stop devcontainer: %s", id)
 		}
 	}
 
-	err = k.runPod(ctx, id, pod, affinity)
+	err = k.runPod(ctx, id, pod, affinity, created)
 	if err != nil {
 		return err
 	}
@@ -304,20 +272,7 @@ func (k *KubernetesDriver) runContainer(
 	return nil
 }
 
-func (k *KubernetesDriver) runPod(ctx context.Context, id string, pod *corev1.Pod, affinity bool) error {
-	var err error
-
-	// set configuration before creating the pod
-	lastAppliedConfigRaw, err := json.Marshal(k.options)
-	if err != nil {
-		return errors.Wrap(err, "marshal last applied config")
-	}
-
-	if pod.Annotations == nil {
-		pod.Annotations = map[string]string{}
-	}
-	pod.Annotations[DevPodLastAppliedAnnotation] = string(lastAppliedConfigRaw)
-
+func (k *KubernetesDriver) runPod(ctx context.Context, id string, pod *corev1.Pod, affinity bool, created *createdObjects) error {
 	// marshal the pod
 	podRaw, err := json.Marshal(pod)
 	if err != nil {
@@ -327,30 +282,123 @@ func (k *KubernetesDriver) runPod(ctx context.Context, id string, pod *corev1.Po
 	k.Log.Debugf("Create pod with: %s", string(podRaw))
 	// create the pod
 	k.Log.Infof("Create Pod '%s'", id)
-	buf := &bytes.Buffer{}
-	err = k.runCommand(ctx, []string{"create", "-f", "-"}, strings.NewReader(string(podRaw)), buf, buf)
+	_, err = k.client.CreatePod(ctx, pod, metav1.CreateOptions{})
 	if err != nil {
-		return errors.Wrapf(err, "create pod: %s", buf.String())
+		return withHint(errors.Wrap(err, "create pod"))
 	}
+	created.add("pods", id, func(ctx context.Context) error {
+		return k.client.DeletePod(ctx, id, metav1.DeleteOptions{GracePeriodSeconds: &[]int64{0}[0]})
+	})
 
 	// wait for pod running
 	k.Log.Infof("Waiting for DevContainer Pod '%s' to come up...", id)
-	_, err = k.waitPodRunning(ctx, id)
+	runningPod, err := k.waitPodRunning(ctx, id)
 	if err != nil {
+		// don't leave a pending pod behind if the caller gave up, on the first run it
+		// is rolled back with the other objects
+		if ctx.Err() != nil && created == nil {
+			k.cleanupPod(ctx, id)
+		}
 		return err
 	}
+	k.recordLastStart(ctx, id)
+	k.recordPodTiming(ctx, runningPod)
 
 	if affinity {
 		k.Log.Infof("Cleaning up architecture detection pod")
-		err := k.runCommand(ctx, []string{"delete", "pods", "--force", "-l", DevPodWorkspaceLabel + "=" + id}, nil, buf, buf)
+		err := k.client.DeletePods(ctx, DevPodWorkspaceLabel+"="+id, metav1.DeleteOptions{GracePeriodSeconds: &[]int64{0}[0]})
 		if err != nil {
-			return errors.Wrapf(err, "cleanup jobs: %s", buf.String())
+			return errors.Wrap(err, "cleanup jobs")
 		}
 	}
 
 	return nil
 }
 
+// recordLastStart remembers the time the workspace was last started on its pvc, which
+// outlives the pod, and marks the volume as initialized
+func (k *KubernetesDriver) recordLastStart(ctx context.Context, id string) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				DevPodLastStartAnnotation:     time.Now().UTC().Format(time.RFC3339),
+				DevPodUninitializedAnnotation: nil,
+			},
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = k.client.PatchPersistentVolumeClaim(ctx, id, types.MergePatchType, patch)
+	if err != nil {
+		k.Log.Warnf("Error recording the start of workspace '%s': %v", id, err)
+	}
+}
+
+// podChanged compares the spec hashes of the existing and the new pod. Pods created before
+// the hashes were introduced are compared by their provider options instead.
+func (k *KubernetesDriver) podChanged(existingPod, pod *corev1.Pod) bool {
+	existingHashesRaw, ok := existingPod.GetAnnotations()[DevPodSpecHashAnnotation]
+	if !ok {
+		existingOptions := &optionspkg.Options{}
+		err := json.Unmarshal([]byte(existingPod.GetAnnotations()[DevPodLastAppliedAnnotation]), existingOptions)
+		if err != nil {
+			k.Log.Errorf("Error unmarshalling existing provider options, continuing...: %s", err)
+		}
+
+		if optionspkg.Equal(&existingOptions.ComparableOptions, &k.options.ComparableOptions) {
+			k.Log.Debug("Provider options did not change, skipping update")
+			return false
+		}
+
+		k.Log.Debug("Provider options changed")
+		return true
+	}
+
+	existingHashes := map[string]string{}
+	err := json.Unmarshal([]byte(existingHashesRaw), &existingHashes)
+	if err != nil {
+		k.Log.Errorf("Error unmarshalling existing pod spec hash, recreating pod: %s", err)
+		return true
+	}
+	newHashes := map[string]string{}
+	err = json.Unmarshal([]byte(pod.GetAnnotations()[DevPodSpecHashAnnotation]), &newHashes)
+	if err != nil {
+		k.Log.Errorf("Error unmarshalling pod spec hash, recreating pod: %s", err)
+		return true
+	}
+
+	changed := changedSpecFields(existingHashes, newHashes)
+	if len(changed) == 0 {
+		k.Log.Debug("Pod spec did not change, skipping update")
+		return false
+	}
+
+	k.Log.Debugf("Pod spec changed: %s", strings.Join(changed, ", "))
+	return true
+}
+
+// validatePod creates the pod with server-side dry-run, so schema, admission and quota
+// errors surface while the existing pod is still running
+func (k *KubernetesDriver) validatePod(ctx context.Context, pod *corev1.Pod) error {
+	k.Log.Debugf("Validate new pod '%s' with server-side dry-run", pod.Name)
+	_, err := k.client.CreatePod(ctx, pod, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	switch {
+	case err == nil:
+		return nil
+	case kerrors.IsAlreadyExists(err):
+		// the api server only checks for the existing pod after validation and admission passed
+		return nil
+	case kerrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota"):
+		// the existing pod still counts against the quota, so this might succeed after deleting it
+		k.Log.Warnf("Couldn't verify the new pod against the resource quota while the existing pod is running: %v", err)
+		return nil
+	}
+
+	return fmt.Errorf("the API server rejected the new pod spec, keeping the existing pod: %w", err)
+}
+
 func getContainers(
 	pod *corev1.Pod,
 	imageName,
@@ -497,19 +545,59 @@ func getNodeSelector(pod *corev1.Pod, rawNodeSelector string) (map[string]string
 
 func (k *KubernetesDriver) StartDevContainer(ctx context.Context, workspaceId string) error {
 	workspaceId = getID(workspaceId)
-	_, containerInfo, err := k.getDevContainerPvc(ctx, workspaceId)
+	k.timing = newStartupTiming(workspaceId, "start")
+
+	err := k.withLock(ctx, workspaceId, "start", func(ctx context.Context) error {
+		return k.startDevContainer(ctx, workspaceId)
+	})
+	if err != nil {
+		return err
+	}
+
+	k.reportStartupTiming()
+	return nil
+}
+
+func (k *KubernetesDriver) startDevContainer(ctx context.Context, workspaceId string) error {
+	pvc, containerInfo, err := k.getDevContainerPvc(ctx, workspaceId)
 	if err != nil {
 		return err
-	} else if containerInfo == nil {
+	} else if pvc == nil {
+		pvc, containerInfo, err = k.restoreWorkspace(ctx, workspaceId)
+		if err != nil {
+			return err
+		}
+	}
+	if containerInfo == nil {
 		return fmt.Errorf("persistent volume '%s' not found", workspaceId)
 	}
 
-	return k.runContainer(
+	// existing volumes grow with DISK_SIZE
+	pvc, err = k.expandPersistentVolumeClaim(ctx, pvc)
+	if err != nil {
+		return err
+	}
+
+	// initialize the volume if the run that created it failed
+	err = k.runContainer(
 		ctx,
 		workspaceId,
+		pvc,
 		containerInfo.Options,
-		false,
+		!pvcInitialized(pvc),
+		nil,
 	)
+	if err != nil {
+		return err
+	}
+
+	err = k.waitFileSystemResized(ctx, pvc)
+	if err != nil {
+		return err
+	}
+
+	k.reportDiskUsage(ctx, workspaceId)
+	return nil
 }
 
 func getID(workspaceID string) string {
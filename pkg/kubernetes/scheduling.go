@@ -0,0 +1,482 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// nodePodsFieldSelector selects the pods that use resources of a node
+const nodePodsFieldSelector = "spec.nodeName!=,status.phase!=Succeeded,status.phase!=Failed"
+
+// explainScheduling compares the requests, node selector, affinities and tolerations of
+// the unschedulable pod with the current nodes and explains why it doesn't fit on any
+// of them. It returns an empty string if the nodes can't be listed, e.g. because the
+// user isn't allowed to.
+func (k *KubernetesDriver) explainScheduling(ctx context.Context, pod *corev1.Pod) string {
+	nodes, err := k.client.ListNodes(ctx)
+	if err != nil {
+		k.Log.Debugf("Error listing nodes to explain why pod '%s' isn't scheduled: %v", pod.Name, err)
+		return ""
+	}
+	nodePods, err := k.client.ListNodePods(ctx)
+	if err != nil {
+		k.Log.Debugf("Error listing pods to explain why pod '%s' isn't scheduled: %v", pod.Name, err)
+		return ""
+	}
+
+	return analyzeScheduling(pod, nodes, nodePods).String()
+}
+
+// podUnschedulable returns true if the scheduler couldn't find a node for the pod
+func podUnschedulable(pod *corev1.Pod) bool {
+	if pod == nil {
+		return false
+	}
+
+	scheduled := podCondition(pod, corev1.PodScheduled)
+	return scheduled != nil && scheduled.Status == corev1.ConditionFalse && scheduled.Reason == corev1.PodReasonUnschedulable
+}
+
+// schedulingAnalysis is the result of checking the pod against all nodes. The nodes are
+// filtered in the order the fields are listed, every count only includes the nodes that
+// passed the previous filters.
+type schedulingAnalysis struct {
+	requests corev1.ResourceList
+
+	nodes     int
+	cordoned  int
+	notReady  int
+	selector  bool
+	matching  int
+	tainted   int
+	taints    []string
+	affinity  bool
+	colocated int
+
+	// largestFree is the most free of each requested resource on the remaining nodes
+	largestFree     map[corev1.ResourceName]resource.Quantity
+	largestFreeNode map[corev1.ResourceName]string
+	fitting         int
+}
+
+func analyzeScheduling(pod *corev1.Pod, nodes []corev1.Node, nodePods []corev1.Pod) *schedulingAnalysis {
+	analysis := &schedulingAnalysis{
+		requests:        podRequests(pod),
+		nodes:           len(nodes),
+		selector:        len(pod.Spec.NodeSelector) > 0 || requiredNodeAffinity(pod) != nil,
+		affinity:        len(requiredPodAffinity(pod)) > 0,
+		largestFree:     map[corev1.ResourceName]resource.Quantity{},
+		largestFreeNode: map[corev1.ResourceName]string{},
+	}
+	analysis.requests[corev1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+
+	nodesByName := map[string]*corev1.Node{}
+	for i := range nodes {
+		nodesByName[nodes[i].Name] = &nodes[i]
+	}
+
+	// sum up what the pods on each node request
+	used := map[string]corev1.ResourceList{}
+	for i := range nodePods {
+		nodePod := &nodePods[i]
+		if nodePod.Spec.NodeName == "" || nodePod.Status.Phase == corev1.PodSucceeded || nodePod.Status.Phase == corev1.PodFailed {
+			continue
+		} else if nodePod.Namespace == pod.Namespace && nodePod.Name == pod.Name {
+			continue
+		}
+
+		if used[nodePod.Spec.NodeName] == nil {
+			used[nodePod.Spec.NodeName] = corev1.ResourceList{}
+		}
+		addResources(used[nodePod.Spec.NodeName], podRequests(nodePod))
+		addResources(used[nodePod.Spec.NodeName], corev1.ResourceList{corev1.ResourcePods: *resource.NewQuantity(1, resource.DecimalSI)})
+	}
+
+	taints := map[string]bool{}
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Spec.Unschedulable {
+			analysis.cordoned++
+			continue
+		} else if !nodeReady(node) {
+			analysis.notReady++
+			continue
+		}
+
+		if !nodeMatchesSelector(pod, node) {
+			continue
+		}
+		analysis.matching++
+
+		if untolerated := untoleratedTaints(pod, node); len(untolerated) > 0 {
+			analysis.tainted++
+			for _, taint := range untolerated {
+				taints[taint] = true
+			}
+			continue
+		}
+
+		if !nodeMatchesPodAffinity(pod, node, nodesByName, nodePods) {
+			continue
+		}
+		analysis.colocated++
+
+		fits := true
+		for name, request := range analysis.requests {
+			free := node.Status.Allocatable[name].DeepCopy()
+			free.Sub(used[node.Name][name])
+			if free.Sign() < 0 {
+				free = resource.Quantity{}
+			}
+			if largest, ok := analysis.largestFree[name]; !ok || free.Cmp(largest) > 0 {
+				analysis.largestFree[name] = free
+				analysis.largestFreeNode[name] = node.Name
+			}
+			if free.Cmp(request) < 0 {
+				fits = false
+			}
+		}
+		if fits {
+			analysis.fitting++
+		}
+	}
+
+	for taint := range taints {
+		analysis.taints = append(analysis.taints, taint)
+	}
+	sort.Strings(analysis.taints)
+
+	return analysis
+}
+
+// String explains the analysis line by line, e.g. "no node has 8 CPU free; 3 nodes are
+// eligible; the largest free is 6 CPU on node-a"
+func (a *schedulingAnalysis) String() string {
+	lines := []string{fmt.Sprintf("Node fit analysis for %s:", formatResources(a.requests))}
+	if a.nodes == 0 {
+		return strings.Join(append(lines, "  the cluster has no nodes"), "\n")
+	}
+
+	remaining := a.nodes
+	if a.cordoned > 0 {
+		lines = append(lines, fmt.Sprintf("  %d of %d nodes %s cordoned", a.cordoned, a.nodes, plural(a.cordoned, "is", "are")))
+	}
+	if a.notReady > 0 {
+		lines = append(lines, fmt.Sprintf("  %d of %d nodes %s not ready", a.notReady, a.nodes, plural(a.notReady, "is", "are")))
+	}
+	remaining -= a.cordoned + a.notReady
+	if a.selector {
+		lines = append(lines, fmt.Sprintf("  %d of %d nodes %s the node selector and node affinity", a.matching, remaining, plural(a.matching, "matches", "match")))
+	}
+	if a.tainted > 0 {
+		lines = append(lines, fmt.Sprintf("  %d of %d nodes %s untolerated taints: %s", a.tainted, a.matching, plural(a.tainted, "has", "have"), strings.Join(a.taints, ", ")))
+	}
+	if a.affinity {
+		lines = append(lines, fmt.Sprintf("  %d of %d nodes %s the pod affinity", a.colocated, a.matching-a.tainted, plural(a.colocated, "matches", "match")))
+	}
+	if a.colocated == 0 {
+		return strings.Join(append(lines, "  no node matches the node selector, affinity and tolerations of the pod"), "\n")
+	}
+
+	names := make([]string, 0, len(a.requests))
+	for name := range a.requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	insufficient := false
+	for _, name := range names {
+		resourceName := corev1.ResourceName(name)
+		request := a.requests[resourceName]
+		largest := a.largestFree[resourceName]
+		if largest.Cmp(request) >= 0 {
+			continue
+		}
+
+		insufficient = true
+		lines = append(lines, fmt.Sprintf(
+			"  no node has %s free; %s %s; the largest free is %s on %s",
+			formatQuantity(resourceName, request),
+			countNodes(a.colocated),
+			plural(a.colocated, "is eligible", "are eligible"),
+			formatQuantity(resourceName, largest),
+			a.largestFreeNode[resourceName],
+		))
+	}
+
+	switch {
+	case a.fitting > 0:
+		lines = append(lines, fmt.Sprintf("  %s should fit the pod, check the events for other reasons like the zone of the workspace volume", countNodes(a.fitting)))
+	case !insufficient:
+		lines = append(lines, fmt.Sprintf("  no node has all requested resources free at the same time; %s %s", countNodes(a.colocated), plural(a.colocated, "is eligible", "are eligible")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// podRequests returns the resources the scheduler reserves for the pod, which are the
+// requests of all containers or of the largest init container if that is more
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResources(requests, containerRequests(&container))
+	}
+
+	sidecars := corev1.ResourceList{}
+	for _, container := range pod.Spec.InitContainers {
+		if restartableInitContainer(container.RestartPolicy) {
+			addResources(requests, containerRequests(&container))
+			addResources(sidecars, containerRequests(&container))
+			continue
+		}
+
+		initRequests := containerRequests(&container)
+		addResources(initRequests, sidecars)
+		for name, quantity := range initRequests {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+
+	addResources(requests, pod.Spec.Overhead)
+	return requests
+}
+
+// containerRequests returns the requests of the container, which default to its limits
+func containerRequests(container *corev1.Container) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for name, quantity := range container.Resources.Limits {
+		requests[name] = quantity.DeepCopy()
+	}
+	for name, quantity := range container.Resources.Requests {
+		requests[name] = quantity.DeepCopy()
+	}
+
+	return requests
+}
+
+func addResources(list corev1.ResourceList, add corev1.ResourceList) {
+	for name, quantity := range add {
+		current := list[name].DeepCopy()
+		current.Add(quantity)
+		list[name] = current
+	}
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func requiredNodeAffinity(pod *corev1.Pod) *corev1.NodeSelector {
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.NodeAffinity == nil {
+		return nil
+	}
+
+	return pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+}
+
+func requiredPodAffinity(pod *corev1.Pod) []corev1.PodAffinityTerm {
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAffinity == nil {
+		return nil
+	}
+
+	return pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+}
+
+// nodeMatchesSelector checks the node selector and the required node affinity of the pod
+func nodeMatchesSelector(pod *corev1.Pod, node *corev1.Node) bool {
+	if !labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	affinity := requiredNodeAffinity(pod)
+	if affinity == nil {
+		return true
+	}
+
+	// the terms are ORed, the requirements of a term are ANDed
+	for _, term := range affinity.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+
+		matches := true
+		for _, requirement := range term.MatchExpressions {
+			value, ok := node.Labels[requirement.Key]
+			matches = matches && nodeSelectorRequirementMatches(requirement, value, ok)
+		}
+		for _, requirement := range term.MatchFields {
+			matches = matches && requirement.Key == metav1.ObjectNameField && nodeSelectorRequirementMatches(requirement, node.Name, true)
+		}
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nodeSelectorRequirementMatches(requirement corev1.NodeSelectorRequirement, value string, exists bool) bool {
+	switch requirement.Operator {
+	case corev1.NodeSelectorOpIn:
+		return exists && containsString(requirement.Values, value)
+	case corev1.NodeSelectorOpNotIn:
+		return !exists || !containsString(requirement.Values, value)
+	case corev1.NodeSelectorOpExists:
+		return exists
+	case corev1.NodeSelectorOpDoesNotExist:
+		return !exists
+	case corev1.NodeSelectorOpGt, corev1.NodeSelectorOpLt:
+		if !exists || len(requirement.Values) != 1 {
+			return false
+		}
+
+		actual, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		expected, err := strconv.ParseInt(requirement.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		if requirement.Operator == corev1.NodeSelectorOpGt {
+			return actual > expected
+		}
+		return actual < expected
+	}
+
+	return false
+}
+
+// untoleratedTaints returns the taints of the node that keep the pod from being scheduled
+func untoleratedTaints(pod *corev1.Pod, node *corev1.Node) []string {
+	untolerated := []string{}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := false
+		for j := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			untolerated = append(untolerated, taint.ToString())
+		}
+	}
+
+	return untolerated
+}
+
+// nodeMatchesPodAffinity checks that the node is in the same topology domain as a pod
+// matching each required pod affinity term, e.g. the architecture detection pod
+func nodeMatchesPodAffinity(pod *corev1.Pod, node *corev1.Node, nodes map[string]*corev1.Node, nodePods []corev1.Pod) bool {
+	for _, term := range requiredPodAffinity(pod) {
+		topologyValue, ok := node.Labels[term.TopologyKey]
+		if !ok {
+			return false
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+		if err != nil {
+			return false
+		}
+
+		namespaces := term.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{pod.Namespace}
+		}
+
+		matches := false
+		for i := range nodePods {
+			other := &nodePods[i]
+			otherNode, ok := nodes[other.Spec.NodeName]
+			if !ok || !containsString(namespaces, other.Namespace) || !selector.Matches(labels.Set(other.Labels)) {
+				continue
+			}
+			if otherNode.Labels[term.TopologyKey] == topologyValue {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	return true
+}
+
+func formatResources(list corev1.ResourceList) string {
+	names := make([]string, 0, len(list))
+	for name := range list {
+		if name != corev1.ResourcePods {
+			names = append(names, string(name))
+		}
+	}
+	if len(names) == 0 {
+		return "a pod without resource requests"
+	}
+	sort.Strings(names)
+
+	formatted := make([]string, 0, len(names))
+	for _, name := range names {
+		formatted = append(formatted, formatQuantity(corev1.ResourceName(name), list[corev1.ResourceName(name)]))
+	}
+
+	return "a pod requesting " + strings.Join(formatted, ", ")
+}
+
+func formatQuantity(name corev1.ResourceName, quantity resource.Quantity) string {
+	switch name {
+	case corev1.ResourceCPU:
+		return strconv.FormatFloat(float64(quantity.MilliValue())/1000, 'f', -1, 64) + " CPU"
+	case corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+		return strconv.FormatFloat(float64(quantity.Value())/(1<<30), 'f', 1, 64) + "Gi " + string(name)
+	case corev1.ResourcePods:
+		return plural(int(quantity.Value()), "1 pod slot", strconv.FormatInt(quantity.Value(), 10)+" pod slots")
+	}
+
+	return quantity.String() + " " + string(name)
+}
+
+func countNodes(count int) string {
+	return strconv.Itoa(count) + " " + plural(count, "node", "nodes")
+}
+
+func plural(count int, one, other string) string {
+	if count == 1 {
+		return one
+	}
+
+	return other
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,200 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testNode(name, cpu, memory string, labels map[string]string, taints ...corev1.Taint) *corev1.Node {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels["kubernetes.io/hostname"] = name
+
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       corev1.NodeSpec{Taints: taints},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+				corev1.ResourcePods:   resource.MustParse("110"),
+			},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func testNodePod(name, nodeName, cpu, memory string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+			Containers: []corev1.Container{{
+				Name: "app",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(cpu),
+					corev1.ResourceMemory: resource.MustParse(memory),
+				}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func schedulingPod(cpu, memory string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "devpod-test", Namespace: testNamespace},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: DevContainerName,
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(cpu),
+					corev1.ResourceMemory: resource.MustParse(memory),
+				}},
+			}},
+		},
+	}
+}
+
+func TestAnalyzeScheduling(t *testing.T) {
+	gpuTaint := corev1.Taint{Key: "gpu", Value: "true", Effect: corev1.TaintEffectNoSchedule}
+	cordoned := testNode("node-d", "16", "64Gi", map[string]string{"pool": "dev"})
+	cordoned.Spec.Unschedulable = true
+
+	nodes := []corev1.Node{
+		*testNode("node-a", "8", "32Gi", map[string]string{"pool": "dev"}),
+		*testNode("node-b", "8", "32Gi", map[string]string{"pool": "dev"}),
+		*testNode("node-c", "16", "64Gi", map[string]string{"pool": "dev"}, gpuTaint),
+		*cordoned,
+		*testNode("node-e", "32", "128Gi", map[string]string{"pool": "batch"}),
+	}
+	nodePods := []corev1.Pod{
+		*testNodePod("app-1", "node-a", "2", "4Gi"),
+		*testNodePod("app-2", "node-b", "6", "8Gi"),
+		*testNodePod("arch-detection", "node-b", "100m", "64Mi"),
+	}
+	nodePods[2].Namespace = testNamespace
+	nodePods[2].Labels = map[string]string{DevPodWorkspaceLabel: "devpod-test"}
+
+	testCases := []struct {
+		name     string
+		pod      func() *corev1.Pod
+		expected string
+	}{
+		{
+			name: "insufficient-cpu",
+			pod: func() *corev1.Pod {
+				pod := schedulingPod("8", "16Gi")
+				pod.Spec.NodeSelector = map[string]string{"pool": "dev"}
+				return pod
+			},
+			expected: "Node fit analysis for a pod requesting 8 CPU, 16.0Gi memory:\n" +
+				"  1 of 5 nodes is cordoned\n" +
+				"  3 of 4 nodes match the node selector and node affinity\n" +
+				"  1 of 3 nodes has untolerated taints: gpu=true:NoSchedule\n" +
+				"  no node has 8 CPU free; 2 nodes are eligible; the largest free is 6 CPU on node-a",
+		},
+		{
+			name: "tolerated",
+			pod: func() *corev1.Pod {
+				pod := schedulingPod("8", "16Gi")
+				pod.Spec.NodeSelector = map[string]string{"pool": "dev"}
+				pod.Spec.Tolerations = []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}}
+				return pod
+			},
+			expected: "Node fit analysis for a pod requesting 8 CPU, 16.0Gi memory:\n" +
+				"  1 of 5 nodes is cordoned\n" +
+				"  3 of 4 nodes match the node selector and node affinity\n" +
+				"  1 node should fit the pod, check the events for other reasons like the zone of the workspace volume",
+		},
+		{
+			name: "node-affinity",
+			pod: func() *corev1.Pod {
+				pod := schedulingPod("1", "1Gi")
+				pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchExpressions: []corev1.NodeSelectorRequirement{{
+								Key:      "pool",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"gpu"},
+							}},
+						}},
+					},
+				}}
+				return pod
+			},
+			expected: "Node fit analysis for a pod requesting 1 CPU, 1.0Gi memory:\n" +
+				"  1 of 5 nodes is cordoned\n" +
+				"  0 of 4 nodes match the node selector and node affinity\n" +
+				"  no node matches the node selector, affinity and tolerations of the pod",
+		},
+		{
+			name: "arch-detection-affinity",
+			pod: func() *corev1.Pod {
+				pod := schedulingPod("4", "4Gi")
+				pod.Spec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+						LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{DevPodWorkspaceLabel: "devpod-test"}},
+						Namespaces:    []string{testNamespace},
+						TopologyKey:   "kubernetes.io/hostname",
+					}},
+				}}
+				return pod
+			},
+			expected: "Node fit analysis for a pod requesting 4 CPU, 4.0Gi memory:\n" +
+				"  1 of 5 nodes is cordoned\n" +
+				"  1 of 4 nodes has untolerated taints: gpu=true:NoSchedule\n" +
+				"  1 of 3 nodes matches the pod affinity\n" +
+				"  no node has 4 CPU free; 1 node is eligible; the largest free is 1.9 CPU on node-b",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, analyzeScheduling(testCase.pod(), nodes, nodePods).String())
+		})
+	}
+}
+
+func TestPodRequests(t *testing.T) {
+	pod := schedulingPod("1", "1Gi")
+	pod.Spec.InitContainers = []corev1.Container{{
+		Name: InitContainerName,
+		Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("2"),
+			corev1.ResourceMemory: resource.MustParse("512Mi"),
+		}},
+	}}
+
+	requests := podRequests(pod)
+	assert.Equal(t, "2", requests.Cpu().String())
+	assert.Equal(t, "1Gi", requests.Memory().String())
+}
+
+func TestRunDevContainerTimeoutExplainsScheduling(t *testing.T) {
+	cluster := newFakeCluster(
+		testNode("node-a", "4", "16Gi", nil),
+		testNodePod("app", "node-a", "3", "4Gi"),
+	)
+	cluster.scriptPod("devpod-test", podPending, func(pod *corev1.Pod) {
+		pod.Status.Conditions[0].Message = "0/1 nodes are available: 1 Insufficient cpu."
+	})
+	d := cluster.driver(t, &options.Options{
+		PodTimeout: "1s",
+		ComparableOptions: options.ComparableOptions{
+			Resources: "requests.cpu=2",
+		},
+	})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.ErrorContains(t, err, "timed out waiting for pod 'devpod-test' to come up")
+	assert.ErrorContains(t, err, "no node has 2 CPU free; 1 node is eligible; the largest free is 1 CPU on node-a")
+}
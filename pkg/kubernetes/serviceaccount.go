@@ -1,86 +1,100 @@
 package kubernetes
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 
-	"github.com/loft-sh/devpod/pkg/command"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
-func (k *KubernetesDriver) createServiceAccount(ctx context.Context, id, serviceAccount string) error {
-	// try to find pvc
-	out, err := k.buildCmd(ctx, []string{"get", "serviceaccount", serviceAccount, "--ignore-not-found", "-o", "json"}).Output()
+func (k *KubernetesDriver) createServiceAccount(ctx context.Context, id, serviceAccount string, owner *metav1.OwnerReference, created *createdObjects) error {
+	// try to find service account
+	_, err := k.client.GetServiceAccount(ctx, serviceAccount)
 	if err != nil {
-		return command.WrapCommandError(out, err)
-	} else if len(out) == 0 {
-		// create service account if it does not exist
-		serviceAccountRaw, err := json.Marshal(&corev1.ServiceAccount{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "ServiceAccount",
-				APIVersion: corev1.SchemeGroupVersion.String(),
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name:   serviceAccount,
-				Labels: ExtraDevPodLabels,
-			},
-		})
-		if err != nil {
-			return err
+		if !kerrors.IsNotFound(err) {
+			return errors.Wrap(err, "get service account")
 		}
 
+		// create service account if it does not exist
 		k.Log.Infof("Create Service Account '%s'", serviceAccount)
-		buf := &bytes.Buffer{}
-		err = k.runCommand(ctx, []string{"create", "-f", "-"}, bytes.NewReader(serviceAccountRaw), buf, buf)
-		if err != nil {
-			return errors.Wrapf(err, "create service account: %s", buf.String())
+		_, err = k.client.CreateServiceAccount(ctx, buildServiceAccount(serviceAccount))
+		if err == nil {
+			created.add("serviceaccounts", serviceAccount, func(ctx context.Context) error {
+				return k.client.DeleteServiceAccount(ctx, serviceAccount, metav1.DeleteOptions{})
+			})
+		} else if !kerrors.IsAlreadyExists(err) {
+			return errors.Wrap(err, "create service account")
 		}
 	}
 
 	// try to find role binding
 	if k.options.ClusterRole != "" {
-		out, err = k.buildCmd(ctx, []string{"get", "rolebinding", id, "--ignore-not-found", "-o", "json"}).Output()
-		if err != nil {
-			return command.WrapCommandError(out, err)
-		} else if len(out) == 0 {
-			// create role binding
-			roleBindingRaw, err := json.Marshal(&rbacv1.RoleBinding{
-				TypeMeta: metav1.TypeMeta{
-					Kind:       "RoleBinding",
-					APIVersion: rbacv1.SchemeGroupVersion.String(),
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name:   id,
-					Labels: ExtraDevPodLabels,
-				},
-				Subjects: []rbacv1.Subject{
-					{
-						Kind: "ServiceAccount",
-						Name: serviceAccount,
-					},
-				},
-				RoleRef: rbacv1.RoleRef{
-					APIGroup: rbacv1.SchemeGroupVersion.Group,
-					Kind:     "ClusterRole",
-					Name:     k.options.ClusterRole,
-				},
-			})
-			if err != nil {
+		roleBinding, err := k.client.GetRoleBinding(ctx, id)
+		if err == nil {
+			k.adopt("rolebindings", roleBinding, owner, func(data []byte) error {
+				_, err := k.client.PatchRoleBinding(ctx, id, types.MergePatchType, data)
 				return err
+			})
+		} else {
+			if !kerrors.IsNotFound(err) {
+				return errors.Wrap(err, "get role binding")
 			}
 
+			// create role binding
 			k.Log.Infof("Create Role Binding '%s'", serviceAccount)
-			buf := &bytes.Buffer{}
-			err = k.runCommand(ctx, []string{"create", "-f", "-"}, bytes.NewReader(roleBindingRaw), buf, buf)
-			if err != nil {
-				return errors.Wrapf(err, "create role binding: %s", buf.String())
+			roleBinding = buildRoleBinding(id, serviceAccount, k.options.ClusterRole)
+			setOwnerReference(roleBinding, owner)
+			_, err = k.client.CreateRoleBinding(ctx, roleBinding)
+			if err == nil {
+				created.add("rolebindings", id, func(ctx context.Context) error {
+					return k.client.DeleteRoleBinding(ctx, id, metav1.DeleteOptions{})
+				})
+			} else if !kerrors.IsAlreadyExists(err) {
+				return errors.Wrap(err, "create role binding")
 			}
 		}
 	}
 
 	return nil
 }
+
+func buildServiceAccount(serviceAccount string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: corev1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   serviceAccount,
+			Labels: ExtraDevPodLabels,
+		},
+	}
+}
+
+func buildRoleBinding(id, serviceAccount, clusterRole string) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "RoleBinding",
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   id,
+			Labels: ExtraDevPodLabels,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind: "ServiceAccount",
+				Name: serviceAccount,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.SchemeGroupVersion.Group,
+			Kind:     "ClusterRole",
+			Name:     clusterRole,
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package kubernetes
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// volumeSnapshotResource is the resource of CSI volume snapshots, which are only
+// available if the snapshot CRDs and controller are installed in the cluster
+var volumeSnapshotResource = schema.GroupVersionResource{
+	Group:    "snapshot.storage.k8s.io",
+	Version:  "v1",
+	Resource: "volumesnapshots",
+}
+
+var volumeSnapshotTypeMeta = metav1.TypeMeta{
+	Kind:       "VolumeSnapshot",
+	APIVersion: volumeSnapshotResource.GroupVersion().String(),
+}
+
+// volumeSnapshot is the part of a snapshot.storage.k8s.io/v1 VolumeSnapshot the driver
+// uses, so the external snapshotter client isn't needed
+type volumeSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   volumeSnapshotSpec    `json:"spec"`
+	Status *volumeSnapshotStatus `json:"status,omitempty"`
+}
+
+type volumeSnapshotSpec struct {
+	Source                  volumeSnapshotSource `json:"source"`
+	VolumeSnapshotClassName *string              `json:"volumeSnapshotClassName,omitempty"`
+}
+
+type volumeSnapshotSource struct {
+	PersistentVolumeClaimName *string `json:"persistentVolumeClaimName,omitempty"`
+	VolumeSnapshotContentName *string `json:"volumeSnapshotContentName,omitempty"`
+}
+
+type volumeSnapshotStatus struct {
+	ReadyToUse  *bool                `json:"readyToUse,omitempty"`
+	RestoreSize *resource.Quantity   `json:"restoreSize,omitempty"`
+	Error       *volumeSnapshotError `json:"error,omitempty"`
+}
+
+type volumeSnapshotError struct {
+	Message *string `json:"message,omitempty"`
+}
+
+type volumeSnapshotList struct {
+	Items []volumeSnapshot `json:"items"`
+}
+
+// readyToUse returns true once the snapshot can be restored
+func (s *volumeSnapshot) readyToUse() bool {
+	return s.Status != nil && s.Status.ReadyToUse != nil && *s.Status.ReadyToUse
+}
+
+// errorMessage returns the error the snapshot controller reported for the snapshot, if any
+func (s *volumeSnapshot) errorMessage() string {
+	if s.Status == nil || s.Status.Error == nil || s.Status.Error.Message == nil {
+		return ""
+	}
+
+	return *s.Status.Error.Message
+}
+
+func volumeSnapshotFromUnstructured(obj *unstructured.Unstructured) (*volumeSnapshot, error) {
+	snapshot := &volumeSnapshot{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, snapshot)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert volume snapshot")
+	}
+
+	return snapshot, nil
+}
+
+func volumeSnapshotToUnstructured(snapshot *volumeSnapshot) (*unstructured.Unstructured, error) {
+	withTypeMeta := *snapshot
+	withTypeMeta.TypeMeta = volumeSnapshotTypeMeta
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&withTypeMeta)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert volume snapshot")
+	}
+
+	return &unstructured.Unstructured{Object: obj}, nil
+}
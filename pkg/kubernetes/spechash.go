@@ -0,0 +1,102 @@
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// specHashLength is the number of hex characters kept per field hash
+const specHashLength = 12
+
+// podSpecHashes returns a short hash for the labels, annotations and every field of the pod spec.
+// Containers and init containers are hashed one by one, so a change can be traced to a single
+// container. The devpod-init container is left out, because it only exists on the first start.
+func podSpecHashes(pod *corev1.Pod) (map[string]string, error) {
+	hashes := map[string]string{}
+	add := func(field string, value interface{}) error {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(raw)
+		hashes[field] = hex.EncodeToString(sum[:])[:specHashLength]
+		return nil
+	}
+
+	err := add("metadata.labels", pod.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := map[string]string{}
+	for k, v := range pod.Annotations {
+		if k == DevPodLastAppliedAnnotation || k == DevPodSpecHashAnnotation {
+			continue
+		}
+		annotations[k] = v
+	}
+	err = add("metadata.annotations", annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		if container.Name == InitContainerName {
+			continue
+		}
+
+		err = add("spec.initContainers["+container.Name+"]", container)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		err = add("spec.containers["+container.Name+"]", container)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	raw, err := json.Marshal(pod.Spec)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+	delete(fields, "initContainers")
+	delete(fields, "containers")
+	for field, value := range fields {
+		err = add("spec."+field, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return hashes, nil
+}
+
+// changedSpecFields returns the sorted fields whose hashes differ
+func changedSpecFields(oldHashes, newHashes map[string]string) []string {
+	changed := []string{}
+	for field, hash := range newHashes {
+		if oldHashes[field] != hash {
+			changed = append(changed, field)
+		}
+	}
+	for field := range oldHashes {
+		if _, ok := newHashes[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
@@ -0,0 +1,54 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodSpecHashes(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      map[string]string{"team": "platform"},
+			Annotations: map[string]string{DevPodLastAppliedAnnotation: "{}"},
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: InitContainerName, Image: "alpine"}},
+			Containers:     []corev1.Container{{Name: DevContainerName, Image: "alpine"}, {Name: "sidecar", Image: "nginx"}},
+			NodeSelector:   map[string]string{"disktype": "ssd"},
+		},
+	}
+
+	hashes, err := podSpecHashes(pod)
+	assert.NoError(t, err)
+
+	fields := []string{}
+	for field, hash := range hashes {
+		fields = append(fields, field)
+		assert.Len(t, hash, specHashLength)
+	}
+	assert.ElementsMatch(t, []string{
+		"metadata.labels",
+		"metadata.annotations",
+		"spec.containers[devpod]",
+		"spec.containers[sidecar]",
+		"spec.nodeSelector",
+	}, fields)
+
+	// the devpod-init container and the devpod annotations don't change the hashes
+	changedPod := pod.DeepCopy()
+	changedPod.Spec.InitContainers = nil
+	changedPod.Annotations[DevPodLastAppliedAnnotation] = `{"resources":"requests.cpu=1"}`
+	changedHashes, err := podSpecHashes(changedPod)
+	assert.NoError(t, err)
+	assert.Empty(t, changedSpecFields(hashes, changedHashes))
+
+	changedPod.Spec.Containers[1].Image = "nginx:latest"
+	changedPod.Spec.NodeSelector = nil
+	changedPod.Spec.Tolerations = []corev1.Toleration{{Key: "gpu"}}
+	changedHashes, err = podSpecHashes(changedPod)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"spec.containers[sidecar]", "spec.nodeSelector", "spec.tolerations"}, changedSpecFields(hashes, changedHashes))
+}
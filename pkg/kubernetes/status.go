@@ -0,0 +1,319 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loft-sh/devpod/pkg/devcontainer/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The detailed statuses of a workspace. Only StatusRunning is reported as running to
+// devpod, everything else makes it start the workspace.
+const (
+	StatusRunning           = "running"
+	StatusStopped           = "stopped"
+	StatusTerminating       = "terminating"
+	StatusVolumeUnbound     = "volume-unbound"
+	StatusPendingScheduling = "pending-scheduling"
+	StatusPullingImage      = "pulling-image"
+	StatusImagePullFailed   = "image-pull-failed"
+	StatusInitializing      = "initializing"
+	StatusStarting          = "starting"
+	StatusNotReady          = "not-ready"
+	StatusCrashLooping      = "crash-looping"
+	StatusEvicted           = "evicted"
+	StatusNodeLost          = "node-lost"
+	StatusFailed            = "failed"
+)
+
+// WorkspaceStatus describes the state of a workspace and why it is in that state
+type WorkspaceStatus struct {
+	Status             string     `json:"status"`
+	Reason             string     `json:"reason,omitempty"`
+	Message            string     `json:"message,omitempty"`
+	LastTransitionTime *time.Time `json:"lastTransitionTime,omitempty"`
+
+	// DiskUsage of the workspace volume, only measured while the workspace is running
+	DiskUsage *DiskUsage `json:"diskUsage,omitempty"`
+}
+
+// WorkspaceDetails are the container details devpod expects together with the detailed
+// status of the workspace
+type WorkspaceDetails struct {
+	*config.ContainerDetails
+
+	WorkspaceStatus *WorkspaceStatus `json:"WorkspaceStatus,omitempty"`
+}
+
+// FindWorkspace returns the details of the workspace without waiting for its pod or nil
+// if the workspace doesn't exist
+func (k *KubernetesDriver) FindWorkspace(ctx context.Context, workspaceId string) (*WorkspaceDetails, error) {
+	workspaceId = getID(workspaceId)
+
+	pvc, containerInfo, err := k.getDevContainerPvc(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	} else if pvc == nil {
+		return k.findHibernatedWorkspace(ctx, workspaceId)
+	}
+
+	pod, err := k.getPod(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	// events are only needed to tell whether the image is pulled
+	var events []corev1.Event
+	if pod != nil && pod.Status.Phase == corev1.PodPending {
+		events, err = k.client.ListEvents(ctx, pod.Name)
+		if err != nil {
+			k.Log.Debugf("Error listing events of pod '%s': %v", pod.Name, err)
+		}
+	}
+
+	status := workspaceStatus(pvc, pod, events)
+	if status.Status == StatusRunning {
+		status.DiskUsage = k.findDiskUsage(ctx, workspaceId, pod)
+	}
+	startedAt := pvc.CreationTimestamp.String()
+	if pod != nil {
+		startedAt = pod.CreationTimestamp.String()
+	}
+
+	labels := map[string]string{}
+	if containerInfo.Options != nil {
+		labels = config.ListToObject(containerInfo.Options.Labels)
+	}
+
+	return &WorkspaceDetails{
+		ContainerDetails: &config.ContainerDetails{
+			ID:      pvc.Name,
+			Created: pvc.CreationTimestamp.String(),
+			State: config.ContainerDetailsState{
+				Status:    status.Status,
+				StartedAt: startedAt,
+			},
+			Config: config.ContainerDetailsConfig{
+				Labels: labels,
+			},
+		},
+		WorkspaceStatus: status,
+	}, nil
+}
+
+// workspaceStatus derives the status of the workspace from its pvc, its pod and the
+// events of the pod
+func workspaceStatus(pvc *corev1.PersistentVolumeClaim, pod *corev1.Pod, events []corev1.Event) *WorkspaceStatus {
+	if pod == nil {
+		status := &WorkspaceStatus{Status: StatusStopped}
+		lastStart, err := time.Parse(time.RFC3339, pvc.Annotations[DevPodLastStartAnnotation])
+		if err == nil {
+			status.LastTransitionTime = &lastStart
+		}
+		return status
+	}
+
+	if pod.DeletionTimestamp != nil {
+		return &WorkspaceStatus{
+			Status:             StatusTerminating,
+			LastTransitionTime: &pod.DeletionTimestamp.Time,
+		}
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodFailed:
+		if pod.Status.Reason == "Evicted" {
+			return podStatus(StatusEvicted, pod)
+		}
+
+		status := podStatus(StatusFailed, pod)
+		if terminated := terminatedContainer(pod.Status.ContainerStatuses); terminated != nil {
+			status.Reason = terminated.State.Terminated.Reason
+			status.Message = terminated.State.Terminated.Message
+			status.LastTransitionTime = &terminated.State.Terminated.FinishedAt.Time
+		}
+		return status
+	case corev1.PodSucceeded:
+		return podStatus(StatusStopped, pod)
+	}
+
+	// the node stopped reporting, the pod status is stale
+	if pod.Status.Reason == "NodeLost" {
+		return podStatus(StatusNodeLost, pod)
+	}
+	if ready := podCondition(pod, corev1.PodReady); ready != nil && ready.Status != corev1.ConditionTrue && ready.Reason == "NodeNotReady" {
+		return conditionStatus(StatusNodeLost, ready)
+	}
+
+	// not scheduled yet, either because of its volume or because no node fits
+	if scheduled := podCondition(pod, corev1.PodScheduled); scheduled != nil && scheduled.Status == corev1.ConditionFalse {
+		if pvc.Status.Phase != corev1.ClaimBound && strings.Contains(scheduled.Message, "PersistentVolumeClaim") {
+			return conditionStatus(StatusVolumeUnbound, scheduled)
+		}
+
+		return conditionStatus(StatusPendingScheduling, scheduled)
+	}
+
+	// init containers
+	for i := range pod.Status.InitContainerStatuses {
+		containerStatus := &pod.Status.InitContainerStatuses[i]
+		if status := waitingStatus(containerStatus, events); status != nil {
+			return status
+		} else if IsRunning(containerStatus) && !IsReady(containerStatus) {
+			return &WorkspaceStatus{
+				Status:             StatusInitializing,
+				Reason:             "InitContainerRunning",
+				Message:            "init container '" + containerStatus.Name + "' is running",
+				LastTransitionTime: &containerStatus.State.Running.StartedAt.Time,
+			}
+		}
+	}
+
+	// containers
+	for i := range pod.Status.ContainerStatuses {
+		if status := waitingStatus(&pod.Status.ContainerStatuses[i], events); status != nil {
+			return status
+		}
+	}
+	if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		if initialized := podCondition(pod, corev1.PodInitialized); initialized != nil && initialized.Status == corev1.ConditionFalse {
+			return conditionStatus(StatusInitializing, initialized)
+		}
+
+		return podStatus(StatusStarting, pod)
+	}
+
+	// pods without a ready condition are ready if all containers are
+	ready := podCondition(pod, corev1.PodReady)
+	if ready == nil {
+		for i := range pod.Status.ContainerStatuses {
+			if !IsReady(&pod.Status.ContainerStatuses[i]) {
+				return podStatus(StatusNotReady, pod)
+			}
+		}
+
+		return podStatus(StatusRunning, pod)
+	} else if ready.Status != corev1.ConditionTrue {
+		return conditionStatus(StatusNotReady, ready)
+	}
+
+	return conditionStatus(StatusRunning, ready)
+}
+
+// waitingStatus returns the status of a container that is waiting to start or nil
+func waitingStatus(containerStatus *corev1.ContainerStatus, events []corev1.Event) *WorkspaceStatus {
+	if !IsWaiting(containerStatus) {
+		return nil
+	}
+
+	waiting := containerStatus.State.Waiting
+	status := &WorkspaceStatus{
+		Reason:  waiting.Reason,
+		Message: waiting.Message,
+	}
+	switch waiting.Reason {
+	case "CrashLoopBackOff":
+		status.Status = StatusCrashLooping
+		if lastTerminated := containerStatus.LastTerminationState.Terminated; lastTerminated != nil {
+			status.LastTransitionTime = &lastTerminated.FinishedAt.Time
+		}
+	case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull":
+		status.Status = StatusImagePullFailed
+	case "PodInitializing":
+		status.Status = StatusInitializing
+	default:
+		status.Status = StatusStarting
+		if pulling := pullingEvent(events); pulling != nil {
+			status.Status = StatusPullingImage
+			status.Reason = pulling.Reason
+			status.Message = pulling.Message
+			status.LastTransitionTime = eventTime(pulling)
+		}
+	}
+
+	return status
+}
+
+// pullingEvent returns the event of an image pull that didn't finish yet or nil
+func pullingEvent(events []corev1.Event) *corev1.Event {
+	sorted := make([]corev1.Event, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return eventTime(&sorted[i]).Before(*eventTime(&sorted[j]))
+	})
+
+	var pulling *corev1.Event
+	for i := range sorted {
+		switch sorted[i].Reason {
+		case "Pulling":
+			pulling = &sorted[i]
+		case "Pulled", "Failed", "BackOff":
+			pulling = nil
+		}
+	}
+
+	return pulling
+}
+
+// eventTime returns the time the event was last seen
+func eventTime(event *corev1.Event) *time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return &event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return &event.EventTime.Time
+	default:
+		return &event.CreationTimestamp.Time
+	}
+}
+
+func terminatedContainer(containerStatuses []corev1.ContainerStatus) *corev1.ContainerStatus {
+	for i := range containerStatuses {
+		if IsTerminated(&containerStatuses[i]) && !Succeeded(&containerStatuses[i]) {
+			return &containerStatuses[i]
+		}
+	}
+
+	return nil
+}
+
+func podCondition(pod *corev1.Pod, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+func conditionStatus(status string, condition *corev1.PodCondition) *WorkspaceStatus {
+	workspaceStatus := &WorkspaceStatus{
+		Status:  status,
+		Reason:  condition.Reason,
+		Message: condition.Message,
+	}
+	if !condition.LastTransitionTime.IsZero() {
+		workspaceStatus.LastTransitionTime = &condition.LastTransitionTime.Time
+	}
+
+	return workspaceStatus
+}
+
+func podStatus(status string, pod *corev1.Pod) *WorkspaceStatus {
+	workspaceStatus := &WorkspaceStatus{
+		Status:  status,
+		Reason:  pod.Status.Reason,
+		Message: pod.Status.Message,
+	}
+	if pod.Status.StartTime != nil {
+		workspaceStatus.LastTransitionTime = &pod.Status.StartTime.Time
+	} else if !pod.CreationTimestamp.IsZero() {
+		workspaceStatus.LastTransitionTime = &pod.CreationTimestamp.Time
+	}
+
+	return workspaceStatus
+}
@@ -0,0 +1,311 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestWorkspaceStatus(t *testing.T) {
+	transitionTime := metav1.NewTime(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	boundPvc := &corev1.PersistentVolumeClaim{Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound}}
+	pendingPvc := &corev1.PersistentVolumeClaim{Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending}}
+	pod := func(status corev1.PodStatus) *corev1.Pod {
+		return &corev1.Pod{
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: InitContainerName}},
+				Containers:     []corev1.Container{{Name: DevContainerName}},
+			},
+			Status: status,
+		}
+	}
+	waiting := func(reason string) []corev1.ContainerStatus {
+		return []corev1.ContainerStatus{{
+			Name:  DevContainerName,
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: reason + " message"}},
+		}}
+	}
+	event := func(reason string, age time.Duration) corev1.Event {
+		return corev1.Event{
+			Reason:        reason,
+			Message:       reason + " image",
+			LastTimestamp: metav1.NewTime(transitionTime.Add(-age)),
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		pvc      *corev1.PersistentVolumeClaim
+		pod      *corev1.Pod
+		events   []corev1.Event
+		expected WorkspaceStatus
+	}{
+		{
+			name:     "stopped",
+			pvc:      boundPvc,
+			expected: WorkspaceStatus{Status: StatusStopped},
+		},
+		{
+			name: "terminating",
+			pvc:  boundPvc,
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				DeletionTimestamp: &transitionTime,
+			}},
+			expected: WorkspaceStatus{Status: StatusTerminating, LastTransitionTime: &transitionTime.Time},
+		},
+		{
+			name: "volume-unbound",
+			pvc:  pendingPvc,
+			pod: pod(corev1.PodStatus{
+				Phase: corev1.PodPending,
+				Conditions: []corev1.PodCondition{{
+					Type:               corev1.PodScheduled,
+					Status:             corev1.ConditionFalse,
+					Reason:             corev1.PodReasonUnschedulable,
+					Message:            "0/3 nodes are available: pod has unbound immediate PersistentVolumeClaims.",
+					LastTransitionTime: transitionTime,
+				}},
+			}),
+			expected: WorkspaceStatus{
+				Status:             StatusVolumeUnbound,
+				Reason:             corev1.PodReasonUnschedulable,
+				Message:            "0/3 nodes are available: pod has unbound immediate PersistentVolumeClaims.",
+				LastTransitionTime: &transitionTime.Time,
+			},
+		},
+		{
+			name: "pending-scheduling",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase: corev1.PodPending,
+				Conditions: []corev1.PodCondition{{
+					Type:               corev1.PodScheduled,
+					Status:             corev1.ConditionFalse,
+					Reason:             corev1.PodReasonUnschedulable,
+					Message:            "0/3 nodes are available: 3 Insufficient memory.",
+					LastTransitionTime: transitionTime,
+				}},
+			}),
+			expected: WorkspaceStatus{
+				Status:             StatusPendingScheduling,
+				Reason:             corev1.PodReasonUnschedulable,
+				Message:            "0/3 nodes are available: 3 Insufficient memory.",
+				LastTransitionTime: &transitionTime.Time,
+			},
+		},
+		{
+			name: "initializing",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase: corev1.PodPending,
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name:  InitContainerName,
+					State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: transitionTime}},
+				}},
+				ContainerStatuses: waiting("PodInitializing"),
+			}),
+			expected: WorkspaceStatus{
+				Status:             StatusInitializing,
+				Reason:             "InitContainerRunning",
+				Message:            "init container 'devpod-init' is running",
+				LastTransitionTime: &transitionTime.Time,
+			},
+		},
+		{
+			name: "pulling-image",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: waiting("ContainerCreating"),
+			}),
+			events: []corev1.Event{event("Pulling", 0), event("Scheduled", time.Minute)},
+			expected: WorkspaceStatus{
+				Status:             StatusPullingImage,
+				Reason:             "Pulling",
+				Message:            "Pulling image",
+				LastTransitionTime: &transitionTime.Time,
+			},
+		},
+		{
+			name: "image-pulled",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: waiting("ContainerCreating"),
+			}),
+			events: []corev1.Event{event("Pulled", 0), event("Pulling", time.Minute)},
+			expected: WorkspaceStatus{
+				Status:  StatusStarting,
+				Reason:  "ContainerCreating",
+				Message: "ContainerCreating message",
+			},
+		},
+		{
+			name: "image-pull-failed",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: waiting("ImagePullBackOff"),
+			}),
+			expected: WorkspaceStatus{
+				Status:  StatusImagePullFailed,
+				Reason:  "ImagePullBackOff",
+				Message: "ImagePullBackOff message",
+			},
+		},
+		{
+			name: "crash-looping",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  DevContainerName,
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 5m0s"}},
+					LastTerminationState: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, FinishedAt: transitionTime},
+					},
+				}},
+			}),
+			expected: WorkspaceStatus{
+				Status:             StatusCrashLooping,
+				Reason:             "CrashLoopBackOff",
+				Message:            "back-off 5m0s",
+				LastTransitionTime: &transitionTime.Time,
+			},
+		},
+		{
+			name: "evicted",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase:     corev1.PodFailed,
+				Reason:    "Evicted",
+				Message:   "The node was low on resource: memory.",
+				StartTime: &transitionTime,
+			}),
+			expected: WorkspaceStatus{
+				Status:             StatusEvicted,
+				Reason:             "Evicted",
+				Message:            "The node was low on resource: memory.",
+				LastTransitionTime: &transitionTime.Time,
+			},
+		},
+		{
+			name: "node-lost",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{
+					Type:               corev1.PodReady,
+					Status:             corev1.ConditionFalse,
+					Reason:             "NodeNotReady",
+					LastTransitionTime: transitionTime,
+				}},
+			}),
+			expected: WorkspaceStatus{
+				Status:             StatusNodeLost,
+				Reason:             "NodeNotReady",
+				LastTransitionTime: &transitionTime.Time,
+			},
+		},
+		{
+			name: "failed",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: DevContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						ExitCode:   137,
+						Reason:     "OOMKilled",
+						FinishedAt: transitionTime,
+					}},
+				}},
+			}),
+			expected: WorkspaceStatus{
+				Status:             StatusFailed,
+				Reason:             "OOMKilled",
+				LastTransitionTime: &transitionTime.Time,
+			},
+		},
+		{
+			name: "running",
+			pvc:  boundPvc,
+			pod: pod(corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  DevContainerName,
+					Ready: true,
+					State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				}},
+				Conditions: []corev1.PodCondition{{
+					Type:               corev1.PodReady,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: transitionTime,
+				}},
+			}),
+			expected: WorkspaceStatus{Status: StatusRunning, LastTransitionTime: &transitionTime.Time},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			status := workspaceStatus(testCase.pvc, testCase.pod, testCase.events)
+			assert.Equal(t, testCase.expected, *status)
+		})
+	}
+}
+
+func TestFindWorkspaceDoesNotWait(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	pod := objects[1].(*corev1.Pod)
+	podPending(pod)
+	cluster := newFakeCluster(objects[0], pod)
+	d := cluster.driver(t, &options.Options{PodTimeout: "1m"})
+
+	start := time.Now()
+	details, err := d.FindWorkspace(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, StatusPendingScheduling, details.State.Status)
+	assert.Equal(t, corev1.PodReasonUnschedulable, details.WorkspaceStatus.Reason)
+
+	// devpod reads the container details, the workspace status is added next to them
+	out, err := json.Marshal(details)
+	assert.NoError(t, err)
+	raw := map[string]json.RawMessage{}
+	assert.NoError(t, json.Unmarshal(out, &raw))
+	assert.Contains(t, raw, "ID")
+	assert.Contains(t, raw, "State")
+	assert.Contains(t, raw, "WorkspaceStatus")
+}
+
+func TestFindDevContainerStopped(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	cluster := newFakeCluster(objects[0])
+	d := cluster.driver(t, &options.Options{})
+
+	details, err := d.FindDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusStopped, details.State.Status)
+}
+
+func TestStartDevContainerReplacesEvictedPod(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	pod := objects[1].(*corev1.Pod)
+	pod.Status = corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}
+	cluster := newFakeCluster([]runtime.Object{objects[0], pod}...)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.deleted())
+	assert.Equal(t, []string{"pods/devpod-test"}, cluster.created())
+	assert.Equal(t, corev1.PodRunning, cluster.pod(t, "devpod-test").Status.Phase)
+}
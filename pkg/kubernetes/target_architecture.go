@@ -3,9 +3,7 @@ package kubernetes
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/loft-sh/devpod/pkg/encoding"
@@ -20,8 +18,7 @@ func (k *KubernetesDriver) TargetArchitecture(ctx context.Context, workspaceId s
 	// namespace
 	if k.namespace != "" && k.options.CreateNamespace == "true" {
 		k.Log.Debugf("Create namespace '%s'", k.namespace)
-		buf := &bytes.Buffer{}
-		err := k.runCommand(ctx, []string{"create", "ns", k.namespace}, nil, buf, buf)
+		err := k.client.CreateNamespace(ctx, k.namespace)
 		if err != nil {
 			k.Log.Debugf("Error creating namespace: %v", err)
 		}
@@ -60,31 +57,29 @@ func (k *KubernetesDriver) TargetArchitecture(ctx context.Context, workspaceId s
 	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
 	pod.Spec.Containers = getArchitectureDetectionPodContainers(pod, k.helperImage(), []string{"sh", "-c", "uname -m && tail -f /dev/null"})
 
-	podRaw, err := json.Marshal(pod)
-	if err != nil {
-		return "", err
-	}
-
 	// get target architecture
 	k.Log.Infof("Find out cluster architecture...")
-	stdout := &bytes.Buffer{}
-	stderr := &bytes.Buffer{}
-	err = k.runCommand(ctx, []string{"create", "-f", "-"}, strings.NewReader(string(podRaw)), stdout, stderr)
+	_, err := k.client.CreatePod(ctx, pod, metav1.CreateOptions{})
 	if err != nil {
-		return "", fmt.Errorf("find out cluster architecture: %s %s %w", stdout.String(), stderr.String(), err)
+		return "", fmt.Errorf("find out cluster architecture: %w", err)
 	}
 
 	// wait for pod running
 	k.Log.Infof("Waiting for cluster architecture job to come up...")
 	_, err = k.waitPodRunning(ctx, podName)
 	if err != nil {
-		return "", fmt.Errorf("find out cluster architecture: %s %s %w", stdout.String(), stderr.String(), err)
+		// the workspace pod would be scheduled next to the pod, so it mustn't outlive
+		// a failed or interrupted detection
+		k.cleanupPod(ctx, podName)
+		return "", fmt.Errorf("find out cluster architecture: %w", err)
 	}
 
 	// capture uname output
-	err = k.runCommand(ctx, []string{"logs", podName, "-n", k.namespace}, os.Stdin, stdout, stderr)
+	stdout := &bytes.Buffer{}
+	err = k.client.Logs(ctx, podName, &corev1.PodLogOptions{}, stdout)
 	if err != nil {
-		return "", fmt.Errorf("find out cluster architecture: %s %s %w", stdout.String(), stderr.String(), err)
+		k.cleanupPod(ctx, podName)
+		return "", fmt.Errorf("find out cluster architecture: %w", err)
 	}
 
 	unameOutput := stdout.String()
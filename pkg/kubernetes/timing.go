@@ -0,0 +1,248 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// the phases of a workspace startup in the order they usually happen
+const (
+	phaseNamespace     = "namespace"
+	phaseArchDetection = "archDetection"
+	phaseVolume        = "volume"
+	phasePullSecret    = "pullSecret"
+	phaseScheduling    = "scheduling"
+	phaseImagePull     = "imagePull"
+	phaseInitContainer = "initContainer"
+	phaseReadiness     = "readiness"
+)
+
+// StartupTimingJSON prints the startup timing as a single line of JSON instead of a table
+const StartupTimingJSON = "json"
+
+// startupTiming records how long the phases of a run or start took. The phases the
+// driver runs itself are measured locally, the ones of the pod are derived from its
+// conditions, container states and events, which only have a precision of seconds.
+type startupTiming struct {
+	Workspace string         `json:"workspace"`
+	Command   string         `json:"command"`
+	Start     time.Time      `json:"start"`
+	Seconds   float64        `json:"seconds"`
+	Phases    []startupPhase `json:"phases"`
+
+	// podStarted is set once a pod started by this command was observed
+	podStarted bool
+}
+
+type startupPhase struct {
+	Name    string    `json:"name"`
+	Start   time.Time `json:"start"`
+	Seconds float64   `json:"seconds"`
+
+	end time.Time
+}
+
+func newStartupTiming(id, command string) *startupTiming {
+	return &startupTiming{
+		Workspace: id,
+		Command:   command,
+		Start:     time.Now(),
+	}
+}
+
+// track starts measuring the phase and returns the func to stop it
+func (t *startupTiming) track(name string) func() {
+	start := time.Now()
+	return func() {
+		t.add(name, start, time.Now())
+	}
+}
+
+// add records the phase or extends it if it was recorded before. It does nothing if
+// timing is disabled or a timestamp is missing.
+func (t *startupTiming) add(name string, start, end time.Time) {
+	if t == nil || start.IsZero() || end.IsZero() {
+		return
+	}
+	if end.Before(start) {
+		end = start
+	}
+
+	for i := range t.Phases {
+		phase := &t.Phases[i]
+		if phase.Name != name {
+			continue
+		}
+
+		if start.Before(phase.Start) {
+			phase.Start = start
+		}
+		if end.After(phase.end) {
+			phase.end = end
+		}
+		phase.Seconds = phase.end.Sub(phase.Start).Seconds()
+		return
+	}
+
+	t.Phases = append(t.Phases, startupPhase{
+		Name:    name,
+		Start:   start,
+		Seconds: end.Sub(start).Seconds(),
+		end:     end,
+	})
+}
+
+// addArchDetection records how long the architecture detection pod took to come up
+func (t *startupTiming) addArchDetection(pod *corev1.Pod) {
+	if ready := podCondition(pod, corev1.PodReady); ready != nil && ready.Status == corev1.ConditionTrue {
+		t.add(phaseArchDetection, pod.CreationTimestamp.Time, ready.LastTransitionTime.Time)
+	}
+}
+
+// addPod records the phases of the workspace pod once it's running. Pods that were
+// already ready before the command started aren't recorded, as nothing was started.
+func (t *startupTiming) addPod(pod *corev1.Pod, events []corev1.Event) {
+	if t == nil {
+		return
+	}
+
+	ready := podCondition(pod, corev1.PodReady)
+	if ready != nil && ready.Status == corev1.ConditionTrue && ready.LastTransitionTime.Time.Before(t.Start.Truncate(time.Second)) {
+		return
+	}
+	t.podStarted = true
+
+	scheduled := podCondition(pod, corev1.PodScheduled)
+	if scheduled != nil && scheduled.Status == corev1.ConditionTrue {
+		t.add(phaseScheduling, pod.CreationTimestamp.Time, scheduled.LastTransitionTime.Time)
+	}
+
+	// events of the pod and its pvc, which has the same name
+	var pullStart, pullEnd time.Time
+	for i := range events {
+		event := &events[i]
+		if event.InvolvedObject.Kind == "Pod" && event.InvolvedObject.UID != pod.UID {
+			continue
+		}
+
+		switch event.Reason {
+		case "ProvisioningSucceeded", "SuccessfulAttachVolume":
+			// a pvc that already existed is only attached after scheduling
+			start := pod.CreationTimestamp.Time
+			if scheduled != nil {
+				start = scheduled.LastTransitionTime.Time
+			}
+			t.add(phaseVolume, start, *eventTime(event))
+		case "Pulling":
+			if first := eventFirstTime(event); pullStart.IsZero() || first.Before(pullStart) {
+				pullStart = first
+			}
+		case "Pulled":
+			if last := *eventTime(event); last.After(pullEnd) {
+				pullEnd = last
+			}
+		}
+	}
+	t.add(phaseImagePull, pullStart, pullEnd)
+
+	for _, containerStatus := range pod.Status.InitContainerStatuses {
+		if containerStatus.Name == InitContainerName && containerStatus.State.Terminated != nil {
+			t.add(phaseInitContainer, containerStatus.State.Terminated.StartedAt.Time, containerStatus.State.Terminated.FinishedAt.Time)
+		}
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.Name != DevContainerName || containerStatus.State.Running == nil {
+			continue
+		}
+
+		end := containerStatus.State.Running.StartedAt.Time
+		if ready != nil && ready.Status == corev1.ConditionTrue {
+			end = ready.LastTransitionTime.Time
+		}
+		t.add(phaseReadiness, containerStatus.State.Running.StartedAt.Time, end)
+	}
+}
+
+// eventFirstTime returns when the event was first seen
+func eventFirstTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// finish sets the total duration and sorts the phases by their start
+func (t *startupTiming) finish(end time.Time) {
+	t.Seconds = end.Sub(t.Start).Seconds()
+	sort.SliceStable(t.Phases, func(i, j int) bool {
+		return t.Phases[i].Start.Before(t.Phases[j].Start)
+	})
+}
+
+// String formats the timing as a table of the phases with their duration and their
+// offset from the start of the command
+func (t *startupTiming) String() string {
+	lines := []string{fmt.Sprintf("Startup of workspace '%s' took %s:", t.Workspace, formatSeconds(t.Seconds))}
+	for _, phase := range t.Phases {
+		offset := phase.Start.Sub(t.Start).Seconds()
+		if offset < 0 {
+			offset = 0
+		}
+		lines = append(lines, fmt.Sprintf("  %-14s %8s  at +%s", phase.Name, formatSeconds(phase.Seconds), formatSeconds(offset)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(100 * time.Millisecond).String()
+}
+
+// recordPodTiming records the phases of the running workspace pod
+func (k *KubernetesDriver) recordPodTiming(ctx context.Context, pod *corev1.Pod) {
+	if k.timing == nil || pod == nil {
+		return
+	}
+
+	events, err := k.client.ListEvents(ctx, pod.Name)
+	if err != nil {
+		k.Log.Debugf("Error listing events of pod '%s': %v", pod.Name, err)
+	}
+
+	k.timing.addPod(pod, events)
+}
+
+// reportStartupTiming prints how long the phases of the startup took in the format
+// selected by STARTUP_TIMING_FORMAT
+func (k *KubernetesDriver) reportStartupTiming() {
+	if k.timing == nil {
+		return
+	} else if !k.timing.podStarted {
+		k.Log.Debugf("Pod '%s' was already running, skipping the startup timing", k.timing.Workspace)
+		return
+	}
+
+	k.timing.finish(time.Now())
+	if k.options.StartupTimingFormat != StartupTimingJSON {
+		k.Log.Info(k.timing.String())
+		return
+	}
+
+	out, err := json.Marshal(k.timing)
+	if err != nil {
+		k.Log.Debugf("Error marshalling startup timing: %v", err)
+		return
+	}
+	k.Log.Info(string(out))
+}
@@ -0,0 +1,133 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loft-sh/devpod-provider-kubernetes/pkg/options"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func normalEvent(kind, uid, reason string, firstSeen, lastSeen time.Time) corev1.Event {
+	event := warningEvent(kind, uid, reason, "", lastSeen)
+	event.Type = corev1.EventTypeNormal
+	event.FirstTimestamp = metav1.NewTime(firstSeen)
+	return event
+}
+
+// podStarted moves the pod through scheduling, the init container and the dev container
+// starting at the given time
+func podStarted(start time.Time) podTransition {
+	return func(pod *corev1.Pod) {
+		podRunning(pod)
+		pod.CreationTimestamp = metav1.NewTime(start)
+		pod.Status.Conditions = []corev1.PodCondition{
+			{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(start.Add(2 * time.Second))},
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(start.Add(20 * time.Second))},
+		}
+		for i := range pod.Status.InitContainerStatuses {
+			pod.Status.InitContainerStatuses[i].State.Terminated.StartedAt = metav1.NewTime(start.Add(10 * time.Second))
+			pod.Status.InitContainerStatuses[i].State.Terminated.FinishedAt = metav1.NewTime(start.Add(15 * time.Second))
+		}
+		for i := range pod.Status.ContainerStatuses {
+			pod.Status.ContainerStatuses[i].State.Running.StartedAt = metav1.NewTime(start.Add(17 * time.Second))
+		}
+	}
+}
+
+func phaseDurations(timing *startupTiming) map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	for _, phase := range timing.Phases {
+		durations[phase.Name] = time.Duration(phase.Seconds * float64(time.Second))
+	}
+
+	return durations
+}
+
+func TestStartupTimingAddPod(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "devpod-test", UID: "uid-devpod-test"},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: InitContainerName}},
+			Containers:     []corev1.Container{{Name: DevContainerName}},
+		},
+	}
+	podStarted(start)(pod)
+
+	events := []corev1.Event{
+		normalEvent("PersistentVolumeClaim", "uid-pvc", "ProvisioningSucceeded", start.Add(time.Second), start.Add(4*time.Second)),
+		normalEvent("Pod", "uid-devpod-test", "SuccessfulAttachVolume", start.Add(5*time.Second), start.Add(5*time.Second)),
+		normalEvent("Pod", "uid-devpod-test", "Pulling", start.Add(3*time.Second), start.Add(3*time.Second)),
+		normalEvent("Pod", "uid-devpod-test", "Pulled", start.Add(9*time.Second), start.Add(9*time.Second)),
+		// previous pod of the workspace
+		normalEvent("Pod", "uid-old", "Pulling", start.Add(-time.Hour), start.Add(-time.Hour)),
+	}
+
+	timing := &startupTiming{Workspace: "devpod-test", Start: start}
+	timing.addPod(pod, events)
+	assert.True(t, timing.podStarted)
+	assert.Equal(t, map[string]time.Duration{
+		phaseScheduling:    2 * time.Second,
+		phaseVolume:        3 * time.Second,
+		phaseImagePull:     6 * time.Second,
+		phaseInitContainer: 5 * time.Second,
+		phaseReadiness:     3 * time.Second,
+	}, phaseDurations(timing))
+
+	// a pod that was ready before the command started
+	timing = &startupTiming{Workspace: "devpod-test", Start: start.Add(time.Minute)}
+	timing.addPod(pod, events)
+	assert.False(t, timing.podStarted)
+	assert.Empty(t, timing.Phases)
+}
+
+func TestStartupTimingString(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	timing := &startupTiming{Workspace: "devpod-test", Start: start}
+	timing.add(phaseVolume, start.Add(4800*time.Millisecond), start.Add(36*time.Second))
+	timing.add(phaseNamespace, start, start.Add(120*time.Millisecond))
+	timing.add(phaseImagePull, start.Add(33*time.Second), start.Add(62*time.Second))
+	// extends the phase
+	timing.add(phaseVolume, start.Add(5*time.Second), start.Add(40*time.Second))
+	// missing timestamps
+	timing.add(phaseReadiness, time.Time{}, start)
+	timing.finish(start.Add(72430 * time.Millisecond))
+
+	assert.Equal(t, "Startup of workspace 'devpod-test' took 1m12.4s:\n"+
+		"  namespace         100ms  at +0s\n"+
+		"  volume            35.2s  at +4.8s\n"+
+		"  imagePull           29s  at +33s", timing.String())
+}
+
+func TestRunDevContainerStartupTiming(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.scriptPod("devpod-test", podStarted(time.Now().Add(time.Second)))
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.RunDevContainer(context.Background(), testWorkspaceID, testRunOptions())
+	assert.NoError(t, err)
+	assert.True(t, d.timing.podStarted)
+	assert.Equal(t, "run", d.timing.Command)
+
+	durations := phaseDurations(d.timing)
+	assert.Contains(t, durations, phaseVolume)
+	assert.Equal(t, 2*time.Second, durations[phaseScheduling])
+	assert.Equal(t, 5*time.Second, durations[phaseInitContainer])
+	assert.Equal(t, 3*time.Second, durations[phaseReadiness])
+}
+
+func TestStartDevContainerAlreadyRunningSkipsTiming(t *testing.T) {
+	objects := existingWorkspace(t, &options.Options{})
+	podStarted(time.Now().Add(-time.Hour))(objects[1].(*corev1.Pod))
+	cluster := newFakeCluster(objects...)
+	d := cluster.driver(t, &options.Options{})
+
+	err := d.StartDevContainer(context.Background(), testWorkspaceID)
+	assert.NoError(t, err)
+	assert.False(t, d.timing.podStarted)
+	assert.Empty(t, d.timing.Phases)
+}
@@ -2,19 +2,32 @@ package kubernetes
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/loft-sh/devpod-provider-kubernetes/pkg/throttledlogger"
-	"github.com/loft-sh/devpod/pkg/command"
 	perrors "github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
+// waitPodRunning waits until all containers of the pod are up and ready. If the pod
+// doesn't come up, the recent warning events of the pod and its pvc are added to the error.
 func (k *KubernetesDriver) waitPodRunning(ctx context.Context, id string) (*corev1.Pod, error) {
+	pod, err := k.waitPodRunningWithTimeout(ctx, id)
+	if err != nil && !perrors.Is(ctx.Err(), context.Canceled) {
+		return pod, k.explainPodError(ctx, id, err)
+	}
+
+	return pod, err
+}
+
+func (k *KubernetesDriver) waitPodRunningWithTimeout(ctx context.Context, id string) (*corev1.Pod, error) {
+	reporter := newEventReporter(k, id)
 	throttledLogger := throttledlogger.NewThrottledLogger(k.Log, time.Second*5)
 
 	timeoutDuration, err := time.ParseDuration(k.options.PodTimeout)
@@ -22,136 +35,285 @@ func (k *KubernetesDriver) waitPodRunning(ctx context.Context, id string) (*core
 		return nil, perrors.Wrap(err, "parse pod timeout")
 	}
 
-	var pod *corev1.Pod
-	err = wait.PollUntilContextTimeout(ctx, time.Second, timeoutDuration, true, func(ctx context.Context) (bool, error) {
-		var err error
-		pod, err = k.getPod(ctx, id)
+	ctx, cancel := context.WithTimeout(ctx, timeoutDuration)
+	defer cancel()
+
+	// re-evaluate the last seen pod periodically, so that progress is still
+	// logged while no new events arrive
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	backoff := watchBackoff()
+	polling := false
+	for {
+		pod, err := k.getPod(ctx, id)
 		if err != nil {
-			return false, err
+			return nil, waitPodError(ctx, id, err)
 		} else if pod == nil {
-			return true, nil
+			return nil, nil
 		}
 
-		// check pod for problems
-		if pod.DeletionTimestamp != nil {
-			throttledLogger.Infof("Waiting, since pod '%s' is terminating", id)
-			return false, nil
+		done, err := k.checkPodRunning(ctx, id, pod, throttledLogger)
+		if err != nil || done {
+			return pod, err
 		}
+		reporter.report(ctx, pod)
 
-		// Let's print all conditions that are false to help people troubleshoot infra issues
-		condMsg := ""
-		for _, cond := range pod.Status.Conditions {
-			if cond.Status == corev1.ConditionFalse {
-				condMsg += fmt.Sprintf("Condition \"%s\" is %s\n", cond.Type, cond.Status)
-				if cond.Reason != "" {
-					condMsg += fmt.Sprintf("%s Reason: %s\n", cond.Type, cond.Reason)
-				}
-				if cond.Message != "" {
-					condMsg += fmt.Sprintf("%s Message: %s\n", cond.Type, cond.Message)
-				}
+		if polling {
+			select {
+			case <-ctx.Done():
+				return nil, waitPodError(ctx, id, ctx.Err())
+			case <-ticker.C:
 			}
+			continue
 		}
 
-		// check pod status
-		if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
-			msg := fmt.Sprintf("Waiting, since pod '%s' is starting", id)
-			if condMsg != "" {
-				msg += fmt.Sprintf("\n%s", strings.TrimSpace(condMsg))
+		// watch the pod starting from the resource version we just checked
+		watcher, err := k.client.WatchPod(ctx, id, pod.ResourceVersion)
+		if err == nil {
+			pod, done, err = k.watchPodRunning(ctx, id, pod, watcher, ticker, throttledLogger, reporter)
+			watcher.Stop()
+			watchErr := &watchError{}
+			if done || (err != nil && !perrors.As(err, &watchErr)) {
+				return pod, err
+			} else if err == nil || kerrors.IsResourceExpired(err) || kerrors.IsGone(err) {
+				// watch was closed or expired, get the pod again and start a new watch
+				backoff = watchBackoff()
+				continue
 			}
-			throttledLogger.Infof("%s", msg)
-			return false, nil
 		}
 
-		// check init container status
-		for _, c := range pod.Status.InitContainerStatuses {
-			containerStatus := &c
-			if IsWaiting(containerStatus) {
-				if IsCritical(containerStatus) {
-					return false, fmt.Errorf("pod '%s' init container '%s' is waiting to start: %s (%s)", id, c.Name, c.State.Waiting.Message, c.State.Waiting.Reason)
-				}
+		// waiting used to only need to get pods, so don't fail if watching isn't allowed
+		if kerrors.IsForbidden(err) || kerrors.IsMethodNotSupported(err) {
+			k.Log.Debugf("Can't watch pod '%s', polling instead: %v", id, err)
+			polling = true
+			continue
+		}
 
-				throttledLogger.Infof("Waiting, since pod '%s' init container '%s' is waiting to start: %s (%s)", id, c.Name, c.State.Waiting.Message, c.State.Waiting.Reason)
-				return false, nil
-			}
+		delay := backoff.Step()
+		k.Log.Debugf("Error watching pod '%s', retrying in %s: %v", id, delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return nil, waitPodError(ctx, id, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watchBackoff is the delay between watches of a pod that failed, e.g. because the
+// connection dropped
+func watchBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    5,
+		Cap:      15 * time.Second,
+	}
+}
+
+// watchError is the error a watch failed with, the pod is watched again afterwards
+type watchError struct {
+	err error
+}
+
+func (e *watchError) Error() string {
+	return e.err.Error()
+}
 
-			if IsTerminated(containerStatus) && !Succeeded(containerStatus) {
-				return false, fmt.Errorf("pod '%s' init container '%s' is terminated: %s (%s)", id, c.Name, c.State.Terminated.Message, c.State.Terminated.Reason)
+func (e *watchError) Unwrap() error {
+	return e.err
+}
+
+// watchPodRunning checks the pod on every event of the watcher until it is running.
+// It returns done=false if the watch was closed and needs to be restarted, with a
+// *watchError if the watch failed.
+func (k *KubernetesDriver) watchPodRunning(
+	ctx context.Context,
+	id string,
+	pod *corev1.Pod,
+	watcher watch.Interface,
+	ticker *time.Ticker,
+	throttledLogger *throttledlogger.ThrottledLogger,
+	reporter *eventReporter,
+) (*corev1.Pod, bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return pod, false, waitPodError(ctx, id, ctx.Err())
+		case <-ticker.C:
+			if podSucceeded(pod) {
+				// the pod was deleted when it was checked, wait for the events of the deletion
+				continue
 			}
 
-			container, err := getContainer(pod.Spec.InitContainers, c.Name)
-			if err != nil {
-				throttledLogger.Infof("Could not find container '%s'", c.Name)
-				return false, err
+			done, err := k.checkPodRunning(ctx, id, pod, throttledLogger)
+			if err != nil || done {
+				return pod, done, err
+			}
+			reporter.report(ctx, pod)
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return pod, false, nil
 			}
 
-			restartable := restartableInitContainer(container.RestartPolicy)
-			if restartable {
-				if !IsStarted(containerStatus) || !IsReady(containerStatus) {
-					throttledLogger.Infof("Waiting, since pod '%s' init container '%s' is not ready yet", id, c.Name)
-					return false, nil
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				updatedPod, ok := event.Object.(*corev1.Pod)
+				if !ok {
+					continue
 				}
-			} else {
-				if IsRunning(containerStatus) {
-					throttledLogger.Infof("Waiting, since pod '%s' init container '%s' is running", id, c.Name)
-					return false, nil
+
+				pod = updatedPod
+				done, err := k.checkPodRunning(ctx, id, pod, throttledLogger)
+				if err != nil || done {
+					return pod, done, err
 				}
+			case watch.Deleted:
+				return nil, true, nil
+			case watch.Error:
+				return pod, false, &watchError{err: kerrors.FromObject(event.Object)}
 			}
 		}
+	}
+}
 
-		// check container status
-		for _, c := range pod.Status.ContainerStatuses {
-			containerStatus := &c
-			// delete succeeded pods
-			if IsTerminated(containerStatus) && Succeeded(containerStatus) {
-				// delete pod that is succeeded
-				k.Log.Debugf("Delete Pod '%s' because it is succeeded", id)
-				err = k.deletePod(ctx, id)
-				if err != nil {
-					return false, err
-				}
+// podSucceeded returns true if a container of the pod terminated successfully, which
+// makes checkPodRunning delete the pod
+func podSucceeded(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.ContainerStatuses {
+		containerStatus := &c
+		if IsTerminated(containerStatus) && Succeeded(containerStatus) {
+			return true
+		}
+	}
 
-				return false, nil
+	return false
+}
+
+func waitPodError(ctx context.Context, id string, err error) error {
+	if perrors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out waiting for pod '%s' to come up", id)
+	}
+
+	return err
+}
+
+// checkPodRunning returns true if all containers of the pod are up and ready and
+// an error if the pod is in a state it won't recover from
+func (k *KubernetesDriver) checkPodRunning(ctx context.Context, id string, pod *corev1.Pod, throttledLogger *throttledlogger.ThrottledLogger) (bool, error) {
+	// check pod for problems
+	if pod.DeletionTimestamp != nil {
+		throttledLogger.Infof("Waiting, since pod '%s' is terminating", id)
+		return false, nil
+	}
+
+	// Let's print all conditions that are false to help people troubleshoot infra issues
+	condMsg := ""
+	for _, cond := range pod.Status.Conditions {
+		if cond.Status == corev1.ConditionFalse {
+			condMsg += fmt.Sprintf("Condition \"%s\" is %s\n", cond.Type, cond.Status)
+			if cond.Reason != "" {
+				condMsg += fmt.Sprintf("%s Reason: %s\n", cond.Type, cond.Reason)
 			}
+			if cond.Message != "" {
+				condMsg += fmt.Sprintf("%s Message: %s\n", cond.Type, cond.Message)
+			}
+		}
+	}
 
-			if IsWaiting(containerStatus) {
-				if IsCritical(containerStatus) {
-					return false, fmt.Errorf("pod '%s' container '%s' is waiting to start: %s (%s)", id, c.Name, c.State.Waiting.Message, c.State.Waiting.Reason)
-				}
+	// check pod status
+	if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		msg := fmt.Sprintf("Waiting, since pod '%s' is starting", id)
+		if condMsg != "" {
+			msg += fmt.Sprintf("\n%s", strings.TrimSpace(condMsg))
+		}
+		throttledLogger.Infof("%s", msg)
+		return false, nil
+	}
 
-				throttledLogger.Infof("Waiting, since pod '%s' container '%s' is waiting to start: %s (%s)", id, c.Name, c.State.Waiting.Message, c.State.Waiting.Reason)
+	// check init container status
+	for _, c := range pod.Status.InitContainerStatuses {
+		containerStatus := &c
+		if IsWaiting(containerStatus) {
+			if IsCritical(containerStatus) {
+				return false, k.crashError(ctx, pod, containerStatus, fmt.Errorf("pod '%s' init container '%s' is waiting to start: %s (%s)", id, c.Name, c.State.Waiting.Message, c.State.Waiting.Reason))
+			}
+
+			throttledLogger.Infof("Waiting, since pod '%s' init container '%s' is waiting to start: %s (%s)", id, c.Name, c.State.Waiting.Message, c.State.Waiting.Reason)
+			return false, nil
+		}
+
+		if IsTerminated(containerStatus) && !Succeeded(containerStatus) {
+			return false, k.crashError(ctx, pod, containerStatus, fmt.Errorf("pod '%s' init container '%s' is terminated: %s (%s)", id, c.Name, c.State.Terminated.Message, c.State.Terminated.Reason))
+		}
+
+		container, err := getContainer(pod.Spec.InitContainers, c.Name)
+		if err != nil {
+			throttledLogger.Infof("Could not find container '%s'", c.Name)
+			return false, err
+		}
+
+		restartable := restartableInitContainer(container.RestartPolicy)
+		if restartable {
+			if !IsStarted(containerStatus) || !IsReady(containerStatus) {
+				throttledLogger.Infof("Waiting, since pod '%s' init container '%s' is not ready yet", id, c.Name)
 				return false, nil
 			}
+		} else {
+			if IsRunning(containerStatus) {
+				throttledLogger.Infof("Waiting, since pod '%s' init container '%s' is running", id, c.Name)
+				return false, nil
+			}
+		}
+	}
 
-			if IsTerminated(containerStatus) {
-				return false, fmt.Errorf("pod '%s' container '%s' is terminated: %s (%s)", id, c.Name, c.State.Terminated.Message, c.State.Terminated.Reason)
+	// check container status
+	for _, c := range pod.Status.ContainerStatuses {
+		containerStatus := &c
+		// delete succeeded pods
+		if IsTerminated(containerStatus) && Succeeded(containerStatus) {
+			// delete pod that is succeeded
+			k.Log.Debugf("Delete Pod '%s' because it is succeeded", id)
+			err := k.deletePod(ctx, id)
+			if err != nil {
+				return false, err
 			}
 
-			if !IsReady(containerStatus) {
-				throttledLogger.Infof("Waiting, since pod '%s' container '%s' is not ready yet", id, c.Name)
-				return false, nil
+			return false, nil
+		}
+
+		if IsWaiting(containerStatus) {
+			if IsCritical(containerStatus) {
+				return false, k.crashError(ctx, pod, containerStatus, fmt.Errorf("pod '%s' container '%s' is waiting to start: %s (%s)", id, c.Name, c.State.Waiting.Message, c.State.Waiting.Reason))
 			}
+
+			throttledLogger.Infof("Waiting, since pod '%s' container '%s' is waiting to start: %s (%s)", id, c.Name, c.State.Waiting.Message, c.State.Waiting.Reason)
+			return false, nil
 		}
 
-		return true, nil
-	})
+		if IsTerminated(containerStatus) {
+			return false, k.crashError(ctx, pod, containerStatus, fmt.Errorf("pod '%s' container '%s' is terminated: %s (%s)", id, c.Name, c.State.Terminated.Message, c.State.Terminated.Reason))
+		}
 
-	return pod, err
+		if !IsReady(containerStatus) {
+			throttledLogger.Infof("Waiting, since pod '%s' container '%s' is not ready yet", id, c.Name)
+			return false, nil
+		}
+	}
+
+	return true, nil
 }
 
 func (k *KubernetesDriver) getPod(ctx context.Context, id string) (*corev1.Pod, error) {
 	// try to find pod
-	out, err := k.buildCmd(ctx, []string{"get", "pod", id, "--ignore-not-found", "-o", "json"}).Output()
+	pod, err := k.client.GetPod(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("find container: %w", command.WrapCommandError(out, err))
-	} else if len(out) == 0 {
-		return nil, nil
-	}
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
 
-	// try to unmarshal pod
-	pod := &corev1.Pod{}
-	err = json.Unmarshal(out, pod)
-	if err != nil {
-		return nil, perrors.Wrap(err, "unmarshal pod")
+		return nil, fmt.Errorf("find container: %w", err)
 	}
 
 	return pod, nil
@@ -172,10 +334,22 @@ func restartableInitContainer(p *corev1.ContainerRestartPolicy) bool {
 }
 
 func (k *KubernetesDriver) waitPodDeleted(ctx context.Context, id string) error {
-	out, err := k.buildCmd(ctx, []string{"delete", "pod", id, "--ignore-not-found", "--wait"}).Output()
+	err := k.client.DeletePod(ctx, id, metav1.DeleteOptions{})
 	if err != nil {
-		return fmt.Errorf("delete pod: %w", command.WrapCommandError(out, err))
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+
+		return fmt.Errorf("delete pod: %w", err)
 	}
 
-	return nil
+	// wait until the pod is gone
+	return wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		pod, err := k.getPod(ctx, id)
+		if err != nil {
+			return false, err
+		}
+
+		return pod == nil, nil
+	})
 }
@@ -6,6 +6,10 @@ import (
 	"reflect"
 )
 
+// defaultPodTimeout is the default of POD_TIMEOUT in the provider manifest, which
+// commands run by hand don't get
+const defaultPodTimeout = "10m"
+
 type Options struct {
 	ComparableOptions
 
@@ -14,6 +18,13 @@ type Options struct {
 	KubernetesNamespace string `json:"-"`
 	KubectlPath         string `json:"-"`
 	PodTimeout          string `json:"-"`
+	StartupTimingFormat string `json:"-"`
+
+	DiskUsageWarningThreshold string `json:"-"`
+
+	Hibernate                  bool   `json:"-"`
+	HibernateSnapshotClass     string `json:"-"`
+	HibernateSnapshotRetention string `json:"-"`
 }
 
 type ComparableOptions struct {
@@ -32,6 +43,7 @@ type ComparableOptions struct {
 	DiskSize             string `json:"diskSize,omitempty"`
 	PvcAccessMode        string `json:"pvcAccessMode,omitempty"`
 	PvcAnnotations       string `json:"pvcAnnotations,omitempty"`
+	PvcDataSource        string `json:"pvcDataSource,omitempty"`
 	NodeSelector         string `json:"nodeSelector,omitempty"`
 	Resources            string `json:"resources,omitempty"`
 	WorkspaceVolumeMount string `json:"workspaceVolumeMount,omitempty"`
@@ -45,15 +57,20 @@ type ComparableOptions struct {
 }
 
 func FromEnv() (*Options, error) {
-	retOptions := &Options{}
-
-	var err error
-
-	retOptions.DevContainerID, err = fromEnvOrError("DEVCONTAINER_ID")
+	devContainerID, err := fromEnvOrError("DEVCONTAINER_ID")
 	if err != nil {
 		return nil, err
 	}
 
+	retOptions := ProviderFromEnv()
+	retOptions.DevContainerID = devContainerID
+	return retOptions, nil
+}
+
+// ProviderFromEnv reads the provider options without requiring a workspace, e.g. for
+// commands that work on all workspaces
+func ProviderFromEnv() *Options {
+	retOptions := &Options{}
 	retOptions.DiskSize = os.Getenv("DISK_SIZE")
 	retOptions.KubernetesContext = os.Getenv("KUBERNETES_CONTEXT")
 	retOptions.KubernetesConfig = os.Getenv("KUBERNETES_CONFIG")
@@ -73,13 +90,22 @@ func FromEnv() (*Options, error) {
 	retOptions.PodManifestTemplate = os.Getenv("POD_MANIFEST_TEMPLATE")
 	retOptions.Labels = os.Getenv("LABELS")
 	retOptions.PodTimeout = os.Getenv("POD_TIMEOUT")
+	if retOptions.PodTimeout == "" {
+		retOptions.PodTimeout = defaultPodTimeout
+	}
+	retOptions.StartupTimingFormat = os.Getenv("STARTUP_TIMING_FORMAT")
+	retOptions.DiskUsageWarningThreshold = os.Getenv("DISK_USAGE_WARNING_THRESHOLD")
+	retOptions.Hibernate = os.Getenv("HIBERNATE_ON_STOP") == "true"
+	retOptions.HibernateSnapshotClass = os.Getenv("HIBERNATE_SNAPSHOT_CLASS")
+	retOptions.HibernateSnapshotRetention = os.Getenv("HIBERNATE_SNAPSHOT_RETENTION")
 	retOptions.DangerouslyOverrideImage = os.Getenv("DANGEROUSLY_OVERRIDE_IMAGE")
 	retOptions.StrictSecurity = os.Getenv("STRICT_SECURITY") == "true"
 	retOptions.ArchDetectionPodManifestTemplate = os.Getenv("ARCH_DETECTION_POD_MANIFEST_TEMPLATE")
 	retOptions.WorkspaceVolumeMount = os.Getenv("WORKSPACE_VOLUME_MOUNT")
 	retOptions.PvcAnnotations = os.Getenv("PVC_ANNOTATIONS")
+	retOptions.PvcDataSource = os.Getenv("PVC_DATA_SOURCE")
 
-	return retOptions, nil
+	return retOptions
 }
 
 func Equal(a *ComparableOptions, b *ComparableOptions) bool {